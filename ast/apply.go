@@ -0,0 +1,252 @@
+package ast
+
+import "slices"
+
+// ApplyFunc is called by Apply with a cursor on the current node
+type ApplyFunc func(*Cursor) bool
+
+// Cursor describes a node found by Apply: its parent, the field of the parent holding it
+// and its index or key within that field. It also allows replacing, deleting and inserting nodes.
+type Cursor struct {
+	parent Node
+	name   string
+	key    string
+	index  int
+	node   Node
+
+	set func(Node)
+	// remove and insert are nil unless the node is held by a slice or a map
+	remove func()
+	insert func(index int, node Node)
+	// next is the index of the next node of the slice to visit
+	next *int
+}
+
+// Node returns the current node
+func (c *Cursor) Node() Node { return c.node }
+
+// Parent returns the node holding the current one, nil for the root
+func (c *Cursor) Parent() Node { return c.parent }
+
+// Name returns the name of the parent's field holding the current node, such as "Condition" or "Statements"
+func (c *Cursor) Name() string { return c.name }
+
+// Index returns the index of the current node in the parent's slice field, or -1 if the field isn't a slice
+func (c *Cursor) Index() int { return c.index }
+
+// Key returns the property name of the current node if the parent is an object literal,
+// or the parameter name if the node is a default value of a function literal
+func (c *Cursor) Key() string { return c.key }
+
+// Replace replaces the current node with n, whose children are walked instead of the old node's.
+// It panics if the parent's field can't hold n, such as a statement in place of an expression.
+// Replacing an optional node, like the value of a return statement, with nil removes it.
+func (c *Cursor) Replace(n Node) {
+	c.set(n)
+	c.node = n
+}
+
+// Delete removes the current node from the parent's slice, object literal or parameter defaults,
+// its children aren't walked. It panics if the node isn't held by one of them.
+func (c *Cursor) Delete() {
+	if c.remove == nil {
+		panic("ast: Delete of a node not held by a slice or an object literal")
+	}
+	c.remove()
+	c.node = nil
+}
+
+// InsertBefore inserts n before the current node in the parent's slice, n is not walked.
+// It panics if the node isn't held by a slice.
+func (c *Cursor) InsertBefore(n Node) {
+	if c.insert == nil {
+		panic("ast: InsertBefore of a node not held by a slice")
+	}
+	c.insert(c.index, n)
+	c.index++
+	*c.next++
+}
+
+// InsertAfter inserts n after the current node in the parent's slice, n is not walked.
+// It panics if the node isn't held by a slice.
+func (c *Cursor) InsertAfter(n Node) {
+	if c.insert == nil {
+		panic("ast: InsertAfter of a node not held by a slice")
+	}
+	c.insert(c.index+1, n)
+	*c.next++
+}
+
+type applier struct {
+	pre, post ApplyFunc
+	stopped   bool
+}
+
+// Apply traverses the tree like Walk and returns it, along with the edits made through the cursors.
+// Unless pre is nil, it's called for each node before its children, which are skipped along with the post call
+// if pre returns false. Unless post is nil, it's called for each node after its children, and Apply stops
+// right away if post returns false. The root may be replaced as well, which is why the tree is returned.
+func Apply(root Node, pre, post ApplyFunc) Node {
+	a := &applier{pre: pre, post: post}
+	a.apply(&Cursor{index: -1, node: root, set: func(n Node) { root = n }})
+	return root
+}
+
+func (a *applier) apply(c *Cursor) {
+	if a.pre != nil && !a.pre(c) || c.node == nil {
+		return
+	}
+
+	a.children(c.node)
+	if a.stopped {
+		return
+	}
+
+	if a.post != nil && !a.post(c) {
+		a.stopped = true
+	}
+}
+
+func (a *applier) children(node Node) {
+	switch n := node.(type) {
+	case *Program:
+		applyList(a, n, "Statements", &n.Statements)
+	case *VarDeclaration:
+		if n.Pattern != nil {
+			applyField(a, n, "Pattern", &n.Pattern)
+		}
+		if n.Value != nil {
+			applyField(a, n, "Value", &n.Value)
+		}
+	case *ExpressionStatement:
+		applyField(a, n, "Expression", &n.Expression)
+	case *IfStatement:
+		applyField(a, n, "Condition", &n.Condition)
+		applyField(a, n, "Then", &n.Then)
+		applyList(a, n, "Elif", &n.Elif)
+		if n.Else != nil {
+			applyField(a, n, "Else", &n.Else)
+		}
+	case *ElifStatement:
+		applyField(a, n, "Condition", &n.Condition)
+		applyField(a, n, "Body", &n.Body)
+	case *WhileStatement:
+		applyField(a, n, "Condition", &n.Condition)
+		applyField(a, n, "Body", &n.Body)
+	case *ForStatement:
+		if n.ValuePattern != nil {
+			applyField(a, n, "ValuePattern", &n.ValuePattern)
+		}
+		applyField(a, n, "Object", &n.Object)
+		applyField(a, n, "Body", &n.Body)
+	case *BlockStatement:
+		applyList(a, n, "Statements", &n.Statements)
+	case *ReturnStatement:
+		if n.Value != nil {
+			applyField(a, n, "Value", &n.Value)
+		}
+	case *ObjectLiteral:
+		for _, key := range n.Keys() {
+			if a.stopped {
+				return
+			}
+			a.apply(&Cursor{
+				parent: n,
+				name:   "Properties",
+				key:    key,
+				index:  -1,
+				node:   n.Properties[key],
+				set:    func(value Node) { n.Properties[key] = value.(Expression) },
+				remove: func() { delete(n.Properties, key) },
+			})
+		}
+	case *ArrayLiteral:
+		applyList(a, n, "Elements", &n.Elements)
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			value, ok := n.Defaults[param]
+			if !ok || a.stopped {
+				continue
+			}
+			a.apply(&Cursor{
+				parent: n,
+				name:   "Defaults",
+				key:    param,
+				index:  -1,
+				node:   value,
+				set:    func(value Node) { n.Defaults[param] = value.(Expression) },
+				remove: func() { delete(n.Defaults, param) },
+			})
+		}
+		applyField(a, n, "Body", &n.Body)
+	case *MemberDot:
+		applyField(a, n, "Object", &n.Object)
+	case *MemberBracket:
+		applyField(a, n, "Object", &n.Object)
+		applyField(a, n, "Member", &n.Member)
+	case *FunctionCall:
+		applyField(a, n, "Function", &n.Function)
+		applyList(a, n, "Arguments", &n.Arguments)
+	case *MethodCall:
+		applyField(a, n, "Object", &n.Object)
+		applyList(a, n, "Arguments", &n.Arguments)
+	case *UnaryExpression:
+		applyField(a, n, "Right", &n.Right)
+	case *AwaitExpression:
+		applyField(a, n, "Value", &n.Value)
+	case *BinaryExpression:
+		applyField(a, n, "Left", &n.Left)
+		applyField(a, n, "Right", &n.Right)
+	case *Assignment:
+		applyField(a, n, "Left", &n.Left)
+		applyField(a, n, "Right", &n.Right)
+	case *Pattern:
+		applyList(a, n, "Elements", &n.Elements)
+	case *Tuple:
+		applyList(a, n, "Elements", &n.Elements)
+	case *Spread:
+		applyField(a, n, "Value", &n.Value)
+	case *KeywordArgument:
+		applyField(a, n, "Value", &n.Value)
+	}
+}
+
+func applyField[T Node](a *applier, parent Node, name string, field *T) {
+	if a.stopped {
+		return
+	}
+
+	a.apply(&Cursor{
+		parent: parent,
+		name:   name,
+		index:  -1,
+		node:   *field,
+		set: func(n Node) {
+			if n == nil {
+				var zero T
+				*field = zero
+				return
+			}
+			*field = n.(T)
+		},
+	})
+}
+
+func applyList[T Node](a *applier, parent Node, name string, list *[]T) {
+	next := 0
+	for i := 0; i < len(*list) && !a.stopped; i = next {
+		next = i + 1
+
+		c := &Cursor{parent: parent, name: name, index: i, node: (*list)[i], next: &next}
+		c.set = func(n Node) { (*list)[c.index] = n.(T) }
+		c.remove = func() {
+			*list = slices.Delete(*list, c.index, c.index+1)
+			next--
+		}
+		c.insert = func(index int, n Node) {
+			*list = slices.Insert(*list, index, n.(T))
+		}
+
+		a.apply(c)
+	}
+}
@@ -1,13 +1,13 @@
 package ast
 
 import (
-	"fmt"
 	"strings"
 )
 
-// Node represents a node in the AST
+// Node represents a node in the AST, String returns its source
 type Node interface {
 	Position() Position
+	String() string
 }
 
 // Position represents a position in the source code
@@ -20,16 +20,15 @@ type Position struct {
 type Program struct {
 	Pos        Position
 	Statements []Statement
+
+	// Comments lists every comment of the source in order and Trivia holds the spans and comments
+	// of the nodes, both are only set when parsing with comments
+	Comments []*Comment
+	Trivia   map[Node]*Trivia
 }
 
 func (p *Program) Position() Position { return p.Pos }
-func (p *Program) String() string {
-	var stmts []string
-	for _, stmt := range p.Statements {
-		stmts = append(stmts, stmt.String())
-	}
-	return strings.Join(stmts, "\n")
-}
+func (p *Program) String() string     { return format(p) }
 
 // Statement represents a statement
 type Statement interface {
@@ -45,21 +44,17 @@ type Expression interface {
 	String() string
 }
 
-// VarDeclaration represents a variable declaration
+// VarDeclaration represents a variable declaration, Name is empty when it declares a Pattern
 type VarDeclaration struct {
-	Pos   Position
-	Name  string
-	Value Expression
+	Pos     Position
+	Name    string
+	Pattern *Pattern
+	Value   Expression
 }
 
 func (vd *VarDeclaration) Position() Position { return vd.Pos }
 func (vd *VarDeclaration) statementNode()     {}
-func (vd *VarDeclaration) String() string {
-	if vd.Value != nil {
-		return fmt.Sprintf("var %s = %v", vd.Name, vd.Value)
-	}
-	return fmt.Sprintf("var %s", vd.Name)
-}
+func (vd *VarDeclaration) String() string     { return format(vd) }
 
 // ExpressionStatement represents an expression as a statement
 type ExpressionStatement struct {
@@ -69,7 +64,7 @@ type ExpressionStatement struct {
 
 func (es *ExpressionStatement) Position() Position { return es.Pos }
 func (es *ExpressionStatement) statementNode()     {}
-func (es *ExpressionStatement) String() string     { return es.Expression.String() }
+func (es *ExpressionStatement) String() string     { return format(es) }
 
 // IfStatement represents an if statement
 type IfStatement struct {
@@ -82,16 +77,7 @@ type IfStatement struct {
 
 func (is *IfStatement) Position() Position { return is.Pos }
 func (is *IfStatement) statementNode()     {}
-func (is *IfStatement) String() string {
-	result := fmt.Sprintf("if %v %v", is.Condition, is.Then)
-	for _, elif := range is.Elif {
-		result += fmt.Sprintf(" %v", elif)
-	}
-	if is.Else != nil {
-		result += fmt.Sprintf(" else %v", is.Else)
-	}
-	return result
-}
+func (is *IfStatement) String() string     { return format(is) }
 
 type ElifStatement struct {
 	Pos       Position
@@ -99,9 +85,9 @@ type ElifStatement struct {
 	Body      *BlockStatement
 }
 
-func (es *ElifStatement) String() string {
-	return fmt.Sprintf("elif %v %v", es.Condition, es.Body)
-}
+func (es *ElifStatement) Position() Position { return es.Pos }
+
+func (es *ElifStatement) String() string { return format(es) }
 
 // WhileStatement represents a while statement
 type WhileStatement struct {
@@ -112,27 +98,21 @@ type WhileStatement struct {
 
 func (ws *WhileStatement) Position() Position { return ws.Pos }
 func (ws *WhileStatement) statementNode()     {}
-func (ws *WhileStatement) String() string {
-	return fmt.Sprintf("while %v %v", ws.Condition, ws.Body)
-}
+func (ws *WhileStatement) String() string     { return format(ws) }
 
-// ForStatement represents a for statement
+// ForStatement represents a for statement, ValuePattern destructures each value instead of naming it
 type ForStatement struct {
-	Pos    Position
-	Key    string
-	Value  string
-	Object Expression
-	Body   *BlockStatement
+	Pos          Position
+	Key          string
+	Value        string
+	ValuePattern *Pattern
+	Object       Expression
+	Body         *BlockStatement
 }
 
 func (fs *ForStatement) Position() Position { return fs.Pos }
 func (fs *ForStatement) statementNode()     {}
-func (fs *ForStatement) String() string {
-	if fs.Value != "" {
-		return fmt.Sprintf("for %s, %s in %v %v", fs.Key, fs.Value, fs.Object, fs.Body)
-	}
-	return fmt.Sprintf("for %s in %v %v", fs.Key, fs.Object, fs.Body)
-}
+func (fs *ForStatement) String() string     { return format(fs) }
 
 // BlockStatement represents a block of statements
 type BlockStatement struct {
@@ -142,13 +122,7 @@ type BlockStatement struct {
 
 func (bs *BlockStatement) Position() Position { return bs.Pos }
 func (bs *BlockStatement) statementNode()     {}
-func (bs *BlockStatement) String() string {
-	var stmts []string
-	for _, stmt := range bs.Statements {
-		stmts = append(stmts, stmt.String())
-	}
-	return fmt.Sprintf("{\n%s\n}", strings.Join(stmts, "\n"))
-}
+func (bs *BlockStatement) String() string     { return format(bs) }
 
 // BreakStatement represents a break statement
 type BreakStatement struct {
@@ -157,7 +131,7 @@ type BreakStatement struct {
 
 func (bs *BreakStatement) Position() Position { return bs.Pos }
 func (bs *BreakStatement) statementNode()     {}
-func (bs *BreakStatement) String() string     { return "break" }
+func (bs *BreakStatement) String() string     { return format(bs) }
 
 // ContinueStatement represents a continue statement
 type ContinueStatement struct {
@@ -166,7 +140,7 @@ type ContinueStatement struct {
 
 func (cs *ContinueStatement) Position() Position { return cs.Pos }
 func (cs *ContinueStatement) statementNode()     {}
-func (cs *ContinueStatement) String() string     { return "continue" }
+func (cs *ContinueStatement) String() string     { return format(cs) }
 
 // ReturnStatement represents a return statement
 type ReturnStatement struct {
@@ -176,12 +150,7 @@ type ReturnStatement struct {
 
 func (rs *ReturnStatement) Position() Position { return rs.Pos }
 func (rs *ReturnStatement) statementNode()     {}
-func (rs *ReturnStatement) String() string {
-	if rs.Value != nil {
-		return fmt.Sprintf("return %v", rs.Value)
-	}
-	return "return"
-}
+func (rs *ReturnStatement) String() string     { return format(rs) }
 
 // Identifier represents an identifier
 type Identifier struct {
@@ -191,7 +160,7 @@ type Identifier struct {
 
 func (i *Identifier) Position() Position { return i.Pos }
 func (i *Identifier) expressionNode()    {}
-func (i *Identifier) String() string     { return i.Name }
+func (i *Identifier) String() string     { return format(i) }
 
 // NumberLiteral represents a number literal
 type NumberLiteral struct {
@@ -201,7 +170,7 @@ type NumberLiteral struct {
 
 func (nl *NumberLiteral) Position() Position { return nl.Pos }
 func (nl *NumberLiteral) expressionNode()    {}
-func (nl *NumberLiteral) String() string     { return fmt.Sprintf("%g", nl.Value) }
+func (nl *NumberLiteral) String() string     { return format(nl) }
 
 // StringLiteral represents a string literal
 type StringLiteral struct {
@@ -211,7 +180,7 @@ type StringLiteral struct {
 
 func (sl *StringLiteral) Position() Position { return sl.Pos }
 func (sl *StringLiteral) expressionNode()    {}
-func (sl *StringLiteral) String() string     { return fmt.Sprintf("%q", sl.Value) }
+func (sl *StringLiteral) String() string     { return format(sl) }
 
 // RawStringLiteral represents a raw string literal
 type RawStringLiteral struct {
@@ -221,7 +190,7 @@ type RawStringLiteral struct {
 
 func (rsl *RawStringLiteral) Position() Position { return rsl.Pos }
 func (rsl *RawStringLiteral) expressionNode()    {}
-func (rsl *RawStringLiteral) String() string     { return fmt.Sprintf("`%s`", rsl.Value) }
+func (rsl *RawStringLiteral) String() string     { return format(rsl) }
 
 // NilLiteral represents a nil literal
 type NilLiteral struct {
@@ -230,7 +199,7 @@ type NilLiteral struct {
 
 func (nl *NilLiteral) Position() Position { return nl.Pos }
 func (nl *NilLiteral) expressionNode()    {}
-func (nl *NilLiteral) String() string     { return "nil" }
+func (nl *NilLiteral) String() string     { return format(nl) }
 
 // ObjectLiteral represents an object literal
 type ObjectLiteral struct {
@@ -240,16 +209,7 @@ type ObjectLiteral struct {
 
 func (ol *ObjectLiteral) Position() Position { return ol.Pos }
 func (ol *ObjectLiteral) expressionNode()    {}
-func (ol *ObjectLiteral) String() string {
-	if len(ol.Properties) == 0 {
-		return "{}"
-	}
-	var props []string
-	for key, value := range ol.Properties {
-		props = append(props, fmt.Sprintf("%s: %v", key, value))
-	}
-	return fmt.Sprintf("{ %s }", strings.Join(props, ", "))
-}
+func (ol *ObjectLiteral) String() string     { return format(ol) }
 
 // ArrayLiteral represents an array literal
 type ArrayLiteral struct {
@@ -259,27 +219,21 @@ type ArrayLiteral struct {
 
 func (al *ArrayLiteral) Position() Position { return al.Pos }
 func (al *ArrayLiteral) expressionNode()    {}
-func (al *ArrayLiteral) String() string {
-	var elems []string
-	for _, elem := range al.Elements {
-		elems = append(elems, elem.String())
-	}
-	return fmt.Sprintf("[%s]", strings.Join(elems, ", "))
-}
+func (al *ArrayLiteral) String() string     { return format(al) }
 
-// FunctionLiteral represents a function literal
+// FunctionLiteral represents a function literal. Defaults holds the default values of the parameters
+// having one and Rest names the parameter collecting the extra arguments, it isn't part of Parameters.
 type FunctionLiteral struct {
 	Pos        Position
 	Parameters []string
+	Defaults   map[string]Expression
+	Rest       string
 	Body       *BlockStatement
 }
 
 func (fl *FunctionLiteral) Position() Position { return fl.Pos }
 func (fl *FunctionLiteral) expressionNode()    {}
-func (fl *FunctionLiteral) String() string {
-	params := strings.Join(fl.Parameters, ", ")
-	return fmt.Sprintf("fun(%s) %v", params, fl.Body)
-}
+func (fl *FunctionLiteral) String() string     { return format(fl) }
 
 // MemberDot represents a member access using dot notation
 type MemberDot struct {
@@ -290,7 +244,7 @@ type MemberDot struct {
 
 func (md *MemberDot) Position() Position { return md.Pos }
 func (md *MemberDot) expressionNode()    {}
-func (md *MemberDot) String() string     { return fmt.Sprintf("%v.%s", md.Object, md.Member) }
+func (md *MemberDot) String() string     { return format(md) }
 
 // MemberBracket represents a member access using bracket notation
 type MemberBracket struct {
@@ -301,7 +255,7 @@ type MemberBracket struct {
 
 func (mb *MemberBracket) Position() Position { return mb.Pos }
 func (mb *MemberBracket) expressionNode()    {}
-func (mb *MemberBracket) String() string     { return fmt.Sprintf("%v[%v]", mb.Object, mb.Member) }
+func (mb *MemberBracket) String() string     { return format(mb) }
 
 // FunctionCall represents a function call
 type FunctionCall struct {
@@ -312,9 +266,7 @@ type FunctionCall struct {
 
 func (fc *FunctionCall) Position() Position { return fc.Pos }
 func (fc *FunctionCall) expressionNode()    {}
-func (fc *FunctionCall) String() string {
-	return fmt.Sprintf("%v(%s)", fc.Function, fc.FormatArgs())
-}
+func (fc *FunctionCall) String() string     { return format(fc) }
 func (fc *FunctionCall) FormatArgs() string {
 	var args []string
 	for _, arg := range fc.Arguments {
@@ -333,9 +285,7 @@ type MethodCall struct {
 
 func (mc *MethodCall) Position() Position { return mc.Pos }
 func (mc *MethodCall) expressionNode()    {}
-func (mc *MethodCall) String() string {
-	return fmt.Sprintf("%v:%s(%s)", mc.Object, mc.Method, mc.FormatArgs())
-}
+func (mc *MethodCall) String() string     { return format(mc) }
 func (mc *MethodCall) FormatArgs() string {
 	var args []string
 	for _, arg := range mc.Arguments {
@@ -353,7 +303,17 @@ type UnaryExpression struct {
 
 func (ue *UnaryExpression) Position() Position { return ue.Pos }
 func (ue *UnaryExpression) expressionNode()    {}
-func (ue *UnaryExpression) String() string     { return fmt.Sprintf("(%s%v)", ue.Operator, ue.Right) }
+func (ue *UnaryExpression) String() string     { return format(ue) }
+
+// AwaitExpression represents an await expression
+type AwaitExpression struct {
+	Pos   Position
+	Value Expression
+}
+
+func (ae *AwaitExpression) Position() Position { return ae.Pos }
+func (ae *AwaitExpression) expressionNode()    {}
+func (ae *AwaitExpression) String() string     { return format(ae) }
 
 // BinaryExpression represents a binary expression
 type BinaryExpression struct {
@@ -365,9 +325,7 @@ type BinaryExpression struct {
 
 func (be *BinaryExpression) Position() Position { return be.Pos }
 func (be *BinaryExpression) expressionNode()    {}
-func (be *BinaryExpression) String() string {
-	return fmt.Sprintf("(%v %s %v)", be.Left, be.Operator, be.Right)
-}
+func (be *BinaryExpression) String() string     { return format(be) }
 
 // Assignment represents an assignment expression
 type Assignment struct {
@@ -378,4 +336,47 @@ type Assignment struct {
 
 func (a *Assignment) Position() Position { return a.Pos }
 func (a *Assignment) expressionNode()    {}
-func (a *Assignment) String() string     { return fmt.Sprintf("%v = %v", a.Left, a.Right) }
+func (a *Assignment) String() string     { return format(a) }
+
+// Pattern represents the targets of a destructuring declaration or assignment, `a, b` takes the values
+// by position and `{a, b}` by name. Only assignments allow targets other than identifiers.
+type Pattern struct {
+	Pos      Position
+	Elements []Expression
+	Braces   bool
+}
+
+func (pt *Pattern) Position() Position { return pt.Pos }
+func (pt *Pattern) expressionNode()    {}
+func (pt *Pattern) String() string     { return format(pt) }
+
+// Tuple represents a list of values such as `return a, b`, it evaluates to an array
+type Tuple struct {
+	Pos      Position
+	Elements []Expression
+}
+
+func (t *Tuple) Position() Position { return t.Pos }
+func (t *Tuple) expressionNode()    {}
+func (t *Tuple) String() string     { return format(t) }
+
+// Spread represents `...value` in arguments, passing the elements of an array as separate arguments
+type Spread struct {
+	Pos   Position
+	Value Expression
+}
+
+func (s *Spread) Position() Position { return s.Pos }
+func (s *Spread) expressionNode()    {}
+func (s *Spread) String() string     { return format(s) }
+
+// KeywordArgument represents `name: value` in arguments, passing the value to the parameter of that name
+type KeywordArgument struct {
+	Pos   Position
+	Name  string
+	Value Expression
+}
+
+func (ka *KeywordArgument) Position() Position { return ka.Pos }
+func (ka *KeywordArgument) expressionNode()    {}
+func (ka *KeywordArgument) String() string     { return format(ka) }
@@ -0,0 +1,229 @@
+package ast_test
+
+import (
+	"refl/ast"
+	"refl/parser"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, source string) *ast.Program {
+	program, err := parser.New().Parse(source)
+	require.NoError(t, err)
+	return program
+}
+
+const roundTripSource = `var point = {x: 1, "y z": 2.5, "if": "a\"b\\c\nd"}
+var items = {1, {2, 3}, (point:len()), ` + "`raw\n  text`" + `}
+var f = fun(a, b) {
+  if a > b && !(a == 0) {
+    return -a
+  } elif a == b {
+    return
+  } else {
+    for k, v in items {
+      total = total + v
+      continue
+    }
+  }
+  while 1 {
+    break
+  }
+  (x = 1).y
+  return (await point.fetch(a))[b](1, nil)
+}
+a = b = 1234567890123
+{}
+`
+
+func TestString(t *testing.T) {
+	program := parse(t, roundTripSource)
+	printed := program.String()
+
+	reparsed := parse(t, printed)
+	require.True(t, ast.Equal(program, reparsed), printed)
+	require.Equal(t, printed, reparsed.String())
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"{1, 2}", "{1, 2}"},
+		{"{b: 1, a: {c: 2}}", "{b: 1, a: {c: 2}}"},
+		{`{"a b": 1, "nil": 2}`, `{"a b": 1, "nil": 2}`},
+		{"{a:b()}", "{a: b()}"},
+		{"{(a:b())}", "{(a:b())}"},
+		{"0.1 + 1234567", "(0.1 + 1234567)"},
+		{`"tab\t\"quote\""`, `"tab\t\"quote\""`},
+		{"fun() {}", "fun() {}"},
+		{"fun(x) { return x }", "fun(x) {\n  return x\n}"},
+		{"f(x = 1)", "f(x = 1)"},
+		{"-(a = 1)", "(-(a = 1))"},
+		{"var {x,y} = p", "var {x, y} = p"},
+		{"a,b = b,a+1", "a, b = b, (a + 1)"},
+		{"for i, {x} in xs {}", "for i, {x} in xs {}"},
+		{"fun(a, b=a, ...c) {}", "fun(a, b = a, ...c) {}"},
+		{"f(...xs, k: (g()).x, m: (n = 1))", "f(...xs, k: (g().x), m: (n = 1))"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program := parse(t, tt.input)
+			require.Equal(t, tt.expected, program.String())
+			require.True(t, ast.Equal(program, parse(t, tt.expected)))
+		})
+	}
+}
+
+func TestEqual(t *testing.T) {
+	tests := []struct {
+		a, b  string
+		equal bool
+	}{
+		{"x + 1", "x   +   1", true},
+		{"x + 1", "x - 1", false},
+		{"{a: 1, b: 2}", "{b: 2, a: 1}", true},
+		{"{a: 1, b: 2}", "{a: 1, b: 3}", false},
+		{"{1, 2}", "{2, 1}", false},
+		{"if x {} else {}", "if x {}", false},
+		{"f(1)", "f(1, 2)", false},
+		{"`a`", `"a"`, false},
+		{"var {a, b} = x", "var a, b = x", false},
+		{"fun(a = 1) {}", "fun(a) {}", false},
+		{"f(a: 1)", "f(b: 1)", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.a+" vs "+tt.b, func(t *testing.T) {
+			require.Equal(t, tt.equal, ast.Equal(parse(t, tt.a), parse(t, tt.b)))
+		})
+	}
+
+	require.True(t, ast.Equal(nil, (*ast.BlockStatement)(nil)))
+	require.False(t, ast.Equal(nil, &ast.NilLiteral{}))
+}
+
+type counter struct {
+	entered, left int
+}
+
+func (c *counter) Visit(node ast.Node) ast.Visitor {
+	if node == nil {
+		c.left++
+		return nil
+	}
+	c.entered++
+	// function bodies are skipped
+	if _, ok := node.(*ast.FunctionLiteral); ok {
+		return nil
+	}
+	return c
+}
+
+func TestWalk(t *testing.T) {
+	program := parse(t, "var f = fun(a) { return a }\nf({b: 1, a: 2})\n")
+
+	c := &counter{}
+	ast.Walk(c, program)
+	// program, var, function, expression statement, call, f, object, 1, 2
+	require.Equal(t, 9, c.entered)
+	require.Equal(t, 8, c.left)
+
+	var names []string
+	ast.Inspect(program, func(node ast.Node) bool {
+		switch n := node.(type) {
+		case *ast.Identifier:
+			names = append(names, n.Name)
+		case *ast.NumberLiteral:
+			names = append(names, n.String())
+		}
+		return true
+	})
+	require.Equal(t, []string{"a", "f", "1", "2"}, names)
+}
+
+func TestApply(t *testing.T) {
+	t.Run("cursor", func(t *testing.T) {
+		program := parse(t, "f(1, {k: 2})\n")
+
+		var visited []string
+		ast.Apply(program, func(c *ast.Cursor) bool {
+			if _, ok := c.Node().(*ast.NumberLiteral); ok {
+				visited = append(visited, c.Name(), c.Key(), c.Node().String())
+				require.NotNil(t, c.Parent())
+				if c.Index() >= 0 {
+					visited = append(visited, "index")
+				}
+			}
+			return true
+		}, nil)
+		require.Equal(t, []string{"Arguments", "", "1", "index", "Properties", "k", "2"}, visited)
+	})
+
+	t.Run("rewrite", func(t *testing.T) {
+		program := parse(t, "var x = 1 + 2\nio.println(x)\ndebug(x)\nvar y = {a: 1, b: debug}\n")
+
+		result := ast.Apply(program, func(c *ast.Cursor) bool {
+			switch n := c.Node().(type) {
+			case *ast.ExpressionStatement:
+				if call, ok := n.Expression.(*ast.FunctionCall); ok && call.Function.String() == "debug" {
+					c.Delete()
+				}
+			case *ast.VarDeclaration:
+				c.InsertAfter(&ast.ExpressionStatement{Expression: &ast.Identifier{Name: n.Name}})
+			case *ast.Identifier:
+				if n.Name == "debug" && c.Key() != "" {
+					c.Delete()
+				}
+			}
+			return true
+		}, func(c *ast.Cursor) bool {
+			// folds the additions of numbers once their operands are visited
+			if bin, ok := c.Node().(*ast.BinaryExpression); ok && bin.Operator == "+" {
+				left, lok := bin.Left.(*ast.NumberLiteral)
+				right, rok := bin.Right.(*ast.NumberLiteral)
+				if lok && rok {
+					c.Replace(&ast.NumberLiteral{Pos: bin.Pos, Value: left.Value + right.Value})
+				}
+			}
+			return true
+		})
+
+		require.Same(t, program, result)
+		require.Equal(t, "var x = 3\nx\nio.println(x)\nvar y = {a: 1}\ny", program.String())
+	})
+
+	t.Run("replace root and stop", func(t *testing.T) {
+		program := parse(t, "a\nb\nc\n")
+
+		var seen []string
+		result := ast.Apply(program, nil, func(c *ast.Cursor) bool {
+			if ident, ok := c.Node().(*ast.Identifier); ok {
+				seen = append(seen, ident.Name)
+				return ident.Name != "b"
+			}
+			return true
+		})
+		require.Equal(t, []string{"a", "b"}, seen)
+		require.Same(t, program, result)
+
+		result = ast.Apply(program, func(c *ast.Cursor) bool {
+			c.Replace(&ast.NilLiteral{})
+			return false
+		}, nil)
+		require.Equal(t, "nil", result.String())
+	})
+
+	t.Run("wrong type", func(t *testing.T) {
+		program := parse(t, "x\n")
+		require.Panics(t, func() {
+			ast.Apply(program, func(c *ast.Cursor) bool {
+				if _, ok := c.Node().(*ast.ExpressionStatement); ok {
+					c.Replace(&ast.Identifier{Name: "y"})
+				}
+				return true
+			}, nil)
+		})
+	})
+}
@@ -0,0 +1,148 @@
+package ast
+
+import "slices"
+
+// Equal reports whether two trees have the same structure and values, ignoring positions.
+// Nil nodes only equal nil nodes, including typed nil pointers such as a missing else block.
+func Equal(a, b Node) bool {
+	if isNil(a) || isNil(b) {
+		return isNil(a) && isNil(b)
+	}
+
+	switch x := a.(type) {
+	case *Program:
+		y, ok := b.(*Program)
+		return ok && equalList(x.Statements, y.Statements)
+	case *VarDeclaration:
+		y, ok := b.(*VarDeclaration)
+		return ok && x.Name == y.Name && Equal(x.Pattern, y.Pattern) && Equal(x.Value, y.Value)
+	case *ExpressionStatement:
+		y, ok := b.(*ExpressionStatement)
+		return ok && Equal(x.Expression, y.Expression)
+	case *IfStatement:
+		y, ok := b.(*IfStatement)
+		return ok && Equal(x.Condition, y.Condition) && Equal(x.Then, y.Then) &&
+			equalList(x.Elif, y.Elif) && Equal(x.Else, y.Else)
+	case *ElifStatement:
+		y, ok := b.(*ElifStatement)
+		return ok && Equal(x.Condition, y.Condition) && Equal(x.Body, y.Body)
+	case *WhileStatement:
+		y, ok := b.(*WhileStatement)
+		return ok && Equal(x.Condition, y.Condition) && Equal(x.Body, y.Body)
+	case *ForStatement:
+		y, ok := b.(*ForStatement)
+		return ok && x.Key == y.Key && x.Value == y.Value && Equal(x.ValuePattern, y.ValuePattern) &&
+			Equal(x.Object, y.Object) && Equal(x.Body, y.Body)
+	case *BlockStatement:
+		y, ok := b.(*BlockStatement)
+		return ok && equalList(x.Statements, y.Statements)
+	case *BreakStatement:
+		_, ok := b.(*BreakStatement)
+		return ok
+	case *ContinueStatement:
+		_, ok := b.(*ContinueStatement)
+		return ok
+	case *ReturnStatement:
+		y, ok := b.(*ReturnStatement)
+		return ok && Equal(x.Value, y.Value)
+	case *Identifier:
+		y, ok := b.(*Identifier)
+		return ok && x.Name == y.Name
+	case *NumberLiteral:
+		y, ok := b.(*NumberLiteral)
+		return ok && x.Value == y.Value
+	case *StringLiteral:
+		y, ok := b.(*StringLiteral)
+		return ok && x.Value == y.Value
+	case *RawStringLiteral:
+		y, ok := b.(*RawStringLiteral)
+		return ok && x.Value == y.Value
+	case *NilLiteral:
+		_, ok := b.(*NilLiteral)
+		return ok
+	case *ObjectLiteral:
+		y, ok := b.(*ObjectLiteral)
+		return ok && equalMap(x.Properties, y.Properties)
+	case *ArrayLiteral:
+		y, ok := b.(*ArrayLiteral)
+		return ok && equalList(x.Elements, y.Elements)
+	case *FunctionLiteral:
+		y, ok := b.(*FunctionLiteral)
+		return ok && slices.Equal(x.Parameters, y.Parameters) && x.Rest == y.Rest &&
+			equalMap(x.Defaults, y.Defaults) && Equal(x.Body, y.Body)
+	case *MemberDot:
+		y, ok := b.(*MemberDot)
+		return ok && x.Member == y.Member && Equal(x.Object, y.Object)
+	case *MemberBracket:
+		y, ok := b.(*MemberBracket)
+		return ok && Equal(x.Object, y.Object) && Equal(x.Member, y.Member)
+	case *FunctionCall:
+		y, ok := b.(*FunctionCall)
+		return ok && Equal(x.Function, y.Function) && equalList(x.Arguments, y.Arguments)
+	case *MethodCall:
+		y, ok := b.(*MethodCall)
+		return ok && x.Method == y.Method && Equal(x.Object, y.Object) && equalList(x.Arguments, y.Arguments)
+	case *UnaryExpression:
+		y, ok := b.(*UnaryExpression)
+		return ok && x.Operator == y.Operator && Equal(x.Right, y.Right)
+	case *AwaitExpression:
+		y, ok := b.(*AwaitExpression)
+		return ok && Equal(x.Value, y.Value)
+	case *BinaryExpression:
+		y, ok := b.(*BinaryExpression)
+		return ok && x.Operator == y.Operator && Equal(x.Left, y.Left) && Equal(x.Right, y.Right)
+	case *Assignment:
+		y, ok := b.(*Assignment)
+		return ok && Equal(x.Left, y.Left) && Equal(x.Right, y.Right)
+	case *Pattern:
+		y, ok := b.(*Pattern)
+		return ok && x.Braces == y.Braces && equalList(x.Elements, y.Elements)
+	case *Tuple:
+		y, ok := b.(*Tuple)
+		return ok && equalList(x.Elements, y.Elements)
+	case *Spread:
+		y, ok := b.(*Spread)
+		return ok && Equal(x.Value, y.Value)
+	case *KeywordArgument:
+		y, ok := b.(*KeywordArgument)
+		return ok && x.Name == y.Name && Equal(x.Value, y.Value)
+	}
+
+	return false
+}
+
+func equalList[T Node](a, b []T) bool {
+	return slices.EqualFunc(a, b, func(x, y T) bool { return Equal(x, y) })
+}
+
+func equalMap(a, b map[string]Expression) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for key, value := range a {
+		other, ok := b[key]
+		if !ok || !Equal(value, other) {
+			return false
+		}
+	}
+	return true
+}
+
+// isNil reports whether the node is nil or a typed nil pointer
+func isNil(node Node) bool {
+	if node == nil {
+		return true
+	}
+
+	switch n := node.(type) {
+	case *BlockStatement:
+		return n == nil
+	case *ElifStatement:
+		return n == nil
+	case *Program:
+		return n == nil
+	case *Pattern:
+		return n == nil
+	}
+	return false
+}
@@ -0,0 +1,350 @@
+package ast
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// keywords can't be object literal keys without quotes
+var keywords = map[string]bool{
+	"var": true, "if": true, "elif": true, "else": true, "while": true, "for": true, "in": true,
+	"break": true, "continue": true, "return": true, "fun": true, "nil": true, "await": true,
+}
+
+// printer renders nodes as refl source which parses back to an equal tree. Blocks are indented
+// by two spaces per level, binary and unary expressions are fully parenthesized.
+type printer struct {
+	strings.Builder
+	depth int
+}
+
+func format(node Node) string {
+	var p printer
+	p.node(node)
+	return p.String()
+}
+
+func (p *printer) newline() {
+	p.WriteString("\n")
+	p.WriteString(strings.Repeat("  ", p.depth))
+}
+
+func (p *printer) node(node Node) {
+	switch n := node.(type) {
+	case *Program:
+		for i, stmt := range n.Statements {
+			if i > 0 {
+				p.WriteString("\n")
+			}
+			p.node(stmt)
+		}
+	case *VarDeclaration:
+		p.WriteString("var ")
+		if n.Pattern != nil {
+			p.node(n.Pattern)
+		} else {
+			p.WriteString(n.Name)
+		}
+		if n.Value != nil {
+			p.WriteString(" = ")
+			p.node(n.Value)
+		}
+	case *ExpressionStatement:
+		p.node(n.Expression)
+	case *IfStatement:
+		p.WriteString("if ")
+		p.node(n.Condition)
+		p.WriteString(" ")
+		p.node(n.Then)
+		for _, elif := range n.Elif {
+			p.WriteString(" ")
+			p.node(elif)
+		}
+		if n.Else != nil {
+			p.WriteString(" else ")
+			p.node(n.Else)
+		}
+	case *ElifStatement:
+		p.WriteString("elif ")
+		p.node(n.Condition)
+		p.WriteString(" ")
+		p.node(n.Body)
+	case *WhileStatement:
+		p.WriteString("while ")
+		p.node(n.Condition)
+		p.WriteString(" ")
+		p.node(n.Body)
+	case *ForStatement:
+		p.WriteString("for ")
+		p.WriteString(n.Key)
+		if n.ValuePattern != nil {
+			p.WriteString(", ")
+			p.node(n.ValuePattern)
+		} else if n.Value != "" {
+			p.WriteString(", ")
+			p.WriteString(n.Value)
+		}
+		p.WriteString(" in ")
+		p.node(n.Object)
+		p.WriteString(" ")
+		p.node(n.Body)
+	case *BlockStatement:
+		if len(n.Statements) == 0 {
+			p.WriteString("{}")
+			return
+		}
+		p.WriteString("{")
+		p.depth++
+		for _, stmt := range n.Statements {
+			p.newline()
+			p.node(stmt)
+		}
+		p.depth--
+		p.newline()
+		p.WriteString("}")
+	case *BreakStatement:
+		p.WriteString("break")
+	case *ContinueStatement:
+		p.WriteString("continue")
+	case *ReturnStatement:
+		p.WriteString("return")
+		if n.Value != nil {
+			p.WriteString(" ")
+			p.node(n.Value)
+		}
+	case *Identifier:
+		p.WriteString(n.Name)
+	case *NumberLiteral:
+		p.WriteString(strconv.FormatFloat(n.Value, 'f', -1, 64))
+	case *StringLiteral:
+		p.WriteString(quote(n.Value))
+	case *RawStringLiteral:
+		p.WriteString("`" + n.Value + "`")
+	case *NilLiteral:
+		p.WriteString("nil")
+	case *ObjectLiteral:
+		if len(n.Properties) == 0 {
+			p.WriteString("{}")
+			return
+		}
+		p.WriteString("{")
+		for i, key := range n.Keys() {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			if isIdentifier(key) && !keywords[key] {
+				p.WriteString(key)
+			} else {
+				p.WriteString(quote(key))
+			}
+			p.WriteString(": ")
+			p.node(n.Properties[key])
+		}
+		p.WriteString("}")
+	case *ArrayLiteral:
+		p.WriteString("{")
+		for i, elem := range n.Elements {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			// `{a:b()}` would be an object, the parentheses keep it an array
+			if mc, ok := elem.(*MethodCall); ok && i == 0 && isKey(mc.Object) {
+				p.WriteString("(")
+				p.node(elem)
+				p.WriteString(")")
+				continue
+			}
+			p.node(elem)
+		}
+		p.WriteString("}")
+	case *FunctionLiteral:
+		p.WriteString("fun(")
+		for i, param := range n.Params() {
+			if i > 0 {
+				p.WriteString(", ")
+			}
+			p.WriteString(param)
+		}
+		p.WriteString(") ")
+		p.node(n.Body)
+	case *MemberDot:
+		p.operand(n.Object)
+		p.WriteString(".")
+		p.WriteString(n.Member)
+	case *MemberBracket:
+		p.operand(n.Object)
+		p.WriteString("[")
+		p.node(n.Member)
+		p.WriteString("]")
+	case *FunctionCall:
+		p.operand(n.Function)
+		p.arguments(n.Arguments)
+	case *MethodCall:
+		p.operand(n.Object)
+		p.WriteString(":")
+		p.WriteString(n.Method)
+		p.arguments(n.Arguments)
+	case *UnaryExpression:
+		p.WriteString("(")
+		p.WriteString(n.Operator)
+		p.operand(n.Right)
+		p.WriteString(")")
+	case *AwaitExpression:
+		p.WriteString("(await ")
+		p.operand(n.Value)
+		p.WriteString(")")
+	case *BinaryExpression:
+		p.WriteString("(")
+		p.operand(n.Left)
+		p.WriteString(" ")
+		p.WriteString(n.Operator)
+		p.WriteString(" ")
+		p.operand(n.Right)
+		p.WriteString(")")
+	case *Assignment:
+		p.node(n.Left)
+		p.WriteString(" = ")
+		p.operand(n.Right)
+	case *Pattern:
+		if n.Braces {
+			p.WriteString("{")
+		}
+		p.list(n.Elements)
+		if n.Braces {
+			p.WriteString("}")
+		}
+	case *Tuple:
+		p.list(n.Elements)
+	case *Spread:
+		p.WriteString("...")
+		p.operand(n.Value)
+	case *KeywordArgument:
+		p.WriteString(n.Name)
+		p.WriteString(": ")
+		// `f(a: b())` would call the method b of a, the parentheses keep it a keyword argument
+		value := format(n.Value)
+		if _, ok := n.Value.(*Assignment); ok || startsWithCall(value) {
+			value = "(" + value + ")"
+		}
+		p.WriteString(value)
+	}
+}
+
+// operand prints an expression used as an operand, assignments bind the loosest and need parentheses
+func (p *printer) operand(expr Expression) {
+	if _, ok := expr.(*Assignment); ok {
+		p.WriteString("(")
+		p.node(expr)
+		p.WriteString(")")
+		return
+	}
+	p.node(expr)
+}
+
+func (p *printer) arguments(args []Expression) {
+	p.WriteString("(")
+	p.list(args)
+	p.WriteString(")")
+}
+
+func (p *printer) list(exprs []Expression) {
+	for i, expr := range exprs {
+		if i > 0 {
+			p.WriteString(", ")
+		}
+		p.node(expr)
+	}
+}
+
+// quote returns a string literal, escaping only what refl strings can escape
+func quote(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '"':
+			b.WriteString(`\"`)
+		case '\\':
+			b.WriteString(`\\`)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
+
+func isIdentifier(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		ch := s[i]
+		letter := ch == '_' || ch == '$' || ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z'
+		if !letter && (i == 0 || ch < '0' || ch > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// startsWithCall reports whether the source starts with a call of an identifier, such as `f(x).y`
+func startsWithCall(source string) bool {
+	end := 0
+	for end < len(source) && isIdentifier(source[:end+1]) {
+		end++
+	}
+	return end > 0 && end < len(source) && source[end] == '('
+}
+
+// Params returns the parameters as written in the source, with their default values and the rest parameter
+func (fl *FunctionLiteral) Params() []string {
+	var params []string
+	for _, param := range fl.Parameters {
+		if value, ok := fl.Defaults[param]; ok {
+			param += " = " + format(value)
+		}
+		params = append(params, param)
+	}
+	if fl.Rest != "" {
+		params = append(params, "..."+fl.Rest)
+	}
+	return params
+}
+
+// isKey reports whether the expression could be read as an object literal key
+func isKey(expr Expression) bool {
+	switch expr.(type) {
+	case *Identifier, *StringLiteral:
+		return true
+	}
+	return false
+}
+
+// Keys returns the property names in source order, properties without positions come last by name
+func (ol *ObjectLiteral) Keys() []string {
+	keys := make([]string, 0, len(ol.Properties))
+	for key := range ol.Properties {
+		keys = append(keys, key)
+	}
+
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := ol.Properties[keys[i]].Position(), ol.Properties[keys[j]].Position()
+		if a != b {
+			if a == (Position{}) || b == (Position{}) {
+				return b == (Position{})
+			}
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		}
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
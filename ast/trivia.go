@@ -0,0 +1,65 @@
+package ast
+
+import (
+	"slices"
+	"strings"
+)
+
+// Span is a range of the source code in byte offsets, End is exclusive
+type Span struct {
+	Start int
+	End   int
+}
+
+// Comment is a `#` comment, Text includes the `#` but not the line break
+type Comment struct {
+	Pos  Position
+	Span Span
+	Text string
+}
+
+// Trivia is what a parse with comments records about a node: its exact span in the source
+// and the comments attached to it
+type Trivia struct {
+	Span Span
+	// Leading are the comments on the lines right before a statement or an object literal property,
+	// the latter are attached to the property value
+	Leading []*Comment
+	// Trailing are the comments after a statement on its last line, along with the comments
+	// inside a node or at the end of a block or program which precede no statement
+	Trailing []*Comment
+}
+
+// TriviaOf returns the trivia of a node of the program, or nil if the program was parsed without comments
+func (p *Program) TriviaOf(node Node) *Trivia {
+	if p.Trivia == nil {
+		return nil
+	}
+	return p.Trivia[node]
+}
+
+// Doc returns the text of the `##` doc comment leading a node: the consecutive `##` lines
+// right before it, without the markers. Documented nodes are variable declarations and
+// object literal property values.
+func (t *Trivia) Doc() string {
+	if t == nil {
+		return ""
+	}
+
+	var lines []string
+	for i := len(t.Leading) - 1; i >= 0; i-- {
+		comment := t.Leading[i]
+		if !strings.HasPrefix(comment.Text, "##") {
+			break
+		}
+		if i < len(t.Leading)-1 && t.Leading[i+1].Pos.Line != comment.Pos.Line+1 {
+			break
+		}
+
+		line := strings.TrimPrefix(comment.Text, "##")
+		lines = append(lines, strings.TrimPrefix(line, " "))
+	}
+
+	slices.Reverse(lines)
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
@@ -0,0 +1,138 @@
+package ast
+
+// Visitor's Visit method is called for every node found by Walk. If the returned visitor w is not nil,
+// Walk visits each child of the node with w, followed by a call of w.Visit(nil).
+type Visitor interface {
+	Visit(node Node) (w Visitor)
+}
+
+// Walk traverses the tree in source order, depth first: it calls v.Visit(node), then walks
+// the children of the node with the returned visitor unless it's nil.
+// Object literal properties are walked in source order, as given by ObjectLiteral.Keys.
+func Walk(v Visitor, node Node) {
+	if v = v.Visit(node); v == nil {
+		return
+	}
+
+	for _, child := range Children(node) {
+		Walk(v, child)
+	}
+
+	v.Visit(nil)
+}
+
+type inspector func(Node) bool
+
+func (f inspector) Visit(node Node) Visitor {
+	if f(node) {
+		return f
+	}
+	return nil
+}
+
+// Inspect traverses the tree in source order, calling f for every node. The children of a node are
+// only inspected if f returns true for it, after them f is called with nil.
+func Inspect(node Node, f func(Node) bool) {
+	Walk(inspector(f), node)
+}
+
+// Children returns the direct children of the node in source order, leaving out missing optional ones
+// such as the value of a bare return
+func Children(node Node) []Node {
+	var children []Node
+	add := func(nodes ...Node) {
+		children = append(children, nodes...)
+	}
+
+	switch n := node.(type) {
+	case *Program:
+		for _, stmt := range n.Statements {
+			add(stmt)
+		}
+	case *VarDeclaration:
+		if n.Pattern != nil {
+			add(n.Pattern)
+		}
+		if n.Value != nil {
+			add(n.Value)
+		}
+	case *ExpressionStatement:
+		add(n.Expression)
+	case *IfStatement:
+		add(n.Condition, n.Then)
+		for _, elif := range n.Elif {
+			add(elif)
+		}
+		if n.Else != nil {
+			add(n.Else)
+		}
+	case *ElifStatement:
+		add(n.Condition, n.Body)
+	case *WhileStatement:
+		add(n.Condition, n.Body)
+	case *ForStatement:
+		if n.ValuePattern != nil {
+			add(n.ValuePattern)
+		}
+		add(n.Object, n.Body)
+	case *BlockStatement:
+		for _, stmt := range n.Statements {
+			add(stmt)
+		}
+	case *ReturnStatement:
+		if n.Value != nil {
+			add(n.Value)
+		}
+	case *ObjectLiteral:
+		for _, key := range n.Keys() {
+			add(n.Properties[key])
+		}
+	case *ArrayLiteral:
+		for _, elem := range n.Elements {
+			add(elem)
+		}
+	case *FunctionLiteral:
+		for _, param := range n.Parameters {
+			if value, ok := n.Defaults[param]; ok {
+				add(value)
+			}
+		}
+		add(n.Body)
+	case *MemberDot:
+		add(n.Object)
+	case *MemberBracket:
+		add(n.Object, n.Member)
+	case *FunctionCall:
+		add(n.Function)
+		for _, arg := range n.Arguments {
+			add(arg)
+		}
+	case *MethodCall:
+		add(n.Object)
+		for _, arg := range n.Arguments {
+			add(arg)
+		}
+	case *UnaryExpression:
+		add(n.Right)
+	case *AwaitExpression:
+		add(n.Value)
+	case *BinaryExpression:
+		add(n.Left, n.Right)
+	case *Assignment:
+		add(n.Left, n.Right)
+	case *Pattern:
+		for _, elem := range n.Elements {
+			add(elem)
+		}
+	case *Tuple:
+		for _, elem := range n.Elements {
+			add(elem)
+		}
+	case *Spread:
+		add(n.Value)
+	case *KeywordArgument:
+		add(n.Value)
+	}
+
+	return children
+}
@@ -0,0 +1,537 @@
+// Package dap implements a Debug Adapter Protocol server running refl scripts under the evaluator's debug hook
+package dap
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"refl/ast"
+	"refl/parser"
+	"refl/runtime"
+	"refl/runtime/eval"
+	"refl/runtime/objects"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// threadID is the only thread reported to clients, coroutines pause one at a time on it
+const threadID = 1
+
+type stepMode int
+
+const (
+	stepNone stepMode = iota
+	stepIn
+	stepOver
+	stepOut
+)
+
+// container is what a variables reference points to: the locals of a frame, the globals or an object
+type container struct {
+	env     *runtime.Environment
+	globals bool
+	object  *objects.ReflObject
+}
+
+// Server is a debug adapter handling one client session
+type Server struct {
+	conn *conn
+
+	// defaultPath is launched when the launch request doesn't name a program
+	defaultPath string
+	path        string
+	program     *ast.Program
+
+	// pauseMu makes coroutines calling the hook concurrently pause one at a time
+	pauseMu sync.Mutex
+
+	mu          sync.Mutex
+	cancel      context.CancelFunc
+	done        chan struct{}
+	breakpoints map[int]bool
+	stopOnEntry bool
+	started     bool
+	pause       bool
+	step        stepMode
+	stepDepth   int
+	lastLine    int
+	lastDepth   int
+	// stop and resume are set while the script is paused
+	stop   *eval.DebugStop
+	resume chan error
+	// refs holds the variables references handed out during the current pause
+	refs []container
+}
+
+// NewServer creates a debug adapter, program is the script launched by default and may be empty
+func NewServer(in io.Reader, out io.Writer, program string) *Server {
+	return &Server{
+		conn:        newConn(in, out),
+		defaultPath: program,
+		breakpoints: make(map[int]bool),
+		done:        make(chan struct{}),
+	}
+}
+
+// Run serves requests until the client disconnects or closes the stream
+func (s *Server) Run() error {
+	defer s.terminate()
+
+	for {
+		body, err := s.conn.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var req request
+		if err := json.Unmarshal(body, &req); err != nil {
+			return fmt.Errorf("invalid message: %w", err)
+		}
+
+		result, err := s.handle(req)
+
+		resp := &response{RequestSeq: req.Seq, Command: req.Command, Success: err == nil, Body: result}
+		if err != nil {
+			resp.Message = err.Error()
+		}
+		if err := s.conn.write(resp); err != nil {
+			return err
+		}
+
+		switch req.Command {
+		case "initialize":
+			if err := s.event("initialized", nil); err != nil {
+				return err
+			}
+		case "disconnect":
+			return nil
+		}
+	}
+}
+
+func (s *Server) event(name string, body any) error {
+	return s.conn.write(&event{Event: name, Body: body})
+}
+
+func decode[T any](args json.RawMessage) (T, error) {
+	var result T
+	if len(args) == 0 {
+		return result, nil
+	}
+	if err := json.Unmarshal(args, &result); err != nil {
+		return result, fmt.Errorf("invalid arguments: %w", err)
+	}
+	return result, nil
+}
+
+func (s *Server) handle(req request) (any, error) {
+	switch req.Command {
+	case "initialize":
+		return map[string]any{
+			"supportsConfigurationDoneRequest": true,
+			"supportsEvaluateForHovers":        true,
+			"supportsTerminateRequest":         true,
+		}, nil
+	case "launch":
+		args, err := decode[LaunchArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.launch(args)
+	case "setBreakpoints":
+		args, err := decode[SetBreakpointsArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return s.setBreakpoints(args), nil
+	case "setExceptionBreakpoints":
+		return map[string]any{"breakpoints": []Breakpoint{}}, nil
+	case "configurationDone":
+		return nil, s.start()
+	case "threads":
+		return map[string]any{"threads": []Thread{{ID: threadID, Name: "main"}}}, nil
+	case "stackTrace":
+		return s.stackTrace(), nil
+	case "scopes":
+		args, err := decode[ScopesArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return s.scopes(args)
+	case "variables":
+		args, err := decode[VariablesArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return s.variables(args)
+	case "evaluate":
+		args, err := decode[EvaluateArguments](req.Arguments)
+		if err != nil {
+			return nil, err
+		}
+		return s.evaluate(args)
+	case "continue":
+		return map[string]any{"allThreadsContinued": true}, s.resumeWith(stepNone)
+	case "next":
+		return nil, s.resumeWith(stepOver)
+	case "stepIn":
+		return nil, s.resumeWith(stepIn)
+	case "stepOut":
+		return nil, s.resumeWith(stepOut)
+	case "pause":
+		s.mu.Lock()
+		s.pause = true
+		s.mu.Unlock()
+		return nil, nil
+	case "terminate", "disconnect":
+		s.terminate()
+		return nil, nil
+	}
+
+	return nil, fmt.Errorf("unsupported command: %s", req.Command)
+}
+
+func (s *Server) launch(args LaunchArguments) error {
+	if args.Program == "" {
+		args.Program = s.defaultPath
+	}
+
+	source, err := os.ReadFile(args.Program)
+	if err != nil {
+		return fmt.Errorf("cannot read program: %w", err)
+	}
+
+	program, err := parser.New().Parse(string(source))
+	if err != nil {
+		return fmt.Errorf("parse error: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.path = args.Program
+	s.program = program
+	s.stopOnEntry = args.StopOnEntry
+
+	return nil
+}
+
+func (s *Server) setBreakpoints(args SetBreakpointsArguments) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.breakpoints = make(map[int]bool)
+	result := []Breakpoint{}
+	for _, bp := range args.Breakpoints {
+		s.breakpoints[bp.Line] = true
+		result = append(result, Breakpoint{Verified: true, Line: bp.Line, Source: args.Source})
+	}
+
+	return map[string]any{"breakpoints": result}
+}
+
+// start runs the launched program once the client is done configuring breakpoints
+func (s *Server) start() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.program == nil {
+		return errors.New("no program launched")
+	}
+	if s.started {
+		return nil
+	}
+	s.started = true
+	s.pause = s.stopOnEntry
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+
+	evaluator := eval.New(ctx, s.program, runtime.NewEnvironment(nil),
+		eval.OptionDebugHook{Hook: s.hook},
+		eval.OptionStdout{Writer: outputWriter{s}},
+	)
+
+	go func() {
+		defer close(s.done)
+		defer cancel()
+
+		exitCode := 0
+		if _, err := evaluator.Run(); err != nil {
+			exitCode = 1
+			if !runtime.IsCancelled(err) {
+				_ = s.event("output", OutputEvent{Category: "stderr", Output: err.Error() + "\n"})
+			}
+		}
+
+		_ = s.event("exited", ExitedEvent{ExitCode: exitCode})
+		_ = s.event("terminated", nil)
+	}()
+
+	return nil
+}
+
+// terminate cancels the running program and waits for it to exit
+func (s *Server) terminate() {
+	s.mu.Lock()
+	started := s.started
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.mu.Unlock()
+
+	if started {
+		<-s.done
+	}
+}
+
+// hook pauses the script when it reaches a breakpoint or finishes a step
+func (s *Server) hook(ctx context.Context, stop *eval.DebugStop) error {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	s.mu.Lock()
+	reason := s.stopReason(stop)
+	if reason == "" {
+		s.mu.Unlock()
+		return nil
+	}
+
+	resume := make(chan error, 1)
+	s.stop = stop
+	s.resume = resume
+	s.refs = nil
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		s.stop = nil
+		s.resume = nil
+		s.refs = nil
+		s.mu.Unlock()
+	}()
+
+	if err := s.event("stopped", StoppedEvent{Reason: reason, ThreadID: threadID, AllThreadsStopped: true}); err != nil {
+		return err
+	}
+
+	select {
+	case err := <-resume:
+		return err
+	case <-ctx.Done():
+		return runtime.NewCancelled(ctx)
+	}
+}
+
+// stopReason returns why the script should pause at the statement, or an empty string, s.mu must be held
+func (s *Server) stopReason(stop *eval.DebugStop) string {
+	depth := len(stop.Frames)
+	line := stop.Pos.Line
+
+	// statements sharing a line with the previous one don't stop again
+	newLine := line != s.lastLine || depth != s.lastDepth
+	s.lastLine = line
+	s.lastDepth = depth
+
+	switch {
+	case s.pause:
+		s.pause = false
+		s.step = stepNone
+		if s.stopOnEntry {
+			s.stopOnEntry = false
+			return "entry"
+		}
+		return "pause"
+	case s.step == stepIn && newLine,
+		s.step == stepOver && newLine && depth <= s.stepDepth,
+		s.step == stepOut && depth < s.stepDepth:
+		s.step = stepNone
+		return "step"
+	case s.breakpoints[line] && newLine:
+		s.step = stepNone
+		return "breakpoint"
+	}
+
+	return ""
+}
+
+func (s *Server) resumeWith(mode stepMode) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop == nil {
+		return errors.New("not paused")
+	}
+
+	s.step = mode
+	s.stepDepth = len(s.stop.Frames)
+	s.resume <- nil
+
+	return nil
+}
+
+func (s *Server) stackTrace() any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frames := []StackFrame{}
+	if s.stop != nil {
+		source := Source{Name: filepath.Base(s.path), Path: s.path}
+		for i, frame := range s.stop.Frames {
+			frames = append(frames, StackFrame{
+				ID:     i + 1,
+				Name:   frame.Name,
+				Source: source,
+				Line:   frame.Pos.Line,
+				Column: frame.Pos.Column + 1,
+			})
+		}
+	}
+
+	return map[string]any{"stackFrames": frames, "totalFrames": len(frames)}
+}
+
+// reference registers a container for the current pause, s.mu must be held
+func (s *Server) reference(c container) int {
+	s.refs = append(s.refs, c)
+	return len(s.refs)
+}
+
+// frame returns the paused frame with the given one-based id, s.mu must be held
+func (s *Server) frame(id int) (eval.Frame, error) {
+	if s.stop == nil {
+		return eval.Frame{}, errors.New("not paused")
+	}
+	if id < 1 || id > len(s.stop.Frames) {
+		return eval.Frame{}, fmt.Errorf("invalid frame %d", id)
+	}
+	return s.stop.Frames[id-1], nil
+}
+
+func (s *Server) scopes(args ScopesArguments) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	frame, err := s.frame(args.FrameID)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]any{"scopes": []Scope{
+		{Name: "Locals", VariablesReference: s.reference(container{env: frame.Env})},
+		{Name: "Globals", VariablesReference: s.reference(container{globals: true})},
+	}}, nil
+}
+
+func (s *Server) variables(args VariablesArguments) (any, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stop == nil {
+		return nil, errors.New("not paused")
+	}
+	if args.VariablesReference < 1 || args.VariablesReference > len(s.refs) {
+		return nil, fmt.Errorf("invalid variables reference %d", args.VariablesReference)
+	}
+
+	c := s.refs[args.VariablesReference-1]
+	values := make(map[string]runtime.Object)
+
+	switch {
+	case c.globals:
+		values = s.stop.Globals()
+	case c.object != nil:
+		for key, value := range c.object.Iterator() {
+			values[key.String()] = value
+		}
+	default:
+		// every environment up to the global one, inner variables shadow outer ones
+		for env := c.env; env != nil && env.Parent() != nil; env = env.Parent() {
+			for name, value := range env.Locals() {
+				if _, ok := values[name]; !ok {
+					values[name] = value
+				}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	result := []Variable{}
+	for _, name := range names {
+		result = append(result, s.variable(name, values[name]))
+	}
+
+	return map[string]any{"variables": result}, nil
+}
+
+// variable describes a value, objects get a reference to expand them, s.mu must be held
+func (s *Server) variable(name string, value runtime.Object) Variable {
+	if value == nil {
+		value = objects.NilInstance
+	}
+
+	v := Variable{Name: name, Value: value.String(), Type: string(value.Type())}
+
+	switch val := value.(type) {
+	case *objects.String:
+		v.Value = strconv.Quote(val.Value)
+	case *objects.ReflObject:
+		v.Value = fmt.Sprintf("object (%d)", val.Length())
+		if val.Length() > 0 {
+			v.VariablesReference = s.reference(container{object: val})
+		}
+	}
+
+	return v
+}
+
+func (s *Server) evaluate(args EvaluateArguments) (any, error) {
+	s.mu.Lock()
+	stop := s.stop
+	s.mu.Unlock()
+
+	if stop == nil {
+		return nil, errors.New("not paused")
+	}
+
+	frame := args.FrameID - 1
+	if args.FrameID == 0 {
+		frame = 0
+	}
+
+	result, err := stop.Eval(frame, args.Expression)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	v := s.variable("", result)
+	return EvaluateResponse{Result: v.Value, Type: v.Type, VariablesReference: v.VariablesReference}, nil
+}
+
+// outputWriter forwards what the script prints to the client as output events
+type outputWriter struct {
+	s *Server
+}
+
+func (w outputWriter) Write(p []byte) (int, error) {
+	if err := w.s.event("output", OutputEvent{Category: "stdout", Output: string(p)}); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
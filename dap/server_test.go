@@ -0,0 +1,312 @@
+package dap
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testMessage struct {
+	Type       string          `json:"type"`
+	RequestSeq int             `json:"request_seq"`
+	Success    bool            `json:"success"`
+	Message    string          `json:"message"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+type testClient struct {
+	t        *testing.T
+	conn     *conn
+	messages chan testMessage
+	events   []testMessage
+	done     chan error
+}
+
+func newTestClient(t *testing.T, program string) *testClient {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	server := NewServer(serverIn, serverOut, program)
+	c := &testClient{
+		t:        t,
+		conn:     newConn(clientIn, clientOut),
+		messages: make(chan testMessage, 100),
+		done:     make(chan error, 1),
+	}
+
+	go func() {
+		c.done <- server.Run()
+		serverOut.Close()
+	}()
+
+	go func() {
+		defer close(c.messages)
+		for {
+			body, err := c.conn.read()
+			if err != nil {
+				return
+			}
+			var msg testMessage
+			if json.Unmarshal(body, &msg) == nil {
+				c.messages <- msg
+			}
+		}
+	}()
+
+	t.Cleanup(func() {
+		clientOut.Close()
+	})
+
+	return c
+}
+
+func (c *testClient) next() testMessage {
+	select {
+	case msg, ok := <-c.messages:
+		require.True(c.t, ok, "connection closed")
+		return msg
+	case <-time.After(5 * time.Second):
+		c.t.Fatal("timed out waiting for a message")
+		return testMessage{}
+	}
+}
+
+// request sends a request and decodes the body of its response into result
+func (c *testClient) request(command string, args any, result any) testMessage {
+	c.t.Helper()
+
+	req := map[string]any{"type": "request", "command": command, "arguments": args}
+	c.conn.outMu.Lock()
+	c.conn.seq++
+	req["seq"] = c.conn.seq
+	seq := c.conn.seq
+	c.conn.outMu.Unlock()
+	require.NoError(c.t, c.conn.write(req))
+
+	for {
+		msg := c.next()
+		if msg.Type == "event" {
+			c.events = append(c.events, msg)
+			continue
+		}
+
+		require.Equal(c.t, seq, msg.RequestSeq)
+		if result != nil && msg.Success {
+			require.NoError(c.t, json.Unmarshal(msg.Body, result))
+		}
+		return msg
+	}
+}
+
+// event waits for the event with the given name and decodes its body into body
+func (c *testClient) event(name string, body any) {
+	c.t.Helper()
+
+	for {
+		var msg testMessage
+		if len(c.events) > 0 {
+			msg, c.events = c.events[0], c.events[1:]
+		} else {
+			msg = c.next()
+		}
+
+		if msg.Type == "event" && msg.Event == name {
+			if body != nil {
+				require.NoError(c.t, json.Unmarshal(msg.Body, body))
+			}
+			return
+		}
+	}
+}
+
+func (c *testClient) stopped(reason string) {
+	c.t.Helper()
+
+	var stopped StoppedEvent
+	c.event("stopped", &stopped)
+	require.Equal(c.t, reason, stopped.Reason)
+}
+
+func (c *testClient) frames() []StackFrame {
+	c.t.Helper()
+
+	var result struct {
+		StackFrames []StackFrame `json:"stackFrames"`
+	}
+	require.True(c.t, c.request("stackTrace", map[string]any{"threadId": threadID}, &result).Success)
+	return result.StackFrames
+}
+
+func (c *testClient) evaluate(expression string, frameID int) EvaluateResponse {
+	c.t.Helper()
+
+	var result EvaluateResponse
+	msg := c.request("evaluate", EvaluateArguments{Expression: expression, FrameID: frameID}, &result)
+	require.True(c.t, msg.Success, msg.Message)
+	return result
+}
+
+func (c *testClient) variables(ref int) map[string]string {
+	c.t.Helper()
+
+	var result struct {
+		Variables []Variable `json:"variables"`
+	}
+	require.True(c.t, c.request("variables", VariablesArguments{VariablesReference: ref}, &result).Success)
+
+	values := make(map[string]string)
+	for _, v := range result.Variables {
+		values[v.Name] = v.Value
+	}
+	return values
+}
+
+const testProgram = `var add = fun(a, b) {
+  var sum = a + b
+  return sum
+}
+var x = add(1, 2)
+var obj = {name: "refl"}
+io.println(x)
+`
+
+func TestServer(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.refl")
+	require.NoError(t, os.WriteFile(path, []byte(testProgram), 0o644))
+
+	setBreakpoints := func(c *testClient, lines ...int) {
+		var bps []SourceBreakpoint
+		for _, line := range lines {
+			bps = append(bps, SourceBreakpoint{Line: line})
+		}
+		msg := c.request("setBreakpoints", SetBreakpointsArguments{Source: Source{Path: path}, Breakpoints: bps}, nil)
+		require.True(t, msg.Success)
+	}
+
+	start := func(t *testing.T, args LaunchArguments, breakpoints ...int) *testClient {
+		c := newTestClient(t, path)
+
+		require.True(t, c.request("initialize", map[string]any{"adapterID": "refl"}, nil).Success)
+		c.event("initialized", nil)
+		msg := c.request("launch", args, nil)
+		require.True(t, msg.Success, msg.Message)
+		setBreakpoints(c, breakpoints...)
+		require.True(t, c.request("configurationDone", nil, nil).Success)
+
+		return c
+	}
+
+	finish := func(t *testing.T, c *testClient, output string) {
+		require.True(t, c.request("continue", map[string]any{"threadId": threadID}, nil).Success)
+
+		if output != "" {
+			var out OutputEvent
+			c.event("output", &out)
+			require.Equal(t, output, out.Output)
+		}
+
+		var exited ExitedEvent
+		c.event("exited", &exited)
+		require.Equal(t, 0, exited.ExitCode)
+		c.event("terminated", nil)
+
+		require.True(t, c.request("disconnect", nil, nil).Success)
+		require.NoError(t, <-c.done)
+	}
+
+	t.Run("breakpoint, scopes and evaluate", func(t *testing.T) {
+		c := start(t, LaunchArguments{}, 2)
+		c.stopped("breakpoint")
+
+		frames := c.frames()
+		require.Len(t, frames, 2)
+		require.Equal(t, "add", frames[0].Name)
+		require.Equal(t, 2, frames[0].Line)
+		require.Equal(t, path, frames[0].Source.Path)
+		require.Equal(t, "main", frames[1].Name)
+		require.Equal(t, 5, frames[1].Line)
+
+		var scopes struct {
+			Scopes []Scope `json:"scopes"`
+		}
+		require.True(t, c.request("scopes", ScopesArguments{FrameID: frames[0].ID}, &scopes).Success)
+		require.Len(t, scopes.Scopes, 2)
+
+		locals := c.variables(scopes.Scopes[0].VariablesReference)
+		require.Equal(t, "1", locals["a"])
+		require.Equal(t, "2", locals["b"])
+		require.Contains(t, locals, "args")
+
+		globals := c.variables(scopes.Scopes[1].VariablesReference)
+		require.Contains(t, globals, "add")
+		require.NotContains(t, globals, "math")
+
+		require.Equal(t, "3", c.evaluate("a + b", frames[0].ID).Result)
+		require.Equal(t, `"refl"`, c.evaluate(`"re" + "fl"`, frames[1].ID).Result)
+
+		msg := c.request("evaluate", EvaluateArguments{Expression: "a +", FrameID: frames[0].ID}, nil)
+		require.False(t, msg.Success)
+
+		finish(t, c, "3\n")
+	})
+
+	t.Run("stepping", func(t *testing.T) {
+		c := start(t, LaunchArguments{StopOnEntry: true})
+		c.stopped("entry")
+		require.Equal(t, 1, c.frames()[0].Line)
+
+		steps := []struct {
+			command string
+			line    int
+			depth   int
+		}{
+			{"next", 5, 1},
+			{"stepIn", 2, 2},
+			{"next", 3, 2},
+			{"stepOut", 6, 1},
+			{"next", 7, 1},
+		}
+
+		for _, step := range steps {
+			require.True(t, c.request(step.command, map[string]any{"threadId": threadID}, nil).Success)
+			c.stopped("step")
+
+			frames := c.frames()
+			require.Equal(t, step.line, frames[0].Line, step.command)
+			require.Len(t, frames, step.depth, step.command)
+		}
+
+		obj := c.evaluate("obj", 1)
+		require.NotZero(t, obj.VariablesReference)
+		require.Equal(t, map[string]string{"name": `"refl"`}, c.variables(obj.VariablesReference))
+
+		finish(t, c, "3\n")
+	})
+
+	t.Run("disconnect while paused", func(t *testing.T) {
+		c := start(t, LaunchArguments{Program: path}, 3)
+		c.stopped("breakpoint")
+
+		require.True(t, c.request("disconnect", nil, nil).Success)
+		require.NoError(t, <-c.done)
+	})
+
+	t.Run("launch errors", func(t *testing.T) {
+		c := newTestClient(t, "")
+		require.True(t, c.request("initialize", nil, nil).Success)
+
+		msg := c.request("launch", LaunchArguments{Program: filepath.Join(t.TempDir(), "missing.refl")}, nil)
+		require.False(t, msg.Success)
+		require.Contains(t, msg.Message, "cannot read program")
+
+		require.False(t, c.request("configurationDone", nil, nil).Success)
+		require.True(t, c.request("disconnect", nil, nil).Success)
+		require.NoError(t, <-c.done)
+	})
+}
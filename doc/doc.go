@@ -0,0 +1,194 @@
+// Package doc extracts the `##` doc comments of refl files and renders them as Markdown, HTML or a JSON index
+package doc
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"refl/ast"
+	"refl/parser"
+	"sort"
+	"strings"
+)
+
+// Entry kinds
+const (
+	KindFunction = "function"
+	// KindMethod is a function property whose first parameter is self, it's called like obj:method()
+	KindMethod = "method"
+	KindObject = "object"
+	KindValue  = "value"
+)
+
+// Entry documents a top-level variable or an object property, which is named like `shapes.area`
+type Entry struct {
+	Name string `json:"name"`
+	Kind string `json:"kind"`
+	// Params lists the parameters of functions, without self for methods
+	Params    []string `json:"params,omitempty"`
+	Signature string   `json:"signature"`
+	Doc       string   `json:"doc,omitempty"`
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	// Depth is 0 for top-level variables and grows by one for each object they're nested in
+	Depth int `json:"depth"`
+}
+
+// File holds the entries of a file in source order, members right after their object
+type File struct {
+	Name    string   `json:"name"`
+	Entries []*Entry `json:"entries"`
+}
+
+// Lookup returns the entry with the name, such as `add` or `shapes.area`
+func (f *File) Lookup(name string) *Entry {
+	for _, entry := range f.Entries {
+		if entry.Name == name {
+			return entry
+		}
+	}
+	return nil
+}
+
+// Extract documents the top-level variables of a program parsed with parser.OptionComments.
+// Functions are documented even without doc comments, other values only with one.
+// The members of object literals are documented the same way.
+func Extract(filename string, program *ast.Program) *File {
+	file := &File{Name: filename, Entries: []*Entry{}}
+
+	for _, stmt := range program.Statements {
+		var name string
+		var value ast.Expression
+
+		switch s := stmt.(type) {
+		case *ast.VarDeclaration:
+			if s.Pattern != nil {
+				continue
+			}
+			name, value = s.Name, s.Value
+		case *ast.ExpressionStatement:
+			assign, ok := s.Expression.(*ast.Assignment)
+			if !ok {
+				continue
+			}
+			ident, ok := assign.Left.(*ast.Identifier)
+			if !ok {
+				continue
+			}
+			name, value = ident.Name, assign.Right
+		default:
+			continue
+		}
+
+		file.Entries = append(file.Entries, describe(program, filename, name, stmt, value, 0, false)...)
+	}
+
+	return file
+}
+
+// describe returns the entry of a variable or property followed by the entries of its members,
+// or nothing if there's nothing to document
+func describe(program *ast.Program, filename, name string, node ast.Node, value ast.Expression, depth int, member bool) []*Entry {
+	entry := &Entry{
+		Name:   name,
+		Kind:   KindValue,
+		Doc:    program.TriviaOf(node).Doc(),
+		File:   filename,
+		Line:   node.Position().Line,
+		Column: node.Position().Column,
+		Depth:  depth,
+	}
+
+	var members []*Entry
+
+	switch v := value.(type) {
+	case *ast.FunctionLiteral:
+		entry.Kind = KindFunction
+		entry.Params = v.Params()
+		separator := "."
+		if member && len(v.Parameters) > 0 && v.Parameters[0] == "self" {
+			entry.Kind = KindMethod
+			entry.Params = entry.Params[1:]
+			separator = ":"
+		}
+
+		entry.Signature = fmt.Sprintf("%s(%s)", name, strings.Join(entry.Params, ", "))
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			entry.Signature = name[:i] + separator + entry.Signature[i+1:]
+		}
+	case *ast.ObjectLiteral:
+		entry.Kind = KindObject
+
+		for _, key := range v.Keys() {
+			property := v.Properties[key]
+			members = append(members, describe(program, filename, name+"."+key, property, property, depth+1, true)...)
+		}
+	}
+
+	if entry.Signature == "" {
+		entry.Signature = name
+	}
+
+	if entry.Kind != KindFunction && entry.Kind != KindMethod && entry.Doc == "" && len(members) == 0 {
+		return nil
+	}
+
+	return append([]*Entry{entry}, members...)
+}
+
+// ParseFile reads and documents a file
+func ParseFile(filename string) (*File, error) {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	program, err := parser.New(parser.OptionComments{}).Parse(string(source))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filename, err)
+	}
+
+	return Extract(filename, program), nil
+}
+
+// Discover returns the .refl files in the directories, recursively, without the *_test.refl files.
+// Files given explicitly are kept as is.
+func Discover(paths []string) ([]string, error) {
+	var files []string
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			files = append(files, path)
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), ".refl") && !strings.HasSuffix(d.Name(), "_test.refl") {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(found)
+		files = append(files, found...)
+	}
+
+	return files, nil
+}
@@ -0,0 +1,139 @@
+package doc
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"refl/parser"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const shapesSource = `## Shapes and their measures.
+##
+## Lengths are in meters.
+var shapes = {
+  ## The number of sides of a square.
+  sides: 4,
+  ## Returns the area of a square.
+  area: fun(self, side) {
+    return side * side
+  },
+  nested: {
+    ## Does nothing.
+    noop: fun() {}
+  }
+}
+
+# a regular comment
+var add = fun(a, b) {
+  return a + b
+}
+
+## Scales a value.
+scale = fun(x) { return x * 2 }
+
+var undocumented = 5
+`
+
+func extract(t *testing.T, source string) *File {
+	program, err := parser.New(parser.OptionComments{}).Parse(source)
+	require.NoError(t, err)
+	return Extract("shapes.refl", program)
+}
+
+func TestExtract(t *testing.T) {
+	file := extract(t, shapesSource)
+
+	var names []string
+	for _, entry := range file.Entries {
+		names = append(names, entry.Name)
+	}
+	require.Equal(t, []string{"shapes", "shapes.sides", "shapes.area", "shapes.nested", "shapes.nested.noop", "add", "scale"}, names)
+
+	tests := []struct {
+		name      string
+		kind      string
+		signature string
+		doc       string
+		depth     int
+	}{
+		{"shapes", KindObject, "shapes", "Shapes and their measures.\n\nLengths are in meters.", 0},
+		{"shapes.sides", KindValue, "shapes.sides", "The number of sides of a square.", 1},
+		{"shapes.area", KindMethod, "shapes:area(side)", "Returns the area of a square.", 1},
+		{"shapes.nested.noop", KindFunction, "shapes.nested.noop()", "Does nothing.", 2},
+		{"add", KindFunction, "add(a, b)", "", 0},
+		{"scale", KindFunction, "scale(x)", "Scales a value.", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := file.Lookup(tt.name)
+			require.NotNil(t, entry)
+			require.Equal(t, tt.kind, entry.Kind)
+			require.Equal(t, tt.signature, entry.Signature)
+			require.Equal(t, tt.doc, entry.Doc)
+			require.Equal(t, tt.depth, entry.Depth)
+		})
+	}
+
+	require.Equal(t, 4, file.Lookup("shapes").Line)
+	require.Nil(t, file.Lookup("undocumented"))
+}
+
+func TestWrite(t *testing.T) {
+	files := []*File{extract(t, shapesSource)}
+
+	t.Run("markdown", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, Write(&out, "markdown", files))
+		require.Contains(t, out.String(), "# shapes.refl\n\n## `shapes`\n\nShapes and their measures.\n\nLengths are in meters.\n")
+		require.Contains(t, out.String(), "\n### `shapes:area(side)`\n\nReturns the area of a square.\n")
+		require.Contains(t, out.String(), "\n#### `shapes.nested.noop()`\n")
+	})
+
+	t.Run("html", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, Write(&out, "html", files))
+		require.Contains(t, out.String(), "<title>shapes.refl</title>")
+		require.Contains(t, out.String(), "<h3><code>shapes:area(side)</code></h3>\n<p>Returns the area of a square.</p>")
+		require.Contains(t, out.String(), "<p>Lengths are in meters.</p>")
+	})
+
+	t.Run("json", func(t *testing.T) {
+		var out bytes.Buffer
+		require.NoError(t, Write(&out, "json", files))
+
+		var index Index
+		require.NoError(t, json.Unmarshal(out.Bytes(), &index))
+		require.Len(t, index.Files, 1)
+		require.Equal(t, files[0], index.Files[0])
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		require.ErrorContains(t, Write(&bytes.Buffer{}, "pdf", files), "unknown doc format")
+	})
+}
+
+func TestDiscover(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"b.refl", "a.refl", "a_test.refl", "notes.txt", ".hidden/c.refl", "sub/d.refl"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte("var x = 1\n"), 0o644))
+	}
+
+	files, err := Discover([]string{dir})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		filepath.Join(dir, "a.refl"),
+		filepath.Join(dir, "b.refl"),
+		filepath.Join(dir, "sub/d.refl"),
+	}, files)
+
+	file, err := ParseFile(files[0])
+	require.NoError(t, err)
+	require.Empty(t, file.Entries)
+}
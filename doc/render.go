@@ -0,0 +1,103 @@
+package doc
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"io"
+	"strings"
+)
+
+// Formats are the output formats accepted by Write
+var Formats = []string{"markdown", "html", "json"}
+
+// Write renders the documentation of the files in the format, one of Formats
+func Write(w io.Writer, format string, files []*File) error {
+	switch format {
+	case "markdown":
+		return WriteMarkdown(w, files)
+	case "html":
+		return WriteHTML(w, files)
+	case "json":
+		return WriteJSON(w, files)
+	}
+
+	return fmt.Errorf("unknown doc format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// WriteMarkdown renders a section per file with a heading per entry, members are nested one level deeper
+func WriteMarkdown(w io.Writer, files []*File) error {
+	var b strings.Builder
+
+	for i, file := range files {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "# %s\n", file.Name)
+
+		for _, entry := range file.Entries {
+			fmt.Fprintf(&b, "\n%s `%s`\n", strings.Repeat("#", min(entry.Depth+2, 6)), entry.Signature)
+			if entry.Doc != "" {
+				fmt.Fprintf(&b, "\n%s\n", entry.Doc)
+			}
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+var htmlTemplate = template.Must(template.New("doc").Funcs(template.FuncMap{
+	"heading": func(depth int) int { return min(depth+2, 6) },
+	"paragraphs": func(doc string) []string {
+		return strings.Split(doc, "\n\n")
+	},
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{if eq (len .) 1}}{{(index . 0).Name}}{{else}}Refl documentation{{end}}</title>
+<style>
+body { font-family: sans-serif; max-width: 50em; margin: 2em auto; line-height: 1.5; }
+code { background: #f4f4f4; padding: 0.1em 0.3em; }
+.entry p { white-space: pre-wrap; margin-left: 1em; }
+</style>
+</head>
+<body>
+{{- range .}}
+<section id="{{.Name}}">
+<h1>{{.Name}}</h1>
+{{- range .Entries}}
+<div class="entry" id="{{.Name}}">
+<h{{heading .Depth}}><code>{{.Signature}}</code></h{{heading .Depth}}>
+{{- if .Doc}}{{range paragraphs .Doc}}
+<p>{{.}}</p>
+{{- end}}{{end}}
+</div>
+{{- end}}
+</section>
+{{- end}}
+</body>
+</html>
+`))
+
+// WriteHTML renders a single page with a section per file
+func WriteHTML(w io.Writer, files []*File) error {
+	return htmlTemplate.Execute(w, files)
+}
+
+// Index is the JSON index of the entries of several files, for tools such as editors to show on hover
+type Index struct {
+	Files []*File `json:"files"`
+}
+
+// WriteJSON writes the Index of the files
+func WriteJSON(w io.Writer, files []*File) error {
+	if files == nil {
+		files = []*File{}
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(Index{Files: files})
+}
@@ -0,0 +1,401 @@
+package lsp
+
+import (
+	"fmt"
+	"refl/ast"
+	refldoc "refl/doc"
+	"refl/runtime/eval"
+	"strings"
+)
+
+type symbolKind int
+
+const (
+	symbolVar symbolKind = iota
+	symbolParam
+	symbolLoopVar
+	// symbolGlobal is a global defined by assigning to an undeclared name
+	symbolGlobal
+	symbolBuiltin
+)
+
+// symbol is a variable along with the places it's used at, offsets are in bytes
+type symbol struct {
+	name   string
+	kind   symbolKind
+	offset int // offset of the declaring identifier, -1 for builtins and args
+	value  ast.Expression
+	refs   []int
+	// doc is the `##` doc comment of the declaration
+	doc string
+}
+
+func (s *symbol) declared() bool {
+	return s.offset >= 0
+}
+
+// scope mirrors the environments the evaluator creates: one per block, function call and for loop
+type scope struct {
+	parent   *scope
+	start    int
+	end      int
+	symbols  map[string][]*symbol
+	children []*scope
+}
+
+func newScope(parent *scope, start, end int) *scope {
+	s := &scope{parent: parent, start: start, end: end, symbols: make(map[string][]*symbol)}
+	if parent != nil {
+		parent.children = append(parent.children, s)
+	}
+	return s
+}
+
+func (s *scope) declare(sym *symbol) {
+	s.symbols[sym.name] = append(s.symbols[sym.name], sym)
+}
+
+// lookup finds the declaration visible at the offset, preferring the last one before it.
+// Declarations after the offset are still visible to code that runs later, such as function bodies
+func (s *scope) lookup(name string, offset int) *symbol {
+	for cur := s; cur != nil; cur = cur.parent {
+		candidates := cur.symbols[name]
+		if len(candidates) == 0 {
+			continue
+		}
+
+		found := candidates[0]
+		for _, sym := range candidates {
+			if sym.offset <= offset {
+				found = sym
+			}
+		}
+		return found
+	}
+
+	return nil
+}
+
+// innermost returns the deepest scope containing the offset
+func (s *scope) innermost(offset int) *scope {
+	for _, child := range s.children {
+		if offset >= child.start && offset < child.end {
+			return child.innermost(offset)
+		}
+	}
+	return s
+}
+
+type usage struct {
+	scope  *scope
+	name   string
+	offset int
+	assign bool
+}
+
+// analysis holds the scopes and symbols of a parsed document
+type analysis struct {
+	doc      *document
+	program  *ast.Program
+	global   *scope
+	builtins map[string]*symbol
+	// refs maps the offset of every declaring or referencing identifier to its symbol
+	refs   map[int]*symbol
+	usages []usage
+	// docs documents the top-level variables and their members, for hovers on `obj.member`
+	docs *refldoc.File
+}
+
+func analyze(doc *document, program *ast.Program) *analysis {
+	a := &analysis{
+		doc:      doc,
+		program:  program,
+		global:   newScope(nil, 0, len(doc.text)+1),
+		builtins: make(map[string]*symbol),
+		refs:     make(map[int]*symbol),
+		docs:     refldoc.Extract(doc.uri, program),
+	}
+
+	for _, stmt := range program.Statements {
+		a.statement(a.global, stmt)
+	}
+
+	// assignments may define globals, so they are resolved before plain reads
+	for _, u := range a.usages {
+		if u.assign {
+			a.resolve(u)
+		}
+	}
+	for _, u := range a.usages {
+		if !u.assign {
+			a.resolve(u)
+		}
+	}
+	a.usages = nil
+
+	return a
+}
+
+func (a *analysis) resolve(u usage) {
+	sym := u.scope.lookup(u.name, u.offset)
+
+	if sym == nil && u.assign {
+		sym = &symbol{name: u.name, kind: symbolGlobal, offset: u.offset}
+		a.global.declare(sym)
+		a.refs[u.offset] = sym
+		return
+	}
+
+	if sym == nil {
+		if _, ok := eval.BuiltinDoc(u.name); !ok {
+			return
+		}
+
+		sym = a.builtins[u.name]
+		if sym == nil {
+			sym = &symbol{name: u.name, kind: symbolBuiltin, offset: -1}
+			a.builtins[u.name] = sym
+		}
+	}
+
+	sym.refs = append(sym.refs, u.offset)
+	a.refs[u.offset] = sym
+}
+
+func (a *analysis) declare(s *scope, sym *symbol) {
+	s.declare(sym)
+	if sym.declared() {
+		a.refs[sym.offset] = sym
+	}
+}
+
+// declareAfter declares a symbol named by the first matching identifier after the offset
+func (a *analysis) declareAfter(s *scope, from int, name string, kind symbolKind, value ast.Expression) int {
+	offset := findIdent(a.doc.text, from, name)
+	if offset < 0 {
+		return from
+	}
+
+	a.declare(s, &symbol{name: name, kind: kind, offset: offset, value: value})
+	return offset + len(name)
+}
+
+// declarePattern declares the identifiers of a destructuring pattern found after the offset
+func (a *analysis) declarePattern(s *scope, from int, pattern *ast.Pattern, kind symbolKind) {
+	for _, elem := range pattern.Elements {
+		if ident, ok := elem.(*ast.Identifier); ok {
+			from = a.declareAfter(s, from, ident.Name, kind, nil)
+		}
+	}
+}
+
+func (a *analysis) block(parent *scope, block *ast.BlockStatement) *scope {
+	start := a.doc.astOffset(block.Pos)
+	s := newScope(parent, start, matchBrace(a.doc.text, start))
+
+	for _, stmt := range block.Statements {
+		a.statement(s, stmt)
+	}
+
+	return s
+}
+
+func (a *analysis) statement(s *scope, stmt ast.Statement) {
+	switch stmt := stmt.(type) {
+	case *ast.VarDeclaration:
+		if stmt.Value != nil {
+			a.expression(s, stmt.Value)
+		}
+		if stmt.Pattern != nil {
+			a.declarePattern(s, a.doc.astOffset(stmt.Pos), stmt.Pattern, symbolVar)
+			return
+		}
+		a.declareAfter(s, a.doc.astOffset(stmt.Pos), stmt.Name, symbolVar, stmt.Value)
+		if syms := s.symbols[stmt.Name]; len(syms) > 0 && syms[len(syms)-1].value == stmt.Value {
+			syms[len(syms)-1].doc = a.program.TriviaOf(stmt).Doc()
+		}
+	case *ast.ExpressionStatement:
+		a.expression(s, stmt.Expression)
+	case *ast.IfStatement:
+		a.expression(s, stmt.Condition)
+		a.block(s, stmt.Then)
+		for _, elif := range stmt.Elif {
+			a.expression(s, elif.Condition)
+			a.block(s, elif.Body)
+		}
+		if stmt.Else != nil {
+			a.block(s, stmt.Else)
+		}
+	case *ast.WhileStatement:
+		a.expression(s, stmt.Condition)
+		a.block(s, stmt.Body)
+	case *ast.ForStatement:
+		a.expression(s, stmt.Object)
+
+		start := a.doc.astOffset(stmt.Pos)
+		forScope := newScope(s, start, matchBrace(a.doc.text, a.doc.astOffset(stmt.Body.Pos)))
+		next := a.declareAfter(forScope, start, stmt.Key, symbolLoopVar, nil)
+		if stmt.ValuePattern != nil {
+			a.declarePattern(forScope, next, stmt.ValuePattern, symbolLoopVar)
+		} else if stmt.Value != "" {
+			a.declareAfter(forScope, next, stmt.Value, symbolLoopVar, nil)
+		}
+
+		a.block(forScope, stmt.Body)
+	case *ast.BlockStatement:
+		a.block(s, stmt)
+	case *ast.ReturnStatement:
+		if stmt.Value != nil {
+			a.expression(s, stmt.Value)
+		}
+	}
+}
+
+func (a *analysis) expression(s *scope, expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		a.usages = append(a.usages, usage{scope: s, name: expr.Name, offset: a.doc.astOffset(expr.Pos)})
+	case *ast.ObjectLiteral:
+		for _, value := range expr.Properties {
+			a.expression(s, value)
+		}
+	case *ast.ArrayLiteral:
+		for _, elem := range expr.Elements {
+			a.expression(s, elem)
+		}
+	case *ast.FunctionLiteral:
+		start := a.doc.astOffset(expr.Body.Pos)
+		fnScope := newScope(s, start, matchBrace(a.doc.text, start))
+
+		next := a.doc.astOffset(expr.Pos)
+		for _, param := range expr.Parameters {
+			next = a.declareAfter(fnScope, next, param, symbolParam, nil)
+			if value, ok := expr.Defaults[param]; ok {
+				a.expression(fnScope, value)
+			}
+		}
+		if expr.Rest != "" {
+			a.declareAfter(fnScope, next, expr.Rest, symbolParam, nil)
+		}
+		a.declare(fnScope, &symbol{name: "args", kind: symbolParam, offset: -1})
+
+		a.block(fnScope, expr.Body)
+	case *ast.MemberDot:
+		a.expression(s, expr.Object)
+	case *ast.MemberBracket:
+		a.expression(s, expr.Object)
+		a.expression(s, expr.Member)
+	case *ast.FunctionCall:
+		a.expression(s, expr.Function)
+		for _, arg := range expr.Arguments {
+			a.expression(s, arg)
+		}
+	case *ast.MethodCall:
+		a.expression(s, expr.Object)
+		for _, arg := range expr.Arguments {
+			a.expression(s, arg)
+		}
+	case *ast.UnaryExpression:
+		a.expression(s, expr.Right)
+	case *ast.AwaitExpression:
+		a.expression(s, expr.Value)
+	case *ast.BinaryExpression:
+		a.expression(s, expr.Left)
+		a.expression(s, expr.Right)
+	case *ast.Assignment:
+		a.expression(s, expr.Right)
+		a.target(s, expr.Left)
+	case *ast.Tuple:
+		for _, elem := range expr.Elements {
+			a.expression(s, elem)
+		}
+	case *ast.Spread:
+		a.expression(s, expr.Value)
+	case *ast.KeywordArgument:
+		a.expression(s, expr.Value)
+	}
+}
+
+// target records the usages of an assignment target, assigned identifiers included
+func (a *analysis) target(s *scope, expr ast.Expression) {
+	switch expr := expr.(type) {
+	case *ast.Identifier:
+		a.usages = append(a.usages, usage{scope: s, name: expr.Name, offset: a.doc.astOffset(expr.Pos), assign: true})
+	case *ast.Pattern:
+		for _, elem := range expr.Elements {
+			a.target(s, elem)
+		}
+	default:
+		a.expression(s, expr)
+	}
+}
+
+// symbolAt returns the symbol of the identifier at the offset
+func (a *analysis) symbolAt(offset int) (*symbol, int) {
+	start, word := wordAround(a.doc.text, offset)
+	if word == "" {
+		return nil, -1
+	}
+
+	return a.refs[start], start
+}
+
+// visible returns the symbols visible at the offset, inner ones shadowing outer ones
+func (a *analysis) visible(offset int) []*symbol {
+	var result []*symbol
+	seen := make(map[string]bool)
+
+	for s := a.global.innermost(offset); s != nil; s = s.parent {
+		for name := range s.symbols {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			result = append(result, s.lookup(name, offset))
+		}
+	}
+
+	return result
+}
+
+// describe returns the hover text of a symbol
+func (a *analysis) describe(sym *symbol) string {
+	switch sym.kind {
+	case symbolBuiltin:
+		doc, _ := eval.BuiltinDoc(sym.name)
+		return doc
+	case symbolParam:
+		if !sym.declared() {
+			return "args - the arguments the function was called with"
+		}
+		return fmt.Sprintf("(parameter) %s", sym.name)
+	case symbolLoopVar:
+		return fmt.Sprintf("(loop variable) %s", sym.name)
+	case symbolGlobal:
+		return fmt.Sprintf("(global) %s", sym.name)
+	}
+
+	text := fmt.Sprintf("var %s", sym.name)
+	if fn, ok := sym.value.(*ast.FunctionLiteral); ok {
+		text = fmt.Sprintf("var %s = fun(%s)", sym.name, strings.Join(fn.Params(), ", "))
+	}
+
+	if sym.doc != "" {
+		text += "\n\n" + sym.doc
+	}
+
+	return text
+}
+
+// describeMember returns the hover text of a documented member of a top-level object, such as `shapes.area`
+func (a *analysis) describeMember(name string) string {
+	entry := a.docs.Lookup(name)
+	if entry == nil {
+		return ""
+	}
+
+	if entry.Doc == "" {
+		return entry.Signature
+	}
+	return entry.Signature + "\n\n" + entry.Doc
+}
@@ -0,0 +1,287 @@
+package lsp
+
+import (
+	"errors"
+	"refl/ast"
+	"refl/parser"
+	"sort"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// document is an open text document along with the results of its analysis
+type document struct {
+	uri        string
+	text       string
+	lineStarts []int
+
+	diagnostics []Diagnostic
+	// analysis is nil until the document parses without errors once, afterwards it is kept
+	// from the last version without syntax errors, so completion keeps working while typing.
+	// Such an analysis is stale: its positions are those of its own text, see analysisOffset.
+	analysis *analysis
+}
+
+func newDocument(uri, text string, previous *document) *document {
+	doc := &document{uri: uri, text: text, lineStarts: []int{0}}
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\n' {
+			doc.lineStarts = append(doc.lineStarts, i+1)
+		}
+	}
+
+	p := parser.New(parser.OptionComments{})
+	program, err := p.Parse(text)
+
+	errs := p.Errors()
+	if err != nil && len(errs) == 0 {
+		errs = []error{err}
+	}
+
+	doc.diagnostics = []Diagnostic{}
+	for _, parseErr := range errs {
+		doc.diagnostics = append(doc.diagnostics, doc.diagnostic(parseErr))
+	}
+
+	if err == nil && program != nil {
+		doc.analysis = analyze(doc, program)
+	} else if previous != nil {
+		// the analysis keeps the text it was built from, so its positions stay consistent
+		doc.analysis = previous.analysis
+	}
+
+	return doc
+}
+
+// diagnostic converts a parse error to a diagnostic spanning the offending token
+func (d *document) diagnostic(err error) Diagnostic {
+	var syntaxErr *parser.SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		return Diagnostic{Severity: SeverityError, Source: "refl", Message: err.Error()}
+	}
+
+	start := d.astOffset(ast.Position{Line: syntaxErr.Line, Column: syntaxErr.Column})
+	end := d.astOffset(ast.Position{Line: syntaxErr.EndLine, Column: syntaxErr.EndColumn})
+	if end <= start && start < len(d.text) {
+		_, size := utf8.DecodeRuneInString(d.text[start:])
+		end = start + size
+	}
+
+	return Diagnostic{
+		Range:    Range{Start: d.position(start), End: d.position(end)},
+		Severity: SeverityError,
+		Source:   "refl",
+		Message:  syntaxErr.Message,
+	}
+}
+
+// astOffset converts an ast position, a one-based line and a zero-based character column, to a byte offset
+func (d *document) astOffset(pos ast.Position) int {
+	if pos.Line < 1 {
+		return 0
+	}
+	if pos.Line > len(d.lineStarts) {
+		return len(d.text)
+	}
+
+	offset := d.lineStarts[pos.Line-1]
+	for i := 0; i < pos.Column && offset < len(d.text) && d.text[offset] != '\n'; i++ {
+		_, size := utf8.DecodeRuneInString(d.text[offset:])
+		offset += size
+	}
+
+	return offset
+}
+
+// position converts a byte offset to an LSP position
+func (d *document) position(offset int) Position {
+	offset = min(max(offset, 0), len(d.text))
+
+	line := sort.Search(len(d.lineStarts), func(i int) bool {
+		return d.lineStarts[i] > offset
+	}) - 1
+
+	character := 0
+	for _, r := range d.text[d.lineStarts[line]:offset] {
+		character += utf16.RuneLen(r)
+	}
+
+	return Position{Line: line, Character: character}
+}
+
+// offset converts an LSP position to a byte offset
+func (d *document) offset(pos Position) int {
+	if pos.Line < 0 {
+		return 0
+	}
+	if pos.Line >= len(d.lineStarts) {
+		return len(d.text)
+	}
+
+	offset := d.lineStarts[pos.Line]
+	for character := 0; character < pos.Character && offset < len(d.text) && d.text[offset] != '\n'; {
+		r, size := utf8.DecodeRuneInString(d.text[offset:])
+		character += utf16.RuneLen(r)
+		offset += size
+	}
+
+	return offset
+}
+
+// stale reports whether the analysis was built from an older text of the document
+func (d *document) stale() bool {
+	return d.analysis != nil && d.analysis.doc != d
+}
+
+// analysisOffset maps an offset of the text to the analyzed text. The texts differ in a single edited region
+// at most, offsets before it are unchanged and offsets after it are shifted by the length difference.
+// Offsets within the region have no counterpart and false is returned.
+func (d *document) analysisOffset(offset int) (int, bool) {
+	if d.analysis == nil {
+		return -1, false
+	}
+	if !d.stale() {
+		return offset, true
+	}
+
+	old := d.analysis.doc.text
+	prefix := 0
+	for prefix < len(old) && prefix < len(d.text) && old[prefix] == d.text[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(old)-prefix && suffix < len(d.text)-prefix && old[len(old)-1-suffix] == d.text[len(d.text)-1-suffix] {
+		suffix++
+	}
+
+	switch {
+	case offset <= prefix:
+		return offset, true
+	case offset >= len(d.text)-suffix:
+		return offset - len(d.text) + len(old), true
+	}
+	return -1, false
+}
+
+func (d *document) rangeOf(offset int, length int) Range {
+	return Range{Start: d.position(offset), End: d.position(offset + length)}
+}
+
+func isIdentStart(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == '$'
+}
+
+func isIdentPart(ch byte) bool {
+	return isIdentStart(ch) || ch >= '0' && ch <= '9'
+}
+
+// identAt returns the identifier starting at the offset
+func identAt(text string, offset int) string {
+	if offset < 0 || offset >= len(text) || !isIdentStart(text[offset]) {
+		return ""
+	}
+
+	end := offset + 1
+	for end < len(text) && isIdentPart(text[end]) {
+		end++
+	}
+
+	return text[offset:end]
+}
+
+// wordAround returns the start offset and the identifier containing or ending at the offset
+func wordAround(text string, offset int) (int, string) {
+	offset = min(max(offset, 0), len(text))
+
+	start := offset
+	for start > 0 && isIdentPart(text[start-1]) {
+		start--
+	}
+	for start < offset && !isIdentStart(text[start]) {
+		start++
+	}
+
+	end := offset
+	for end < len(text) && isIdentPart(text[end]) {
+		end++
+	}
+
+	return start, text[start:end]
+}
+
+// scanTokens calls fn with the offset of every identifier and brace after from,
+// skipping comments and strings, until fn returns false
+func scanTokens(text string, from int, fn func(offset int) bool) {
+	for i := from; i < len(text); {
+		ch := text[i]
+
+		switch {
+		case ch == '#':
+			for i < len(text) && text[i] != '\n' {
+				i++
+			}
+		case ch == '"':
+			i++
+			for i < len(text) && text[i] != '"' && text[i] != '\n' {
+				if text[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			i++
+		case ch == '`':
+			i++
+			for i < len(text) && text[i] != '`' {
+				i++
+			}
+			i++
+		case isIdentStart(ch):
+			if !fn(i) {
+				return
+			}
+			i += len(identAt(text, i))
+		case ch == '{' || ch == '}':
+			if !fn(i) {
+				return
+			}
+			i++
+		default:
+			i++
+		}
+	}
+}
+
+// findIdent returns the offset of the first identifier with the given name after from, or -1
+func findIdent(text string, from int, name string) int {
+	found := -1
+	scanTokens(text, from, func(offset int) bool {
+		if identAt(text, offset) == name {
+			found = offset
+			return false
+		}
+		return true
+	})
+
+	return found
+}
+
+// matchBrace returns the offset right after the brace closing the one at open, or the text length
+func matchBrace(text string, open int) int {
+	end := len(text)
+	depth := 0
+	scanTokens(text, open, func(offset int) bool {
+		switch text[offset] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				end = offset + 1
+				return false
+			}
+		}
+		return true
+	})
+
+	return end
+}
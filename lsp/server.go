@@ -0,0 +1,449 @@
+// Package lsp implements a language server for refl, speaking the Language Server Protocol over a stream
+package lsp
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"refl/ast"
+	"refl/runtime/eval"
+	"sort"
+	"strings"
+)
+
+var keywords = []string{"await", "break", "continue", "elif", "else", "for", "fun", "if", "in", "nil", "return", "var", "while"}
+
+// Server is a language server handling one client
+type Server struct {
+	conn     *conn
+	docs     map[string]*document
+	builtins map[string][]string
+	shutdown bool
+}
+
+func NewServer(in io.Reader, out io.Writer) *Server {
+	return &Server{
+		conn:     newConn(in, out),
+		docs:     make(map[string]*document),
+		builtins: eval.Builtins(),
+	}
+}
+
+// Run serves requests until the client sends exit or closes the stream
+func (s *Server) Run() error {
+	for {
+		body, err := s.conn.read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var msg message
+		if err := json.Unmarshal(body, &msg); err != nil {
+			if err := s.reply(nil, nil, &responseError{Code: codeParseError, Message: err.Error()}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if msg.Method == "exit" {
+			return nil
+		}
+
+		result, err := s.handle(msg.Method, msg.Params)
+
+		// notifications don't get a response
+		if msg.ID == nil {
+			continue
+		}
+
+		if err := s.reply(msg.ID, result, err); err != nil {
+			return err
+		}
+	}
+}
+
+func (s *Server) reply(id *json.RawMessage, result any, err error) error {
+	resp := response{JSONRPC: "2.0", ID: id, Result: result}
+
+	if err != nil {
+		var respErr *responseError
+		if !errors.As(err, &respErr) {
+			respErr = &responseError{Code: codeInvalidRequest, Message: err.Error()}
+		}
+		resp.Result = nil
+		resp.Error = respErr
+	}
+
+	return s.conn.write(resp)
+}
+
+func (s *Server) notify(method string, params any) error {
+	return s.conn.write(notification{JSONRPC: "2.0", Method: method, Params: params})
+}
+
+func decode[T any](params json.RawMessage) (T, error) {
+	var result T
+	if err := json.Unmarshal(params, &result); err != nil {
+		return result, &responseError{Code: codeInvalidParams, Message: err.Error()}
+	}
+	return result, nil
+}
+
+func (s *Server) handle(method string, params json.RawMessage) (any, error) {
+	if s.shutdown && method != "exit" {
+		return nil, &responseError{Code: codeInvalidRequest, Message: "server is shut down"}
+	}
+
+	switch method {
+	case "initialize":
+		return s.initialize(), nil
+	case "initialized":
+		return nil, nil
+	case "shutdown":
+		s.shutdown = true
+		return nil, nil
+	case "textDocument/didOpen":
+		p, err := decode[DidOpenTextDocumentParams](params)
+		if err != nil {
+			return nil, err
+		}
+		return nil, s.update(p.TextDocument.URI, p.TextDocument.Text)
+	case "textDocument/didChange":
+		p, err := decode[DidChangeTextDocumentParams](params)
+		if err != nil || len(p.ContentChanges) == 0 {
+			return nil, err
+		}
+		return nil, s.update(p.TextDocument.URI, p.ContentChanges[len(p.ContentChanges)-1].Text)
+	case "textDocument/didClose":
+		p, err := decode[DidCloseTextDocumentParams](params)
+		if err != nil {
+			return nil, err
+		}
+		delete(s.docs, p.TextDocument.URI)
+		return nil, s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+			URI:         p.TextDocument.URI,
+			Diagnostics: []Diagnostic{},
+		})
+	case "textDocument/documentSymbol":
+		p, err := decode[DocumentSymbolParams](params)
+		if err != nil {
+			return nil, err
+		}
+		return s.documentSymbols(p.TextDocument.URI), nil
+	case "textDocument/definition":
+		p, err := decode[TextDocumentPositionParams](params)
+		if err != nil {
+			return nil, err
+		}
+		return s.definition(p), nil
+	case "textDocument/references":
+		p, err := decode[ReferenceParams](params)
+		if err != nil {
+			return nil, err
+		}
+		return s.references(p), nil
+	case "textDocument/hover":
+		p, err := decode[TextDocumentPositionParams](params)
+		if err != nil {
+			return nil, err
+		}
+		return s.hover(p), nil
+	case "textDocument/completion":
+		p, err := decode[TextDocumentPositionParams](params)
+		if err != nil {
+			return nil, err
+		}
+		return s.completion(p), nil
+	}
+
+	return nil, &responseError{Code: codeMethodNotFound, Message: "method not found: " + method}
+}
+
+func (s *Server) initialize() any {
+	return map[string]any{
+		"capabilities": map[string]any{
+			"textDocumentSync":       1,
+			"documentSymbolProvider": true,
+			"definitionProvider":     true,
+			"referencesProvider":     true,
+			"hoverProvider":          true,
+			"completionProvider": map[string]any{
+				"triggerCharacters": []string{".", ":"},
+			},
+		},
+		"serverInfo": map[string]any{
+			"name": "refl",
+		},
+	}
+}
+
+func (s *Server) update(uri, text string) error {
+	doc := newDocument(uri, text, s.docs[uri])
+	s.docs[uri] = doc
+
+	return s.notify("textDocument/publishDiagnostics", PublishDiagnosticsParams{
+		URI:         uri,
+		Diagnostics: doc.diagnostics,
+	})
+}
+
+// lookup returns the analysis of the document along with the cursor offset in the analyzed text.
+// A stale analysis is left out: its results would be positions in an older text.
+func (s *Server) lookup(uri string, pos Position) (*analysis, int) {
+	doc := s.docs[uri]
+	if doc == nil || doc.analysis == nil || doc.stale() {
+		return nil, -1
+	}
+
+	return doc.analysis, doc.offset(pos)
+}
+
+func (s *Server) documentSymbols(uri string) []DocumentSymbol {
+	result := []DocumentSymbol{}
+
+	doc := s.docs[uri]
+	if doc == nil || doc.analysis == nil || doc.stale() {
+		return result
+	}
+
+	a := doc.analysis
+	for _, stmt := range a.program.Statements {
+		decl, ok := stmt.(*ast.VarDeclaration)
+		if !ok || decl.Pattern != nil {
+			continue
+		}
+
+		start := a.doc.astOffset(decl.Pos)
+		nameOffset := findIdent(a.doc.text, start, decl.Name)
+		sym := a.refs[nameOffset]
+		if sym == nil {
+			continue
+		}
+
+		kind := SymbolKindVariable
+		end := strings.IndexByte(a.doc.text[start:], '\n')
+		if end < 0 {
+			end = len(a.doc.text)
+		} else {
+			end += start
+		}
+
+		if fn, ok := decl.Value.(*ast.FunctionLiteral); ok {
+			kind = SymbolKindFunction
+			end = matchBrace(a.doc.text, a.doc.astOffset(fn.Body.Pos))
+		}
+
+		result = append(result, DocumentSymbol{
+			Name:           decl.Name,
+			Detail:         a.describe(sym),
+			Kind:           kind,
+			Range:          Range{Start: a.doc.position(start), End: a.doc.position(end)},
+			SelectionRange: a.doc.rangeOf(nameOffset, len(decl.Name)),
+		})
+	}
+
+	return result
+}
+
+func (s *Server) definition(p TextDocumentPositionParams) *Location {
+	a, offset := s.lookup(p.TextDocument.URI, p.Position)
+	if a == nil {
+		return nil
+	}
+
+	sym, _ := a.symbolAt(offset)
+	if sym == nil || !sym.declared() {
+		return nil
+	}
+
+	return &Location{URI: p.TextDocument.URI, Range: a.doc.rangeOf(sym.offset, len(sym.name))}
+}
+
+func (s *Server) references(p ReferenceParams) []Location {
+	result := []Location{}
+
+	a, offset := s.lookup(p.TextDocument.URI, p.Position)
+	if a == nil {
+		return result
+	}
+
+	sym, _ := a.symbolAt(offset)
+	if sym == nil {
+		return result
+	}
+
+	var offsets []int
+	if p.Context.IncludeDeclaration && sym.declared() {
+		offsets = append(offsets, sym.offset)
+	}
+	for _, ref := range sym.refs {
+		if ref != sym.offset {
+			offsets = append(offsets, ref)
+		}
+	}
+	sort.Ints(offsets)
+
+	for _, ref := range offsets {
+		result = append(result, Location{URI: p.TextDocument.URI, Range: a.doc.rangeOf(ref, len(sym.name))})
+	}
+
+	return result
+}
+
+// moduleBefore returns the builtin module whose member starts at the offset of the text, as in `math.abs`
+// or `obj:method`. analyzed is the offset in the analysis text, used to find user variables shadowing the module.
+func (s *Server) moduleBefore(a *analysis, text string, offset, analyzed int) string {
+	if offset == 0 || (text[offset-1] != '.' && text[offset-1] != ':') {
+		return ""
+	}
+
+	start, name := wordAround(text, offset-1)
+	if name == "" || len(s.builtins[name]) == 0 {
+		return ""
+	}
+
+	// a user variable shadowing the module
+	if a != nil {
+		start := max(analyzed-(offset-start), 0)
+		if sym := a.global.innermost(start).lookup(name, start); sym != nil {
+			return ""
+		}
+	}
+
+	return name
+}
+
+// memberPath returns the path of the top-level variable whose member starts at the offset,
+// as `shapes` in `shapes.area` or `shapes.nested` in `shapes.nested:method`
+func memberPath(a *analysis, offset int) string {
+	text := a.doc.text
+	var parts []string
+
+	for offset > 0 && (text[offset-1] == '.' || text[offset-1] == ':' && len(parts) == 0) {
+		start, word := wordAround(text, offset-1)
+		if word == "" || start+len(word) != offset-1 {
+			return ""
+		}
+		parts = append([]string{word}, parts...)
+		offset = start
+	}
+
+	if len(parts) == 0 {
+		return ""
+	}
+
+	// the root must be the top-level variable, not a local shadowing it
+	sym := a.refs[offset]
+	if sym == nil || sym.kind != symbolVar || a.global.lookup(sym.name, offset) != sym {
+		return ""
+	}
+
+	return strings.Join(parts, ".")
+}
+
+func (s *Server) hover(p TextDocumentPositionParams) *Hover {
+	a, offset := s.lookup(p.TextDocument.URI, p.Position)
+	if a == nil {
+		return nil
+	}
+
+	start, word := wordAround(a.doc.text, offset)
+	if word == "" {
+		return nil
+	}
+
+	var text string
+	if module := s.moduleBefore(a, a.doc.text, start, start); module != "" {
+		text, _ = eval.BuiltinDoc(module + "." + word)
+	} else if path := memberPath(a, start); path != "" {
+		text = a.describeMember(path + "." + word)
+	} else if sym := a.refs[start]; sym != nil {
+		text = a.describe(sym)
+	}
+
+	if text == "" {
+		return nil
+	}
+
+	r := a.doc.rangeOf(start, len(word))
+	return &Hover{
+		Contents: MarkupContent{Kind: "markdown", Value: text},
+		Range:    &r,
+	}
+}
+
+func (s *Server) completion(p TextDocumentPositionParams) []CompletionItem {
+	result := []CompletionItem{}
+
+	doc := s.docs[p.TextDocument.URI]
+	if doc == nil {
+		return result
+	}
+
+	offset := doc.offset(p.Position)
+	start := offset
+	for start > 0 && isIdentPart(doc.text[start-1]) {
+		start--
+	}
+
+	// the analysis may be stale, the symbols visible at the start of the word are those of the analyzed text
+	a, analyzed := doc.analysis, -1
+	if a != nil {
+		var ok bool
+		if analyzed, ok = doc.analysisOffset(start); !ok {
+			a = nil
+		}
+	}
+
+	if module := s.moduleBefore(a, doc.text, start, analyzed); module != "" {
+		for _, member := range s.builtins[module] {
+			item := CompletionItem{Label: member, Kind: CompletionKindFunction}
+			item.Documentation, _ = eval.BuiltinDoc(module + "." + member)
+			result = append(result, item)
+		}
+		return result
+	}
+
+	if start > 0 && (doc.text[start-1] == '.' || doc.text[start-1] == ':') {
+		return result
+	}
+
+	seen := make(map[string]bool)
+	if a != nil {
+		for _, sym := range a.visible(analyzed) {
+			seen[sym.name] = true
+
+			item := CompletionItem{Label: sym.name, Kind: CompletionKindVariable, Detail: a.describe(sym)}
+			if _, ok := sym.value.(*ast.FunctionLiteral); ok {
+				item.Kind = CompletionKindFunction
+			}
+			result = append(result, item)
+		}
+	}
+
+	for name, members := range s.builtins {
+		if seen[name] {
+			continue
+		}
+
+		item := CompletionItem{Label: name, Kind: CompletionKindFunction}
+		if len(members) > 0 {
+			item.Kind = CompletionKindModule
+		}
+		item.Documentation, _ = eval.BuiltinDoc(name)
+		result = append(result, item)
+	}
+
+	for _, keyword := range keywords {
+		result = append(result, CompletionItem{Label: keyword, Kind: CompletionKindKeyword})
+	}
+
+	sort.SliceStable(result, func(i, j int) bool {
+		return result[i].Label < result[j].Label
+	})
+
+	return result
+}
@@ -0,0 +1,320 @@
+package lsp
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testClient struct {
+	t      *testing.T
+	conn   *conn
+	nextID int
+	done   chan error
+}
+
+func newTestClient(t *testing.T) *testClient {
+	clientIn, serverOut := io.Pipe()
+	serverIn, clientOut := io.Pipe()
+
+	server := NewServer(serverIn, serverOut)
+	c := &testClient{t: t, conn: newConn(clientIn, clientOut), done: make(chan error, 1)}
+
+	go func() {
+		c.done <- server.Run()
+		serverOut.Close()
+	}()
+
+	t.Cleanup(func() {
+		clientOut.Close()
+	})
+
+	return c
+}
+
+func (c *testClient) notify(method string, params any) {
+	require.NoError(c.t, c.conn.write(notification{JSONRPC: "2.0", Method: method, Params: params}))
+}
+
+// call sends a request and decodes the result of its response into result
+func (c *testClient) call(method string, params any, result any) *responseError {
+	c.nextID++
+	id := json.RawMessage(strconv.Itoa(c.nextID))
+	require.NoError(c.t, c.conn.write(map[string]any{"jsonrpc": "2.0", "id": &id, "method": method, "params": params}))
+
+	for {
+		body, err := c.conn.read()
+		require.NoError(c.t, err)
+
+		var msg struct {
+			ID     *json.RawMessage `json:"id"`
+			Result json.RawMessage  `json:"result"`
+			Error  *responseError   `json:"error"`
+		}
+		require.NoError(c.t, json.Unmarshal(body, &msg))
+
+		// skip notifications such as diagnostics
+		if msg.ID == nil {
+			continue
+		}
+
+		require.Equal(c.t, string(id), string(*msg.ID))
+		if msg.Error != nil {
+			return msg.Error
+		}
+		if result != nil {
+			require.NoError(c.t, json.Unmarshal(msg.Result, result))
+		}
+		return nil
+	}
+}
+
+// diagnostics reads messages until diagnostics for the uri are published
+func (c *testClient) diagnostics(uri string) []Diagnostic {
+	for {
+		body, err := c.conn.read()
+		require.NoError(c.t, err)
+
+		var msg struct {
+			Method string                   `json:"method"`
+			Params PublishDiagnosticsParams `json:"params"`
+		}
+		require.NoError(c.t, json.Unmarshal(body, &msg))
+
+		if msg.Method == "textDocument/publishDiagnostics" && msg.Params.URI == uri {
+			return msg.Params.Diagnostics
+		}
+	}
+}
+
+func (c *testClient) open(uri, text string) []Diagnostic {
+	c.notify("textDocument/didOpen", DidOpenTextDocumentParams{
+		TextDocument: TextDocumentItem{URI: uri, LanguageID: "refl", Version: 1, Text: text},
+	})
+	return c.diagnostics(uri)
+}
+
+func at(uri string, line, character int) TextDocumentPositionParams {
+	return TextDocumentPositionParams{
+		TextDocument: TextDocumentIdentifier{URI: uri},
+		Position:     Position{Line: line, Character: character},
+	}
+}
+
+const testSource = `var total = 0
+var add = fun(x) {
+  total = total + x
+  return total
+}
+for i, n in range(3) {
+  var total = i
+  add(total)
+}
+io.println(len("abc"))
+`
+
+func TestServer(t *testing.T) {
+	const uri = "file:///test.refl"
+
+	c := newTestClient(t)
+
+	var initResult struct {
+		Capabilities map[string]any `json:"capabilities"`
+	}
+	require.Nil(t, c.call("initialize", map[string]any{}, &initResult))
+	require.Equal(t, true, initResult.Capabilities["hoverProvider"])
+	c.notify("initialized", map[string]any{})
+
+	t.Run("diagnostics", func(t *testing.T) {
+		diagnostics := c.open("file:///broken.refl", "var x = 1\nvar = 2\nvar y = )\n")
+		require.Len(t, diagnostics, 2)
+		require.Equal(t, Range{Start: Position{Line: 1, Character: 4}, End: Position{Line: 1, Character: 5}}, diagnostics[0].Range)
+		require.Equal(t, Range{Start: Position{Line: 2, Character: 8}, End: Position{Line: 2, Character: 9}}, diagnostics[1].Range)
+		require.Equal(t, SeverityError, diagnostics[0].Severity)
+		require.Contains(t, diagnostics[0].Message, "'='")
+
+		c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   TextDocumentIdentifier{URI: "file:///broken.refl"},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: "var x = 1\nvar y = 2\n"}},
+		})
+		require.Empty(t, c.diagnostics("file:///broken.refl"))
+
+		require.Empty(t, c.open(uri, testSource))
+	})
+
+	t.Run("document symbols", func(t *testing.T) {
+		var symbols []DocumentSymbol
+		require.Nil(t, c.call("textDocument/documentSymbol", DocumentSymbolParams{TextDocument: TextDocumentIdentifier{URI: uri}}, &symbols))
+		require.Len(t, symbols, 2)
+		require.Equal(t, "total", symbols[0].Name)
+		require.Equal(t, SymbolKindVariable, symbols[0].Kind)
+		require.Equal(t, "add", symbols[1].Name)
+		require.Equal(t, SymbolKindFunction, symbols[1].Kind)
+		require.Equal(t, Range{Start: Position{Line: 1, Character: 0}, End: Position{Line: 4, Character: 1}}, symbols[1].Range)
+	})
+
+	t.Run("definition", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			pos      TextDocumentPositionParams
+			expected *Range
+		}{
+			{"global from function", at(uri, 2, 10), &Range{Start: Position{Line: 0, Character: 4}, End: Position{Line: 0, Character: 9}}},
+			{"parameter", at(uri, 2, 19), &Range{Start: Position{Line: 1, Character: 14}, End: Position{Line: 1, Character: 15}}},
+			{"shadowing local", at(uri, 7, 7), &Range{Start: Position{Line: 6, Character: 6}, End: Position{Line: 6, Character: 11}}},
+			{"loop variable", at(uri, 6, 15), &Range{Start: Position{Line: 5, Character: 4}, End: Position{Line: 5, Character: 5}}},
+			{"builtin", at(uri, 9, 12), nil},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var location *Location
+				require.Nil(t, c.call("textDocument/definition", tt.pos, &location))
+				if tt.expected == nil {
+					require.Nil(t, location)
+					return
+				}
+				require.NotNil(t, location)
+				require.Equal(t, uri, location.URI)
+				require.Equal(t, *tt.expected, location.Range)
+			})
+		}
+	})
+
+	t.Run("references", func(t *testing.T) {
+		params := ReferenceParams{TextDocumentPositionParams: at(uri, 0, 5)}
+		params.Context.IncludeDeclaration = true
+
+		var locations []Location
+		require.Nil(t, c.call("textDocument/references", params, &locations))
+
+		var lines []int
+		for _, location := range locations {
+			lines = append(lines, location.Range.Start.Line)
+		}
+		require.Equal(t, []int{0, 2, 2, 3}, lines)
+
+		params.Context.IncludeDeclaration = false
+		require.Nil(t, c.call("textDocument/references", params, &locations))
+		require.Len(t, locations, 3)
+	})
+
+	t.Run("hover", func(t *testing.T) {
+		tests := []struct {
+			name     string
+			pos      TextDocumentPositionParams
+			expected string
+		}{
+			{"builtin", at(uri, 9, 12), "len(value) - returns the length of a string or an object"},
+			{"module member", at(uri, 9, 5), "io.println(values...) - prints the values separated by spaces and a newline"},
+			{"function", at(uri, 7, 3), "var add = fun(x)"},
+			{"parameter", at(uri, 1, 14), "(parameter) x"},
+			{"nothing", at(uri, 9, 15), ""},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var hover *Hover
+				require.Nil(t, c.call("textDocument/hover", tt.pos, &hover))
+				if tt.expected == "" {
+					require.Nil(t, hover)
+					return
+				}
+				require.NotNil(t, hover)
+				require.Equal(t, tt.expected, hover.Contents.Value)
+			})
+		}
+	})
+
+	t.Run("doc comments", func(t *testing.T) {
+		const docURI = "file:///docs.refl"
+		require.Empty(t, c.open(docURI, "## Adds two numbers.\nvar add = fun(a, b) { return a + b }\nvar shapes = {\n  ## Area of a square.\n  area: fun(self, side) { return side * side }\n}\nio.println(add(1, 2), shapes:area(2))\n"))
+
+		tests := []struct {
+			name     string
+			pos      TextDocumentPositionParams
+			expected string
+		}{
+			{"declaration", at(docURI, 1, 5), "var add = fun(a, b)\n\nAdds two numbers."},
+			{"reference", at(docURI, 6, 12), "var add = fun(a, b)\n\nAdds two numbers."},
+			{"method", at(docURI, 6, 30), "shapes:area(side)\n\nArea of a square."},
+		}
+
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				var hover *Hover
+				require.Nil(t, c.call("textDocument/hover", tt.pos, &hover))
+				require.NotNil(t, hover)
+				require.Equal(t, tt.expected, hover.Contents.Value)
+			})
+		}
+	})
+
+	t.Run("completion", func(t *testing.T) {
+		labels := func(items []CompletionItem) map[string]int {
+			result := make(map[string]int)
+			for _, item := range items {
+				result[item.Label] = item.Kind
+			}
+			return result
+		}
+
+		var items []CompletionItem
+		require.Nil(t, c.call("textDocument/completion", at(uri, 9, 3), &items))
+		members := labels(items)
+		require.Contains(t, members, "println")
+		require.Contains(t, members, "printf")
+		require.NotContains(t, members, "total")
+
+		require.Nil(t, c.call("textDocument/completion", at(uri, 3, 2), &items))
+		identifiers := labels(items)
+		require.Equal(t, CompletionKindVariable, identifiers["x"])
+		require.Equal(t, CompletionKindFunction, identifiers["add"])
+		require.Equal(t, CompletionKindModule, identifiers["math"])
+		require.Equal(t, CompletionKindKeyword, identifiers["return"])
+		require.NotContains(t, identifiers, "i")
+	})
+
+	t.Run("edits while broken", func(t *testing.T) {
+		const brokenURI = "file:///editing.refl"
+		require.Empty(t, c.open(brokenURI, "var total = 1\nvar add = fun(x) {\n  return x\n}\nadd(total)\n"))
+
+		// a broken line above shifts every symbol down
+		c.notify("textDocument/didChange", DidChangeTextDocumentParams{
+			TextDocument:   TextDocumentIdentifier{URI: brokenURI},
+			ContentChanges: []TextDocumentContentChangeEvent{{Text: "var = 0\nvar total = 1\nvar add = fun(x) {\n  return x\n}\nadd(total)\n"}},
+		})
+		require.NotEmpty(t, c.diagnostics(brokenURI))
+
+		// positions of the new text can't be resolved against the analysis of the old one
+		var hover *Hover
+		require.Nil(t, c.call("textDocument/hover", at(brokenURI, 1, 5), &hover))
+		require.Nil(t, hover)
+		var location *Location
+		require.Nil(t, c.call("textDocument/definition", at(brokenURI, 1, 5), &location))
+		require.Nil(t, location)
+
+		// completion maps the cursor past the edit
+		var items []CompletionItem
+		require.Nil(t, c.call("textDocument/completion", at(brokenURI, 3, 9), &items))
+		labels := make(map[string]bool)
+		for _, item := range items {
+			labels[item.Label] = true
+		}
+		require.True(t, labels["x"])
+		require.True(t, labels["total"])
+	})
+
+	t.Run("unknown method", func(t *testing.T) {
+		err := c.call("workspace/unknown", map[string]any{}, nil)
+		require.NotNil(t, err)
+		require.Equal(t, codeMethodNotFound, err.Code)
+	})
+
+	require.Nil(t, c.call("shutdown", nil, nil))
+	c.notify("exit", nil)
+	require.NoError(t, <-c.done)
+}
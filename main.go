@@ -4,29 +4,184 @@ import (
 	"bufio"
 	"context"
 	"errors"
+	"flag"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"refl/ast"
+	"refl/dap"
+	"refl/doc"
+	"refl/lsp"
+	"refl/optimize"
 	"refl/parser"
 	"refl/runtime"
 	"refl/runtime/eval"
 	"refl/runtime/objects"
+	"refl/testrunner"
+	"regexp"
+	"slices"
 	"strings"
 	"time"
 )
 
 func main() {
+	if len(os.Args) == 2 && os.Args[1] == "lsp" {
+		if err := lsp.NewServer(os.Stdin, os.Stdout).Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Language server error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) == 3 && os.Args[1] == "debug" {
+		if err := dap.NewServer(os.Stdin, os.Stdout, os.Args[2]).Run(); err != nil {
+			fmt.Fprintf(os.Stderr, "Debug adapter error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "test" {
+		testCommand(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "doc" {
+		docCommand(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "run" {
+		runCommand(os.Args[2:])
+		return
+	}
+
 	if len(os.Args) > 2 {
-		fmt.Fprintf(os.Stderr, "Usage: %s [file]\n", os.Args[0])
+		usage()
+	}
+
+	filename := ""
+	if len(os.Args) == 2 {
+		filename = os.Args[1]
+	}
+
+	runFile(filename, "", "", false)
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: %[1]s [file]\n       %[1]s run [--profile out.pprof] [--coverage out.lcov] [--no-optimize] file\n       %[1]s test [--timeout 5s] [--format text|tap|junit] [--run regexp] [paths...]\n       %[1]s doc [--format markdown|html|json] [-o file] [paths...]\n       %[1]s lsp\n       %[1]s debug file\n", os.Args[0])
+	os.Exit(1)
+}
+
+func runCommand(args []string) {
+	flags := flag.NewFlagSet("run", flag.ExitOnError)
+	profilePath := flags.String("profile", "", "write a pprof profile of the script's calls to the file")
+	coveragePath := flags.String("coverage", "", "write the script's line coverage in the lcov format to the file")
+	noOptimize := flags.Bool("no-optimize", false, "run the script as written, without folding constants and removing dead code, implied by --profile and --coverage")
+	_ = flags.Parse(args)
+
+	if flags.NArg() != 1 {
+		usage()
+	}
+
+	runFile(flags.Arg(0), *profilePath, *coveragePath, *noOptimize)
+}
+
+// testCommand runs the tests of the *_test.refl files in the paths, the current directory by default
+func testCommand(args []string) {
+	flags := flag.NewFlagSet("test", flag.ExitOnError)
+	timeout := flags.Duration("timeout", testrunner.DefaultTimeout, "the time limit of each test")
+	format := flags.String("format", "text", "the report format: "+strings.Join(testrunner.Formats, ", "))
+	run := flags.String("run", "", "run only the tests whose names match the regular expression")
+	_ = flags.Parse(args)
+
+	if !slices.Contains(testrunner.Formats, *format) {
+		fmt.Fprintf(os.Stderr, "Invalid --format %q, expected one of %s\n", *format, strings.Join(testrunner.Formats, ", "))
+		usage()
+	}
+
+	runner := &testrunner.Runner{Timeout: *timeout}
+	if *run != "" {
+		filter, err := regexp.Compile(*run)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid --run pattern: %v\n", err)
+			os.Exit(1)
+		}
+		runner.Filter = filter
+	}
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	results, err := runner.Run(context.Background(), paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding tests: %v\n", err)
+		os.Exit(1)
+	}
+
+	if err := testrunner.Write(os.Stdout, *format, results); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing report: %v\n", err)
+		os.Exit(1)
+	}
+
+	if testrunner.Failed(results) > 0 {
+		os.Exit(1)
+	}
+}
+
+// docCommand documents the .refl files in the paths, the current directory by default
+func docCommand(args []string) {
+	flags := flag.NewFlagSet("doc", flag.ExitOnError)
+	format := flags.String("format", "markdown", "the output format: "+strings.Join(doc.Formats, ", "))
+	output := flags.String("o", "", "write the documentation to the file instead of stdout")
+	_ = flags.Parse(args)
+
+	paths := flags.Args()
+	if len(paths) == 0 {
+		paths = []string{"."}
+	}
+
+	filenames, err := doc.Discover(paths)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error finding files: %v\n", err)
+		os.Exit(1)
+	}
+
+	var files []*doc.File
+	for _, filename := range filenames {
+		file, err := doc.ParseFile(filename)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error parsing file: %v\n", err)
+			os.Exit(1)
+		}
+		files = append(files, file)
+	}
+
+	w := os.Stdout
+	if *output != "" {
+		w, err = os.Create(*output)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error creating file: %v\n", err)
+			os.Exit(1)
+		}
+		defer w.Close()
+	}
+
+	if err := doc.Write(w, *format, files); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing documentation: %v\n", err)
 		os.Exit(1)
 	}
+}
 
+// runFile runs the file, or a line read from stdin if filename is empty, and exits on errors
+func runFile(filename, profilePath, coveragePath string, noOptimize bool) {
 	var source string
 	var err error
 
-	if len(os.Args) == 2 {
-		filename := os.Args[1]
+	if filename != "" {
 		if !strings.HasSuffix(filename, ".refl") {
 			filename += ".refl"
 		}
@@ -45,12 +200,39 @@ func main() {
 
 	program, parseErr := parseSource(source)
 	if parseErr != nil {
-		fmt.Fprintf(os.Stderr, "Parse error: %v\n", parseErr)
+		var syntaxErrs parser.ErrorList
+		if !errors.As(parseErr, &syntaxErrs) {
+			fmt.Fprintf(os.Stderr, "Parse error: %v\n", parseErr)
+			os.Exit(1)
+		}
+
+		for _, syntaxErr := range syntaxErrs {
+			fmt.Fprintf(os.Stderr, "Parse error: %v\n%s\n", syntaxErr, syntaxErr.Excerpt)
+		}
 		os.Exit(1)
 	}
 
+	// profiles and coverage report the statements as written, including those the optimizer removes
+	profiling := profilePath != "" || coveragePath != ""
+	program = optimize.Program(program, optimize.OptionDisabled{Disabled: noOptimize || profiling})
+
+	var opts []eval.Option
+	var profiler *eval.Profiler
+	if profiling {
+		profiler = eval.NewProfiler(filename, program)
+		opts = append(opts, eval.OptionProfiler{Profiler: profiler})
+	}
+
 	env := createGlobalEnvironment()
-	result, runtimeErr := executeProgram(program, env)
+	result, runtimeErr := executeProgram(program, env, opts...)
+
+	if profiler != nil {
+		profiler.Stop()
+		if err := writeProfile(profiler, profilePath, coveragePath); err != nil {
+			fmt.Fprintf(os.Stderr, "Error writing profile: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	if runtimeErr != nil {
 		fmt.Fprintf(os.Stderr, "%v\n", runtimeErr)
@@ -64,6 +246,36 @@ func main() {
 	}
 }
 
+func writeProfile(profiler *eval.Profiler, profilePath, coveragePath string) error {
+	if profilePath != "" {
+		if err := writeFile(profilePath, profiler.Profile().WritePprof); err != nil {
+			return err
+		}
+	}
+
+	if coveragePath != "" {
+		if err := writeFile(coveragePath, profiler.Coverage().WriteLCOV); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func writeFile(path string, write func(w io.Writer) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	if err := write(f); err != nil {
+		f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
 func readFile(filename string) (string, error) {
 	content, err := os.ReadFile(filename)
 	if err != nil {
@@ -116,11 +328,11 @@ func createGlobalEnvironment() *runtime.Environment {
 	return runtime.NewEnvironment(nil)
 }
 
-func executeProgram(program *ast.Program, env *runtime.Environment) (runtime.Object, error) {
+func executeProgram(program *ast.Program, env *runtime.Environment, opts ...eval.Option) (runtime.Object, error) {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	evaluator := eval.New(ctx, program, env)
+	evaluator := eval.New(ctx, program, env, opts...)
 	result, err := evaluator.Run()
 	if err != nil {
 		return nil, err
@@ -0,0 +1,264 @@
+// Package optimize rewrites programs before evaluation: it folds operations on literals and removes code that never runs
+package optimize
+
+import (
+	"math"
+	"refl/ast"
+	"refl/runtime"
+	"refl/runtime/objects"
+)
+
+type Options struct {
+	disabled bool
+}
+
+type Option interface {
+	Apply(*Options)
+}
+
+// OptionDisabled leaves programs as they are, for callers that need the tree to match the source,
+// such as debuggers stopping on every line
+type OptionDisabled struct {
+	Disabled bool
+}
+
+func (o OptionDisabled) Apply(opts *Options) {
+	opts.disabled = o.Disabled
+}
+
+// Program optimizes the program in place and returns it:
+//   - unary and binary operations on number, string and nil literals are folded into a literal,
+//     with the semantics of objects.Number and objects.String. Operations that fail at runtime are kept,
+//     so that they fail with their position.
+//   - && and || with a literal left operand are replaced with the operand they evaluate to
+//   - if and elif branches with a falsy literal condition are removed, a truthy one becomes the last branch
+//   - while loops with a falsy literal condition are removed
+//   - statements after return, break and continue in a block are removed
+func Program(program *ast.Program, opts ...Option) *ast.Program {
+	var options Options
+	for _, opt := range opts {
+		opt.Apply(&options)
+	}
+
+	if options.disabled {
+		return program
+	}
+
+	ast.Apply(program, nil, func(c *ast.Cursor) bool {
+		switch n := c.Node().(type) {
+		case *ast.UnaryExpression:
+			if folded := foldUnary(n); folded != nil {
+				c.Replace(folded)
+			}
+		case *ast.BinaryExpression:
+			if folded := foldBinary(n); folded != nil {
+				c.Replace(folded)
+			}
+		case *ast.IfStatement:
+			pruneIf(c, n)
+		case *ast.WhileStatement:
+			if value, ok := literal(n.Condition); ok && !value.Truthy() {
+				remove(c)
+			}
+		case *ast.BlockStatement:
+			n.Statements = reachable(n.Statements)
+		}
+		return true
+	})
+
+	return program
+}
+
+// reachable returns the statements of a block up to the first return, break or continue
+func reachable(stmts []ast.Statement) []ast.Statement {
+	for i, stmt := range stmts {
+		switch stmt.(type) {
+		case *ast.ReturnStatement, *ast.BreakStatement, *ast.ContinueStatement:
+			return stmts[:i+1]
+		}
+	}
+	return stmts
+}
+
+// literal returns the value of a literal expression
+func literal(expr ast.Expression) (runtime.Object, bool) {
+	switch e := expr.(type) {
+	case *ast.NumberLiteral:
+		return objects.NewNumber(e.Value), true
+	case *ast.StringLiteral:
+		return objects.NewString(e.Value), true
+	case *ast.RawStringLiteral:
+		return objects.NewString(e.Value), true
+	case *ast.NilLiteral:
+		return objects.NilInstance, true
+	}
+	return nil, false
+}
+
+// expression returns the literal of a folded value, or nil if it can't be written as one
+func expression(value runtime.Object, pos ast.Position) ast.Expression {
+	switch v := value.(type) {
+	case *objects.Number:
+		if math.IsInf(v.Value, 0) || math.IsNaN(v.Value) {
+			return nil
+		}
+		return &ast.NumberLiteral{Pos: pos, Value: v.Value}
+	case *objects.String:
+		return &ast.StringLiteral{Pos: pos, Value: v.Value}
+	case *objects.Nil:
+		return &ast.NilLiteral{Pos: pos}
+	}
+	return nil
+}
+
+func foldUnary(ue *ast.UnaryExpression) ast.Expression {
+	right, ok := literal(ue.Right)
+	if !ok {
+		return nil
+	}
+
+	switch ue.Operator {
+	case "!":
+		return expression(right.Not(), ue.Pos)
+	case "-":
+		if num, ok := right.(*objects.Number); ok {
+			value, err := num.Negate()
+			if err == nil {
+				return expression(value, ue.Pos)
+			}
+		}
+	}
+
+	return nil
+}
+
+func foldBinary(be *ast.BinaryExpression) ast.Expression {
+	left, ok := literal(be.Left)
+	if !ok {
+		return nil
+	}
+
+	// the right operand only runs if the left one doesn't decide the result
+	switch be.Operator {
+	case "&&":
+		if !left.Truthy() {
+			return be.Left
+		}
+		return be.Right
+	case "||":
+		if left.Truthy() {
+			return be.Left
+		}
+		return be.Right
+	}
+
+	right, ok := literal(be.Right)
+	if !ok {
+		return nil
+	}
+
+	value, err := apply(be.Operator, left, right)
+	if err != nil || value == nil {
+		return nil
+	}
+
+	return expression(value, be.Pos)
+}
+
+// apply runs the operator the way the evaluator does, a nil value means the operator doesn't apply to the operands
+func apply(operator string, left, right runtime.Object) (runtime.Object, error) {
+	switch operator {
+	case "==":
+		return objects.NewBoolean(left.Equal(right)), nil
+	case "!=":
+		return objects.NewBoolean(!left.Equal(right)), nil
+	}
+
+	switch l := left.(type) {
+	case *objects.Number:
+		switch operator {
+		case "+":
+			return l.Add(right)
+		case "-":
+			return l.Sub(right)
+		case "*":
+			return l.Mul(right)
+		case "/":
+			return l.Div(right)
+		case "%":
+			return l.Mod(right)
+		case "<":
+			return l.LessThan(right)
+		case ">":
+			return l.GreaterThan(right)
+		case "<=":
+			return l.LessThanEqual(right)
+		case ">=":
+			return l.GreaterThanEqual(right)
+		}
+	case *objects.String:
+		switch operator {
+		case "+":
+			return l.Add(right)
+		case "*":
+			return l.Mul(right)
+		case "<":
+			return l.LessThan(right)
+		case ">":
+			return l.GreaterThan(right)
+		case "<=":
+			return l.LessThanEqual(right)
+		case ">=":
+			return l.GreaterThanEqual(right)
+		}
+	}
+
+	return nil, nil
+}
+
+// pruneIf removes the branches of an if statement whose conditions are falsy literals and the ones
+// following a truthy literal condition, the statement is replaced with its block if only one is left
+func pruneIf(c *ast.Cursor, is *ast.IfStatement) {
+	branches := append([]*ast.ElifStatement{{Pos: is.Pos, Condition: is.Condition, Body: is.Then}}, is.Elif...)
+
+	var kept []*ast.ElifStatement
+	elseBody := is.Else
+	for _, b := range branches {
+		value, ok := literal(b.Condition)
+		if !ok {
+			kept = append(kept, b)
+			continue
+		}
+		if value.Truthy() {
+			elseBody = b.Body
+			break
+		}
+	}
+
+	if len(kept) == len(branches) && elseBody == is.Else {
+		return
+	}
+
+	if len(kept) == 0 {
+		if elseBody == nil {
+			remove(c)
+		} else {
+			c.Replace(elseBody)
+		}
+		return
+	}
+
+	is.Condition, is.Then = kept[0].Condition, kept[0].Body
+	is.Elif = kept[1:]
+	is.Else = elseBody
+}
+
+// remove deletes a statement that evaluates to nil. The last statement of a program gives the result of Run,
+// so it's replaced with nil instead.
+func remove(c *ast.Cursor) {
+	if program, ok := c.Parent().(*ast.Program); ok && c.Index() == len(program.Statements)-1 {
+		c.Replace(&ast.ExpressionStatement{Pos: c.Node().Position(), Expression: &ast.NilLiteral{Pos: c.Node().Position()}})
+		return
+	}
+	c.Delete()
+}
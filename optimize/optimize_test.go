@@ -0,0 +1,100 @@
+package optimize
+
+import (
+	"bytes"
+	"context"
+	"refl/ast"
+	"refl/parser"
+	"refl/runtime"
+	"refl/runtime/eval"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, source string) *ast.Program {
+	program, err := parser.New().Parse(source)
+	require.NoError(t, err)
+	return program
+}
+
+func TestProgram(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"arithmetic", "x = 1 + 2 * 3", "x = 7"},
+		{"modulo and division", "x = 7 % 4 / 2", "x = 1.5"},
+		{"negation", "x = -(2 - 5)", "x = 3"},
+		{"not", `x = !"" + !1`, "x = 1"},
+		{"comparison", `x = {1 < 2, "b" >= "a", 1 == "1", nil != nil}`, "x = {1, 1, 0, 0}"},
+		{"string concatenation", "x = \"a\" + `b` + 1 + nil", `x = "ab1nil"`},
+		{"number and string", `x = 0.5 + "s"`, `x = "0.5s"`},
+		{"partial", "x = y + 1 * 2", "x = (y + 2)"},
+		{"left associative", "x = y + 1 + 2", "x = ((y + 1) + 2)"},
+		{"and", "x = 0 && f()\ny = 1 && f()", "x = 0\ny = f()"},
+		{"or", `x = "a" || f()` + "\ny = nil || f()", "x = \"a\"\ny = f()"},
+		{"runtime errors are kept", `x = 1 / 0 + "a" - 1 + -"s"`, `x = ((((1 / 0) + "a") - 1) + (-"s"))`},
+		{"nested functions", "var f = fun() { return 2 * 21 }", "var f = fun() {\n  return 42\n}"},
+
+		{"if true", "if 1 { a() } else { b() }\nc()", "{\n  a()\n}\nc()"},
+		{"if false", "if 0 { a() } else { b() }\nc()", "{\n  b()\n}\nc()"},
+		{"if false without else", "if 1 > 2 { a() }\nc()", "c()"},
+		{"last statement", "c()\nif nil { a() }", "c()\nnil"},
+		{"elif", "if x { a() } elif 0 { b() } elif y { c() } elif 1 { d() } elif z { e() }",
+			"if x {\n  a()\n} elif y {\n  c()\n} else {\n  d()\n}"},
+		{"first branch pruned", "if 0 { a() } elif y { b() } else { c() }", "if y {\n  b()\n} else {\n  c()\n}"},
+		{"dynamic conditions", "if x { a() } elif y { b() }", "if x {\n  a()\n} elif y {\n  b()\n}"},
+		{"while false", "while 0 { a() }\nc()", "c()"},
+		{"after return", "var f = fun() {\n  a()\n  return 1\n  b()\n  return 2\n}", "var f = fun() {\n  a()\n  return 1\n}"},
+		{"after break", "while x {\n  break\n  a()\n}", "while x {\n  break\n}"},
+		{"top-level return keeps going", "return 1\na()", "return 1\na()"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, Program(parse(t, tt.input)).String())
+		})
+	}
+}
+
+func TestProgramDisabled(t *testing.T) {
+	program := parse(t, "if 0 { a() }\nx = 1 + 2")
+	require.Equal(t, "if 0 {\n  a()\n}\nx = (1 + 2)", Program(program, OptionDisabled{Disabled: true}).String())
+}
+
+// TestProgramSemantics runs scripts with and without optimizations, they must print and return the same
+func TestProgramSemantics(t *testing.T) {
+	scripts := []string{
+		`io.println(1 + 2 * 3, 10 % 3, 7 / 2, -(4 - 1), "x" + 1.25 + nil, "b" > "a", 1 == 1.0, !nil)`,
+		`var f = fun(n) { if 0 { return "never" } elif n > 1 { return "big" } elif 1 { return "small" } }
+io.println(f(5), f(0))`,
+		`var i = 0
+while i < 3 {
+  i = i + 1
+  if 1 { continue }
+  io.println("unreachable")
+}
+io.println(i, 0 || "default", 1 && "both", nil && f())`,
+		`var x = 1
+if 1 { var x = 2 }
+io.println(x)
+if 0 { x = 3 }`,
+	}
+
+	run := func(t *testing.T, program *ast.Program) (string, runtime.Object) {
+		var out bytes.Buffer
+		env := runtime.NewEnvironment(nil)
+		result, err := eval.New(context.Background(), program, env, eval.OptionStdout{Writer: &out}).Run()
+		require.NoError(t, err)
+		return out.String(), result
+	}
+
+	for _, script := range scripts {
+		expectedOut, expectedResult := run(t, parse(t, script))
+		out, result := run(t, Program(parse(t, script)))
+		require.Equal(t, expectedOut, out)
+		require.Equal(t, expectedResult.String(), result.String())
+	}
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"refl/ast"
+	"sort"
+	"strings"
+)
+
+// attachComments sets the spans of the program's nodes and attaches each comment to a node:
+//   - a comment on the line a statement ends on, right after it, trails that statement
+//   - a comment right before a statement leads it
+//   - a comment right before an object literal property leads the property value
+//   - any other comment trails the innermost node containing it, or the program
+//
+// Nested statements that start or end at the same token as their parent give way to it.
+func attachComments(program *ast.Program, tokens []Token, spans []nodeSpan, comments []*ast.Comment) {
+	program.Comments = comments
+	program.Trivia = make(map[ast.Node]*ast.Trivia, len(spans)+1)
+
+	programTrivia := &ast.Trivia{Span: ast.Span{Start: 0, End: tokens[len(tokens)-1].End}}
+	program.Trivia[program] = programTrivia
+
+	// statements by the offsets of their first and last tokens, the outermost one wins
+	startsAt := make(map[int]ast.Statement)
+	endsAt := make(map[int]ast.Statement)
+	// property values by the offsets of their keys
+	keysAt := make(map[int]ast.Node)
+	var nodes []ast.Node
+
+	for _, s := range spans {
+		if s.property {
+			keysAt[tokens[s.start].Offset] = s.node
+			continue
+		}
+		if _, ok := program.Trivia[s.node]; ok {
+			continue
+		}
+
+		span := ast.Span{Start: tokens[s.start].Offset, End: tokens[s.end].End}
+		program.Trivia[s.node] = &ast.Trivia{Span: span}
+		nodes = append(nodes, s.node)
+
+		stmt, ok := s.node.(ast.Statement)
+		if !ok {
+			continue
+		}
+		if outer, ok := startsAt[span.Start]; !ok || wider(program.Trivia[stmt].Span, program.Trivia[outer].Span) {
+			startsAt[span.Start] = stmt
+		}
+		if outer, ok := endsAt[span.End]; !ok || wider(program.Trivia[stmt].Span, program.Trivia[outer].Span) {
+			endsAt[span.End] = stmt
+		}
+	}
+
+	for _, comment := range comments {
+		// the tokens around the comment, the one after it is EOF at worst
+		next := sort.Search(len(tokens), func(i int) bool {
+			return tokens[i].Offset >= comment.Span.End
+		})
+		next = min(next, len(tokens)-1)
+
+		if next > 0 {
+			prev := tokens[next-1]
+			endLine := prev.Line + strings.Count(prev.Text, "\n")
+			if stmt, ok := endsAt[prev.End]; ok && endLine == comment.Pos.Line {
+				trivia := program.Trivia[stmt]
+				trivia.Trailing = append(trivia.Trailing, comment)
+				continue
+			}
+		}
+
+		if stmt, ok := startsAt[tokens[next].Offset]; ok && tokens[next].Type != EOF {
+			trivia := program.Trivia[stmt]
+			trivia.Leading = append(trivia.Leading, comment)
+			continue
+		}
+
+		if value, ok := keysAt[tokens[next].Offset]; ok {
+			trivia := program.Trivia[value]
+			trivia.Leading = append(trivia.Leading, comment)
+			continue
+		}
+
+		trivia := programTrivia
+		for _, node := range nodes {
+			span := program.Trivia[node].Span
+			if span.Start <= comment.Span.Start && comment.Span.End <= span.End && narrower(span, trivia.Span) {
+				trivia = program.Trivia[node]
+			}
+		}
+		trivia.Trailing = append(trivia.Trailing, comment)
+	}
+}
+
+func wider(a, b ast.Span) bool {
+	return a.End-a.Start > b.End-b.Start
+}
+
+func narrower(a, b ast.Span) bool {
+	return a.End-a.Start < b.End-b.Start
+}
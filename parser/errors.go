@@ -0,0 +1,95 @@
+package parser
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// SyntaxError describes a single syntax error. Lines are 1-based, columns are
+// 0-based and counted in characters; the end position is exclusive.
+type SyntaxError struct {
+	Message   string
+	Line      int
+	Column    int
+	EndLine   int
+	EndColumn int
+	Token     string   // text of the offending token, "<EOF>" at end of input
+	Expected  []string // tokens that would have been accepted, if known
+	Excerpt   string   // offending source line with a caret marker below it
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at line %d, column %d", e.Message, e.Line, e.Column)
+}
+
+// ErrorList is returned by Parser.Parse when the source has syntax errors.
+type ErrorList []*SyntaxError
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0].Error(), len(l)-1)
+}
+
+// Unwrap allows errors.As to find the individual syntax errors
+func (l ErrorList) Unwrap() []error {
+	result := make([]error, len(l))
+	for i, err := range l {
+		result[i] = err
+	}
+	return result
+}
+
+func newSyntaxError(src, msg, tokenText string, line, column, endLine, endColumn int, expected []string) *SyntaxError {
+	return &SyntaxError{
+		Message:   msg,
+		Line:      line,
+		Column:    column,
+		EndLine:   endLine,
+		EndColumn: endColumn,
+		Token:     tokenText,
+		Expected:  expected,
+		Excerpt:   sourceExcerpt(src, line, column, endLine, endColumn),
+	}
+}
+
+// sourceExcerpt returns the given source line followed by a line of carets
+// under the columns from column to endColumn.
+func sourceExcerpt(src string, line, column, endLine, endColumn int) string {
+	lines := strings.Split(src, "\n")
+	if line < 1 || line > len(lines) {
+		return ""
+	}
+
+	text := strings.TrimRight(lines[line-1], "\r")
+
+	width := 1
+	if endLine == line && endColumn > column {
+		width = endColumn - column
+	}
+
+	length := utf8.RuneCountInString(text)
+	if column > length {
+		column = length
+	}
+
+	var marker strings.Builder
+	for i, r := range []rune(text) {
+		if i >= column {
+			break
+		}
+		if r == '\t' {
+			marker.WriteByte('\t')
+		} else {
+			marker.WriteByte(' ')
+		}
+	}
+	marker.WriteString(strings.Repeat("^", width))
+
+	return text + "\n" + marker.String()
+}
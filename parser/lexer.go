@@ -0,0 +1,316 @@
+package parser
+
+import (
+	"refl/ast"
+	"unicode/utf8"
+)
+
+// Lexer splits Refl source code into tokens. Comments and whitespace are
+// skipped, characters that cannot start any token are reported and skipped.
+type Lexer struct {
+	src    string
+	pos    int
+	line   int
+	column int
+
+	errors []*SyntaxError
+
+	// keepComments makes the lexer collect the comments it skips
+	keepComments bool
+	comments     []*ast.Comment
+}
+
+func NewLexer(src string) *Lexer {
+	return &Lexer{
+		src:  src,
+		line: 1,
+	}
+}
+
+// Tokenize returns all tokens of the source, terminated by an EOF token.
+func (l *Lexer) Tokenize() []Token {
+	tokens := make([]Token, 0, len(l.src)/4+1)
+	for {
+		tok := l.Next()
+		tokens = append(tokens, tok)
+		if tok.Type == EOF {
+			return tokens
+		}
+	}
+}
+
+// Next returns the next token of the source.
+func (l *Lexer) Next() Token {
+	for l.pos < len(l.src) {
+		ch := l.src[l.pos]
+
+		switch {
+		case ch == ' ' || ch == '\t' || ch == '\r' || ch == '\n':
+			l.advance()
+			continue
+		case ch == '#':
+			start, line, column := l.pos, l.line, l.column
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.advance()
+			}
+			if l.keepComments {
+				l.comments = append(l.comments, &ast.Comment{
+					Pos:  ast.Position{Line: line, Column: column},
+					Span: ast.Span{Start: start, End: l.pos},
+					Text: l.src[start:l.pos],
+				})
+			}
+			continue
+		}
+
+		if tok, ok := l.scanToken(); ok {
+			return tok
+		}
+
+		// no token matches at this position, skip a single character
+		l.recordError()
+		l.advance()
+	}
+
+	return Token{Type: EOF, Line: l.line, Column: l.column, Offset: l.pos, End: l.pos}
+}
+
+// Comments returns the comments skipped so far, they're only collected when parsing with comments
+func (l *Lexer) Comments() []*ast.Comment {
+	return l.comments
+}
+
+// Errors returns the token recognition errors found so far
+func (l *Lexer) Errors() []*SyntaxError {
+	return l.errors
+}
+
+// recordError reports the text that can't be tokenized at the current position:
+// the rest of the line for an unterminated string, the rest of the source for a raw string
+func (l *Lexer) recordError() {
+	end := l.pos + 1
+	switch l.src[l.pos] {
+	case '"':
+		for end < len(l.src) && l.src[end] != '\n' && l.src[end] != '\r' {
+			end++
+		}
+	case '`':
+		end = len(l.src)
+	default:
+		_, size := utf8.DecodeRuneInString(l.src[l.pos:])
+		end = l.pos + size
+	}
+
+	text := l.src[l.pos:end]
+	l.errors = append(l.errors, newSyntaxError(l.src, "token recognition error at: '"+text+"'", text,
+		l.line, l.column, l.line, l.column+1, nil))
+}
+
+func (l *Lexer) scanToken() (Token, bool) {
+	start, line, column := l.pos, l.line, l.column
+	ch := l.src[l.pos]
+
+	var typ TokenType
+
+	switch {
+	case isIdentStart(ch):
+		end := l.pos + 1
+		for end < len(l.src) && isIdentPart(l.src[end]) {
+			end++
+		}
+		typ = IDENTIFIER
+		if kw, ok := keywords[l.src[start:end]]; ok {
+			typ = kw
+		}
+		l.pos, l.column = end, l.column+end-start
+
+	case isDigit(ch):
+		end := l.pos + 1
+		for end < len(l.src) && isDigit(l.src[end]) {
+			end++
+		}
+		if end+1 < len(l.src) && l.src[end] == '.' && isDigit(l.src[end+1]) {
+			end += 2
+			for end < len(l.src) && isDigit(l.src[end]) {
+				end++
+			}
+		}
+		typ = NUMBER
+		l.pos, l.column = end, l.column+end-start
+
+	case ch == '"':
+		end, ok := l.matchString()
+		if !ok {
+			return Token{}, false
+		}
+		typ = STRING
+		l.advanceTo(end)
+
+	case ch == '`':
+		end := l.pos + 1
+		for end < len(l.src) && l.src[end] != '`' {
+			end++
+		}
+		if end >= len(l.src) {
+			return Token{}, false
+		}
+		typ = RAW_STRING
+		l.advanceTo(end + 1)
+
+	default:
+		var ok bool
+		typ, ok = l.matchOperator()
+		if !ok {
+			return Token{}, false
+		}
+	}
+
+	return Token{
+		Type:   typ,
+		Text:   l.src[start:l.pos],
+		Line:   line,
+		Column: column,
+		Offset: start,
+		End:    l.pos,
+	}, true
+}
+
+func (l *Lexer) matchString() (int, bool) {
+	i := l.pos + 1
+	for i < len(l.src) {
+		switch l.src[i] {
+		case '"':
+			return i + 1, true
+		case '\r', '\n':
+			return 0, false
+		case '\\':
+			if i+1 >= len(l.src) {
+				return 0, false
+			}
+			switch l.src[i+1] {
+			case '"', '\\', 'n', 'r', 't':
+				i += 2
+			default:
+				return 0, false
+			}
+		default:
+			i++
+		}
+	}
+	return 0, false
+}
+
+func (l *Lexer) matchOperator() (TokenType, bool) {
+	ch := l.src[l.pos]
+	var next byte
+	if l.pos+1 < len(l.src) {
+		next = l.src[l.pos+1]
+	}
+
+	typ, width := TokenType(0), 1
+
+	switch ch {
+	case '.':
+		typ = DOT
+		if next == '.' && l.pos+2 < len(l.src) && l.src[l.pos+2] == '.' {
+			typ, width = ELLIPSIS, 3
+		}
+	case ':':
+		typ = COLON
+	case '(':
+		typ = LPAREN
+	case ')':
+		typ = RPAREN
+	case '[':
+		typ = LBRACKET
+	case ']':
+		typ = RBRACKET
+	case '{':
+		typ = LBRACE
+	case '}':
+		typ = RBRACE
+	case ',':
+		typ = COMMA
+	case ';':
+		typ = SEMICOLON
+	case '+':
+		typ = PLUS
+	case '-':
+		typ = MINUS
+	case '*':
+		typ = ASTERISK
+	case '/':
+		typ = SLASH
+	case '%':
+		typ = PERCENT
+	case '=':
+		typ = ASSIGN
+		if next == '=' {
+			typ, width = EQ, 2
+		}
+	case '!':
+		typ = BANG
+		if next == '=' {
+			typ, width = NE, 2
+		}
+	case '<':
+		typ = LT
+		if next == '=' {
+			typ, width = LE, 2
+		}
+	case '>':
+		typ = GT
+		if next == '=' {
+			typ, width = GE, 2
+		}
+	case '&':
+		if next != '&' {
+			return 0, false
+		}
+		typ, width = AND, 2
+	case '|':
+		if next != '|' {
+			return 0, false
+		}
+		typ, width = OR, 2
+	default:
+		return 0, false
+	}
+
+	l.pos += width
+	l.column += width
+
+	return typ, true
+}
+
+// advance moves past a single rune, keeping track of lines and columns
+func (l *Lexer) advance() {
+	if l.src[l.pos] == '\n' {
+		l.pos++
+		l.line++
+		l.column = 0
+		return
+	}
+
+	_, size := utf8.DecodeRuneInString(l.src[l.pos:])
+	l.pos += size
+	l.column++
+}
+
+func (l *Lexer) advanceTo(end int) {
+	for l.pos < end {
+		l.advance()
+	}
+}
+
+func isIdentStart(ch byte) bool {
+	return ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch == '_' || ch == '$'
+}
+
+func isIdentPart(ch byte) bool {
+	return isIdentStart(ch) || isDigit(ch)
+}
+
+func isDigit(ch byte) bool {
+	return ch >= '0' && ch <= '9'
+}
@@ -0,0 +1,17 @@
+package parser
+
+type Options struct {
+	comments bool
+}
+
+type Option interface {
+	Apply(*Options)
+}
+
+// OptionComments keeps the comments and records the source span of every node,
+// see ast.Program.Comments and ast.Program.Trivia
+type OptionComments struct{}
+
+func (OptionComments) Apply(opts *Options) {
+	opts.comments = true
+}
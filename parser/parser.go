@@ -1,548 +1,865 @@
 package parser
 
 import (
-	"errors"
 	"fmt"
 	"refl/ast"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode/utf8"
+)
 
-	"refl/parser/gen"
-
-	"github.com/antlr4-go/antlr/v4"
+// Operator precedences, from the loosest to the tightest binding
+const (
+	precLowest = iota
+	precAssign
+	precOr
+	precAnd
+	precEquality
+	precComparison
+	precSum
+	precProduct
+	precPrefix
+	precPostfix
 )
 
+var infixPrecedences = map[TokenType]int{
+	ASSIGN:   precAssign,
+	OR:       precOr,
+	AND:      precAnd,
+	EQ:       precEquality,
+	NE:       precEquality,
+	LT:       precComparison,
+	GT:       precComparison,
+	LE:       precComparison,
+	GE:       precComparison,
+	PLUS:     precSum,
+	MINUS:    precSum,
+	ASTERISK: precProduct,
+	SLASH:    precProduct,
+	PERCENT:  precProduct,
+	DOT:      precPostfix,
+	COLON:    precPostfix,
+	LPAREN:   precPostfix,
+	LBRACKET: precPostfix,
+}
+
+// statementStarts are the tokens the parser resynchronizes on after an error
+var statementStarts = map[TokenType]bool{
+	VAR:      true,
+	IF:       true,
+	WHILE:    true,
+	FOR:      true,
+	BREAK:    true,
+	CONTINUE: true,
+	RETURN:   true,
+}
+
+// bailout is used to unwind the parser to the nearest recovery point
+type bailout struct {
+	err *SyntaxError
+}
+
+// Parser is a recursive-descent parser with Pratt parsing for the binary operators.
+// It recovers from syntax errors at statement boundaries, so a single Parse reports all of them.
 type Parser struct {
 	errors []error
+
+	src    string
+	tokens []Token
+	pos    int
+
+	speculating int
+
+	options Options
+	// spans logs the spans of the parsed nodes when parsing with comments
+	spans []nodeSpan
 }
 
-func New() *Parser {
-	return &Parser{}
+// nodeSpan is a node along with the indexes of its first and last tokens,
+// or the value of an object literal property along with the index of the property key
+type nodeSpan struct {
+	node       ast.Node
+	start, end int
+	property   bool
 }
 
-func (p *Parser) Parse(code string) (resultP *ast.Program, resultErr error) {
-	defer func() {
-		if err := recover(); err != nil {
-			resultErr = fmt.Errorf("panic: %v, errors: %w", err, errors.Join(p.errors...))
-		}
-	}()
+func New(opts ...Option) *Parser {
+	p := &Parser{}
+	for _, opt := range opts {
+		opt.Apply(&p.options)
+	}
+	return p
+}
 
+// Parse parses the code, on syntax errors it returns an ErrorList with every error found
+func (p *Parser) Parse(code string) (*ast.Program, error) {
 	p.errors = []error{}
-
-	input := antlr.NewInputStream(code)
-	lexer := gen.NewReflLexer(input)
-	stream := antlr.NewCommonTokenStream(lexer, antlr.TokenDefaultChannel)
-	antlrParser := gen.NewReflParser(stream)
-	antlrParser.RemoveErrorListeners()
-	antlrParser.AddErrorListener(p)
-
-	tree := antlrParser.Program()
+	p.src = code
+	p.spans = nil
+	lexer := NewLexer(code)
+	lexer.keepComments = p.options.comments
+	p.tokens = lexer.Tokenize()
+	p.pos = 0
+
+	program := p.parseProgram()
+
+	// the lexer runs ahead of the parser, so its errors are merged in by position
+	if lexErrors := lexer.Errors(); len(lexErrors) > 0 {
+		for _, err := range lexErrors {
+			p.errors = append(p.errors, err)
+		}
+		sort.SliceStable(p.errors, func(i, j int) bool {
+			a, b := p.errors[i].(*SyntaxError), p.errors[j].(*SyntaxError)
+			return a.Line < b.Line || a.Line == b.Line && a.Column < b.Column
+		})
+	}
 
 	if len(p.errors) > 0 {
-		return nil, p.errors[0]
+		list := make(ErrorList, 0, len(p.errors))
+		for _, err := range p.errors {
+			list = append(list, err.(*SyntaxError))
+		}
+		return nil, list
 	}
 
-	visitor := newReflVisitor(p)
-	return visitor.Visit(tree).(*ast.Program), nil
+	if p.options.comments {
+		attachComments(program, p.tokens, p.spans, lexer.Comments())
+	}
+
+	return program, nil
 }
 
+// Errors returns the syntax errors of the last Parse call, each one is a *SyntaxError
 func (p *Parser) Errors() []error {
 	return p.errors
 }
 
-func (p *Parser) error(msg string) {
-	p.errors = append(p.errors, errors.New(msg))
-}
+func (p *Parser) parseProgram() *ast.Program {
+	program := &ast.Program{Pos: p.position(p.cur())}
 
-func (p *Parser) SyntaxError(recognizer antlr.Recognizer, offendingSymbol any, line, column int, msg string, e antlr.RecognitionException) {
-	p.error(fmt.Sprintf("%s at line %d, column %d, %s", msg, line, column, offendingSymbol))
-}
+	for !p.at(EOF) {
+		if p.at(RBRACE) {
+			p.recordError(p.errorAt(p.cur(), fmt.Sprintf("extraneous input %s", p.cur())))
+			p.next()
+			continue
+		}
 
-func (p *Parser) ReportAmbiguity(recognizer antlr.Parser, dfa *antlr.DFA, startIndex, stopIndex int, exact bool, ambigAlts *antlr.BitSet, configs *antlr.ATNConfigSet) {
-}
+		if stmt := p.parseStatementRecover(); stmt != nil {
+			program.Statements = append(program.Statements, stmt)
+		}
+	}
 
-func (p *Parser) ReportAttemptingFullContext(recognizer antlr.Parser, dfa *antlr.DFA, startIndex, stopIndex int, conflictingAlts *antlr.BitSet, configs *antlr.ATNConfigSet) {
+	return program
 }
 
-func (p *Parser) ReportContextSensitivity(recognizer antlr.Parser, dfa *antlr.DFA, startIndex, stopIndex, prediction int, configs *antlr.ATNConfigSet) {
-}
+// parseStatementRecover parses a statement, recording the error and skipping
+// to the start of the next statement if it is malformed.
+func (p *Parser) parseStatementRecover() (stmt ast.Statement) {
+	start := p.pos
 
-var _ gen.ReflVisitor = (*ReflVisitor)(nil)
+	defer func() {
+		if p.speculating > 0 {
+			return
+		}
 
-type ReflVisitor struct {
-	gen.BaseReflVisitor
-	parser *Parser
-}
+		r := recover()
+		if r == nil {
+			return
+		}
 
-func newReflVisitor(p *Parser) *ReflVisitor {
-	return &ReflVisitor{
-		parser: p,
-	}
-}
+		b, ok := r.(bailout)
+		if !ok {
+			panic(r)
+		}
 
-func (v *ReflVisitor) Visit(tree antlr.ParseTree) any {
-	return tree.Accept(v)
-}
+		p.recordError(b.err)
+		p.synchronize(start)
+		stmt = nil
+	}()
 
-func (v *ReflVisitor) VisitPrimaryExpr(ctx *gen.PrimaryExprContext) any {
-	return ctx.Primary().Accept(v)
+	stmt = p.parseStatement()
+	p.markSpan(stmt, start)
+
+	return stmt
+}
+
+func (p *Parser) synchronize(start int) {
+	if p.pos == start {
+		p.next()
+	}
+
+	// statements aren't separated, so a token on a later line is the likely start of the next one
+	line := p.tokens[max(p.pos-1, 0)].Line
+	for !p.at(EOF) && !p.at(RBRACE) && !statementStarts[p.cur().Type] && p.cur().Line <= line {
+		p.next()
+	}
+}
+
+func (p *Parser) parseStatement() ast.Statement {
+	switch p.cur().Type {
+	case VAR:
+		return p.parseVarDeclaration()
+	case IF:
+		return p.parseIfStatement()
+	case WHILE:
+		return p.parseWhileStatement()
+	case FOR:
+		return p.parseForStatement()
+	case BREAK:
+		return &ast.BreakStatement{Pos: p.position(p.next())}
+	case CONTINUE:
+		return &ast.ContinueStatement{Pos: p.position(p.next())}
+	case RETURN:
+		return p.parseReturnStatement()
+	case LBRACE:
+		// a brace at the start of a statement is an object or array literal
+		// when possible, and a block otherwise
+		var stmt ast.Statement
+		p.parseEither(func() {
+			stmt = p.parseExpressionStatement()
+		}, func() {
+			stmt = p.parseBlock()
+		})
+		return stmt
+	default:
+		if !p.canStartExpression() {
+			p.fail(p.cur(), fmt.Sprintf("extraneous input %s", p.cur()), nil)
+		}
+		return p.parseExpressionStatement()
+	}
 }
 
-func (v *ReflVisitor) VisitProgram(ctx *gen.ProgramContext) any {
-	program := &ast.Program{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
+func (p *Parser) parseVarDeclaration() ast.Statement {
+	vd := &ast.VarDeclaration{Pos: p.position(p.expect(VAR))}
+	if p.at(LBRACE) {
+		vd.Pattern = p.parseBracesPattern()
+	} else if name := p.expect(IDENTIFIER); p.at(COMMA) {
+		vd.Pattern = &ast.Pattern{Pos: p.position(name), Elements: []ast.Expression{p.identifier(name)}}
+		for p.at(COMMA) {
+			p.next()
+			vd.Pattern.Elements = append(vd.Pattern.Elements, p.identifier(p.expect(IDENTIFIER)))
+		}
+	} else {
+		vd.Name = name.Text
+	}
+	p.expect(ASSIGN)
+	// like assignments, only patterns take several values
+	if vd.Pattern != nil {
+		vd.Value = p.parseValues()
+	} else {
+		vd.Value = p.parseExpression()
 	}
 
-	for _, stmtCtx := range ctx.AllStatement() {
-		acceptRes := stmtCtx.Accept(v)
-		if acceptRes != nil {
-			program.Statements = append(program.Statements, acceptRes.(ast.Statement))
+	return vd
+}
+
+// parseBracesPattern parses `{a, b}`, which takes the values of a destructuring declaration by name
+func (p *Parser) parseBracesPattern() *ast.Pattern {
+	pattern := &ast.Pattern{Pos: p.position(p.expect(LBRACE)), Braces: true}
+	for {
+		pattern.Elements = append(pattern.Elements, p.identifier(p.expect(IDENTIFIER)))
+		if !p.at(COMMA) {
+			break
 		}
+		p.next()
 	}
+	p.expect(RBRACE)
 
-	return program
+	return pattern
+}
+
+func (p *Parser) identifier(tok Token) *ast.Identifier {
+	return &ast.Identifier{Pos: p.position(tok), Name: tok.Text}
 }
 
-func (v *ReflVisitor) VisitVarDeclaration(ctx *gen.VarDeclarationContext) any {
-	vd := &ast.VarDeclaration{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Name: ctx.IDENTIFIER().GetText(),
+// parseValues parses an expression, or a comma separated list of them as a tuple
+func (p *Parser) parseValues() ast.Expression {
+	start := p.pos
+	first := p.parseExpression()
+	if !p.at(COMMA) {
+		return first
 	}
 
-	if ctx.Expression() != nil {
-		vd.Value = ctx.Expression().Accept(v).(ast.Expression)
+	tuple := &ast.Tuple{Pos: first.Position(), Elements: []ast.Expression{first}}
+	for p.at(COMMA) {
+		p.next()
+		tuple.Elements = append(tuple.Elements, p.parseExpression())
 	}
+	p.markSpan(tuple, start)
 
-	return vd
+	return tuple
 }
 
-func (v *ReflVisitor) VisitExpressionStatement(ctx *gen.ExpressionStatementContext) any {
+func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
+	start := p.pos
 	es := &ast.ExpressionStatement{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
+		Pos:        p.position(p.cur()),
+		Expression: p.parseExpression(),
 	}
 
-	if ctx.Expression() != nil {
-		es.Expression = ctx.Expression().Accept(v).(ast.Expression)
+	// `a, b = b, a` assigns several targets at once
+	if _, isAssignment := es.Expression.(*ast.Assignment); !isAssignment && p.at(COMMA) {
+		pattern := &ast.Pattern{Pos: es.Pos, Elements: []ast.Expression{patternTarget(es.Expression)}}
+		for p.at(COMMA) {
+			p.next()
+			pattern.Elements = append(pattern.Elements, patternTarget(p.parseExpressionPrec(precAssign+1)))
+		}
+		p.markSpan(pattern, start)
+		p.expect(ASSIGN)
+		es.Expression = &ast.Assignment{Pos: es.Pos, Left: pattern, Right: p.parseValues()}
+		p.markSpan(es.Expression, start)
 	}
 
 	return es
 }
 
-func (v *ReflVisitor) VisitIfStatement(ctx *gen.IfStatementContext) any {
-	is := &ast.IfStatement{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Condition: ctx.Expression(0).Accept(v).(ast.Expression),
-		Then:      ctx.Block(0).Accept(v).(*ast.BlockStatement),
+// patternTarget turns an array literal of identifiers, such as `{a, b}` on the left of an assignment,
+// into the braces pattern it spells
+func patternTarget(expr ast.Expression) ast.Expression {
+	al, ok := expr.(*ast.ArrayLiteral)
+	if !ok || len(al.Elements) == 0 {
+		return expr
 	}
+	for _, elem := range al.Elements {
+		if _, ok := elem.(*ast.Identifier); !ok {
+			return expr
+		}
+	}
+	return &ast.Pattern{Pos: al.Pos, Elements: al.Elements, Braces: true}
+}
 
-	elifs := ctx.AllELIF()
+func (p *Parser) parseIfStatement() ast.Statement {
+	is := &ast.IfStatement{Pos: p.position(p.expect(IF))}
+	is.Condition = p.parseExpression()
+	is.Then = p.parseBlock()
 
-	for i := 0; i < len(elifs); i++ {
-		el := &ast.ElifStatement{
-			Pos: ast.Position{
-				Line:   elifs[i].GetSymbol().GetLine(),
-				Column: elifs[i].GetSymbol().GetColumn(),
-			},
-			Condition: ctx.Expression(i + 1).Accept(v).(ast.Expression),
-			Body:      ctx.Block(i + 1).Accept(v).(*ast.BlockStatement),
-		}
+	for p.at(ELIF) {
+		start := p.pos
+		el := &ast.ElifStatement{Pos: p.position(p.next())}
+		el.Condition = p.parseExpression()
+		el.Body = p.parseBlock()
+		p.markSpan(el, start)
 		is.Elif = append(is.Elif, el)
 	}
 
-	if ctx.ELSE() != nil {
-		is.Else = ctx.Block(len(ctx.AllBlock()) - 1).Accept(v).(*ast.BlockStatement)
+	if p.at(ELSE) {
+		p.next()
+		is.Else = p.parseBlock()
 	}
 
 	return is
 }
 
-func (v *ReflVisitor) VisitWhileStatement(ctx *gen.WhileStatementContext) any {
-	ws := &ast.WhileStatement{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Condition: ctx.Expression().Accept(v).(ast.Expression),
-		Body:      ctx.Block().Accept(v).(*ast.BlockStatement),
-	}
+func (p *Parser) parseWhileStatement() ast.Statement {
+	ws := &ast.WhileStatement{Pos: p.position(p.expect(WHILE))}
+	ws.Condition = p.parseExpression()
+	ws.Body = p.parseBlock()
 
 	return ws
 }
 
-func (v *ReflVisitor) VisitForStatement(ctx *gen.ForStatementContext) any {
-	fs := &ast.ForStatement{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Key:    ctx.IDENTIFIER(0).GetText(),
-		Value:  ctx.IDENTIFIER(1).GetText(),
-		Object: ctx.Expression().Accept(v).(ast.Expression),
-		Body:   ctx.Block().Accept(v).(*ast.BlockStatement),
+func (p *Parser) parseForStatement() ast.Statement {
+	fs := &ast.ForStatement{Pos: p.position(p.expect(FOR))}
+	fs.Key = p.expect(IDENTIFIER).Text
+	p.expect(COMMA)
+	if p.at(LBRACE) {
+		fs.ValuePattern = p.parseBracesPattern()
+	} else {
+		fs.Value = p.expect(IDENTIFIER).Text
 	}
+	p.expect(IN)
+	fs.Object = p.parseExpression()
+	fs.Body = p.parseBlock()
 
 	return fs
 }
 
-func (v *ReflVisitor) VisitBlock(ctx *gen.BlockContext) any {
-	bs := &ast.BlockStatement{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
+func (p *Parser) parseReturnStatement() ast.Statement {
+	rs := &ast.ReturnStatement{Pos: p.position(p.expect(RETURN))}
+	if p.canStartExpression() {
+		rs.Value = p.parseValues()
 	}
 
-	for _, stmtCtx := range ctx.AllStatement() {
-		acceptRes := stmtCtx.Accept(v)
-		if acceptRes != nil {
-			bs.Statements = append(bs.Statements, acceptRes.(ast.Statement))
+	return rs
+}
+
+func (p *Parser) parseBlock() *ast.BlockStatement {
+	start := p.pos
+	bs := &ast.BlockStatement{Pos: p.position(p.expect(LBRACE))}
+
+	for !p.at(RBRACE) {
+		if p.at(EOF) {
+			p.fail(p.cur(), fmt.Sprintf("missing '}' at %s", p.cur()), []string{RBRACE.String()})
+		}
+
+		if stmt := p.parseStatementRecover(); stmt != nil {
+			bs.Statements = append(bs.Statements, stmt)
 		}
 	}
+	p.next()
+	p.markSpan(bs, start)
 
 	return bs
 }
 
-func (v *ReflVisitor) VisitBlockStatement(ctx *gen.BlockStatementContext) any {
-	return ctx.Block().Accept(v)
+func (p *Parser) parseExpression() ast.Expression {
+	return p.parseExpressionPrec(precAssign)
 }
 
-func (v *ReflVisitor) VisitBreakStatement(ctx *gen.BreakStatementContext) any {
-	return &ast.BreakStatement{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
+// parseExpressionPrec parses an expression whose infix operators bind at
+// least as tight as minPrec. All binary operators are left-associative.
+func (p *Parser) parseExpressionPrec(minPrec int) ast.Expression {
+	startIndex := p.pos
+	start := p.position(p.cur())
+	left := p.parsePrefix()
+
+	for {
+		p.markSpan(left, startIndex)
+		tok := p.cur()
+
+		prec, ok := infixPrecedences[tok.Type]
+		if !ok || prec < minPrec {
+			return left
+		}
+
+		switch tok.Type {
+		case DOT:
+			p.next()
+			left = &ast.MemberDot{
+				Pos:    start,
+				Object: left,
+				Member: p.expect(IDENTIFIER).Text,
+			}
+		case COLON:
+			p.next()
+			mc := &ast.MethodCall{
+				Pos:    start,
+				Object: left,
+				Method: p.expect(IDENTIFIER).Text,
+			}
+			mc.Arguments = p.parseArguments()
+			left = mc
+		case LPAREN:
+			left = &ast.FunctionCall{
+				Pos:       start,
+				Function:  left,
+				Arguments: p.parseArguments(),
+			}
+		case LBRACKET:
+			p.next()
+			mb := &ast.MemberBracket{
+				Pos:    start,
+				Object: left,
+				Member: p.parseExpression(),
+			}
+			p.expect(RBRACKET)
+			left = mb
+		case ASSIGN:
+			p.next()
+			left = &ast.Assignment{
+				Pos:   start,
+				Left:  patternTarget(left),
+				Right: p.parseExpressionPrec(prec + 1),
+			}
+		default:
+			p.next()
+			left = &ast.BinaryExpression{
+				Pos:      start,
+				Left:     left,
+				Operator: tok.Text,
+				Right:    p.parseExpressionPrec(prec + 1),
+			}
+		}
 	}
 }
 
-func (v *ReflVisitor) VisitContinueStatement(ctx *gen.ContinueStatementContext) any {
-	return &ast.ContinueStatement{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-	}
+func (p *Parser) parsePrefix() ast.Expression {
+	tok := p.cur()
+
+	switch tok.Type {
+	case MINUS, BANG:
+		p.next()
+		return &ast.UnaryExpression{
+			Pos:      p.position(tok),
+			Operator: tok.Text,
+			Right:    p.parseExpressionPrec(precPrefix),
+		}
+	case AWAIT:
+		p.next()
+		return &ast.AwaitExpression{
+			Pos:   p.position(tok),
+			Value: p.parseExpressionPrec(precPrefix),
+		}
+	case NUMBER:
+		p.next()
+		value, err := parseNumber(tok.Text)
+		if err != nil {
+			p.recordError(p.errorAt(tok, err.Error()))
+		}
+		return &ast.NumberLiteral{Pos: p.position(tok), Value: value}
+	case STRING:
+		p.next()
+		return &ast.StringLiteral{Pos: p.position(tok), Value: parseString(tok.Text)}
+	case RAW_STRING:
+		p.next()
+		return &ast.RawStringLiteral{Pos: p.position(tok), Value: parseRawString(tok.Text)}
+	case NIL:
+		p.next()
+		return &ast.NilLiteral{Pos: p.position(tok)}
+	case IDENTIFIER:
+		p.next()
+		return &ast.Identifier{Pos: p.position(tok), Name: tok.Text}
+	case LPAREN:
+		p.next()
+		expr := p.parseExpression()
+		p.expect(RPAREN)
+		return expr
+	case FUN:
+		return p.parseFunctionLiteral()
+	case LBRACE:
+		return p.parseBraceLiteral()
+	}
+
+	p.fail(tok, fmt.Sprintf("mismatched input %s expecting expression", tok), expressionStarts())
+	return nil
 }
 
-func (v *ReflVisitor) VisitReturnStatement(ctx *gen.ReturnStatementContext) any {
-	rs := &ast.ReturnStatement{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-	}
+func (p *Parser) parseFunctionLiteral() ast.Expression {
+	fl := &ast.FunctionLiteral{Pos: p.position(p.expect(FUN))}
 
-	if ctx.Expression() != nil {
-		rs.Value = ctx.Expression().Accept(v).(ast.Expression)
-	}
+	p.expect(LPAREN)
+	for !p.at(RPAREN) {
+		if len(fl.Parameters) > 0 || fl.Rest != "" {
+			p.expect(COMMA)
+		}
+		if fl.Rest != "" {
+			// the function is still parsed, so that the error doesn't cascade into its body
+			p.recordError(p.newError(p.cur(), "the rest parameter must be the last one", []string{RPAREN.String()}))
+			p.skipParameters()
+			break
+		}
 
-	return rs
-}
+		// `...name` collects the extra arguments
+		if p.at(ELLIPSIS) {
+			p.next()
+			fl.Rest = p.expect(IDENTIFIER).Text
+			continue
+		}
 
-func (v *ReflVisitor) VisitMemberDot(ctx *gen.MemberDotContext) any {
-	md := &ast.MemberDot{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Object: ctx.Expression().Accept(v).(ast.Expression),
-		Member: ctx.IDENTIFIER().GetText(),
+		name := p.expect(IDENTIFIER).Text
+		fl.Parameters = append(fl.Parameters, name)
+		if p.at(ASSIGN) {
+			p.next()
+			if fl.Defaults == nil {
+				fl.Defaults = make(map[string]ast.Expression)
+			}
+			fl.Defaults[name] = p.parseExpression()
+		}
 	}
+	p.expect(RPAREN)
 
-	return md
-}
+	fl.Body = p.parseBlock()
 
-func (v *ReflVisitor) VisitMethodCall(ctx *gen.MethodCallContext) any {
-	mc := &ast.MethodCall{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Object: ctx.Expression().Accept(v).(ast.Expression),
-		Method: ctx.IDENTIFIER().GetText(),
-	}
+	return fl
+}
 
-	if ctx.ExpressionList() != nil {
-		exprList := ctx.ExpressionList().Accept(v).([]ast.Expression)
-		mc.Arguments = append(mc.Arguments, exprList...)
+// skipParameters moves to the parenthesis closing the parameters, skipping the nested ones
+func (p *Parser) skipParameters() {
+	depth := 0
+	for !p.at(EOF) && (depth > 0 || !p.at(RPAREN)) {
+		switch p.cur().Type {
+		case LPAREN:
+			depth++
+		case RPAREN:
+			depth--
+		}
+		p.next()
 	}
-
-	return mc
 }
 
-func (v *ReflVisitor) VisitFunctionCall(ctx *gen.FunctionCallContext) any {
-	fc := &ast.FunctionCall{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Function: ctx.Expression().Accept(v).(ast.Expression),
+// parseBraceLiteral parses either an object or an array literal. Empty braces
+// and braces that parse both ways are object literals.
+func (p *Parser) parseBraceLiteral() ast.Expression {
+	if p.peek(1).Type == RBRACE {
+		tok := p.next()
+		p.next()
+		return &ast.ObjectLiteral{
+			Pos:        p.position(tok),
+			Properties: make(map[string]ast.Expression),
+		}
 	}
 
-	if ctx.ExpressionList() != nil {
-		exprList := ctx.ExpressionList().Accept(v).([]ast.Expression)
-		fc.Arguments = append(fc.Arguments, exprList...)
+	key := p.peek(1).Type
+	if (key == STRING || key == IDENTIFIER) && p.peek(2).Type == COLON {
+		var expr ast.Expression
+		p.parseEither(func() {
+			expr = p.parseObjectLiteral()
+		}, func() {
+			expr = p.parseArrayLiteral()
+		})
+		return expr
 	}
 
-	return fc
+	return p.parseArrayLiteral()
 }
 
-func (v *ReflVisitor) VisitMemberBracket(ctx *gen.MemberBracketContext) any {
-	mb := &ast.MemberBracket{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Object: ctx.Expression(0).Accept(v).(ast.Expression),
-		Member: ctx.Expression(1).Accept(v).(ast.Expression),
+func (p *Parser) parseObjectLiteral() ast.Expression {
+	ol := &ast.ObjectLiteral{
+		Pos:        p.position(p.expect(LBRACE)),
+		Properties: make(map[string]ast.Expression),
 	}
 
-	return mb
-}
+	for {
+		keyIndex := p.pos
 
-func (v *ReflVisitor) VisitUnary(ctx *gen.UnaryContext) any {
-	ue := &ast.UnaryExpression{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Operator: ctx.GetOp().GetText(),
-		Right:    ctx.Expression().Accept(v).(ast.Expression),
-	}
+		var key string
+		switch tok := p.cur(); tok.Type {
+		case STRING:
+			key = parseString(p.next().Text)
+		case IDENTIFIER:
+			key = p.next().Text
+		default:
+			p.fail(tok, fmt.Sprintf("mismatched input %s expecting {STRING, IDENTIFIER}", tok),
+				[]string{STRING.String(), IDENTIFIER.String()})
+		}
 
-	return ue
-}
+		p.expect(COLON)
+		ol.Properties[key] = p.parseExpression()
+		if p.options.comments {
+			p.spans = append(p.spans, nodeSpan{node: ol.Properties[key], start: keyIndex, property: true})
+		}
 
-func (v *ReflVisitor) VisitBinary(ctx *gen.BinaryContext) any {
-	be := &ast.BinaryExpression{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Left:     ctx.Expression(0).Accept(v).(ast.Expression),
-		Operator: ctx.GetOp().GetText(),
-		Right:    ctx.Expression(1).Accept(v).(ast.Expression),
+		if !p.at(COMMA) {
+			break
+		}
+		p.next()
 	}
+	p.expect(RBRACE)
 
-	return be
+	return ol
 }
 
-func (v *ReflVisitor) VisitAssignment(ctx *gen.AssignmentContext) any {
-	a := &ast.Assignment{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Left:  ctx.Expression(0).Accept(v).(ast.Expression),
-		Right: ctx.Expression(1).Accept(v).(ast.Expression),
+func (p *Parser) parseArrayLiteral() ast.Expression {
+	al := &ast.ArrayLiteral{Pos: p.position(p.expect(LBRACE))}
+
+	for {
+		al.Elements = append(al.Elements, p.parseExpression())
+
+		if !p.at(COMMA) {
+			break
+		}
+		p.next()
 	}
+	p.expect(RBRACE)
 
-	return a
+	return al
 }
 
-func (v *ReflVisitor) VisitExpressionList(ctx *gen.ExpressionListContext) any {
-	var expressions []ast.Expression
+func (p *Parser) parseArguments() []ast.Expression {
+	p.expect(LPAREN)
 
-	for _, exprCtx := range ctx.AllExpression() {
-		expr := exprCtx.Accept(v).(ast.Expression)
-		expressions = append(expressions, expr)
+	var args []ast.Expression
+	keywords := false
+	for !p.at(RPAREN) {
+		if len(args) > 0 {
+			p.expect(COMMA)
+		}
+
+		tok := p.cur()
+		arg := p.parseArgument()
+		if _, ok := arg.(*ast.KeywordArgument); ok {
+			keywords = true
+		} else if keywords {
+			p.fail(tok, "positional argument after keyword arguments", nil)
+		}
+		args = append(args, arg)
 	}
+	p.expect(RPAREN)
 
-	return expressions
+	return args
 }
 
-func (v *ReflVisitor) VisitLiteralPrimary(ctx *gen.LiteralPrimaryContext) any {
-	return ctx.Literal().Accept(v)
-}
+// parseArgument parses an argument, a spread `...arr` or a keyword argument `name: value`.
+// `a:b(` starts a method call, so a keyword value calling a function needs parentheses: `f(a: (b()))`.
+func (p *Parser) parseArgument() ast.Expression {
+	start := p.pos
+	tok := p.cur()
 
-func (v *ReflVisitor) VisitIdentifierPrimary(ctx *gen.IdentifierPrimaryContext) any {
-	return &ast.Identifier{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Name: ctx.IDENTIFIER().GetText(),
+	var arg ast.Expression
+	switch {
+	case tok.Type == ELLIPSIS:
+		p.next()
+		arg = &ast.Spread{Pos: p.position(tok), Value: p.parseExpression()}
+	case tok.Type == IDENTIFIER && p.peek(1).Type == COLON &&
+		!(p.peek(2).Type == IDENTIFIER && p.peek(3).Type == LPAREN):
+		p.next()
+		p.next()
+		arg = &ast.KeywordArgument{Pos: p.position(tok), Name: tok.Text, Value: p.parseExpression()}
+	default:
+		return p.parseExpression()
 	}
-}
+	p.markSpan(arg, start)
 
-func (v *ReflVisitor) VisitParenPrimary(ctx *gen.ParenPrimaryContext) any {
-	return ctx.Expression().Accept(v)
+	return arg
 }
 
-func (v *ReflVisitor) VisitFunctionLiteral(ctx *gen.FunctionLiteralContext) any {
-	fl := &ast.FunctionLiteral{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Body: ctx.Block().Accept(v).(*ast.BlockStatement),
-	}
+// parseEither runs the first parse function and falls back to the second one
+// if the first fails. When both fail, the error that got further is reported.
+func (p *Parser) parseEither(first, second func()) {
+	start := p.pos
 
-	if ctx.Parameters() != nil {
-		paramsCtx := ctx.Parameters().(*gen.ParametersContext)
-		for _, id := range paramsCtx.AllIDENTIFIER() {
-			fl.Parameters = append(fl.Parameters, id.GetText())
-		}
+	firstErr := p.speculate(first)
+	if firstErr == nil {
+		return
 	}
 
-	return fl
-}
+	p.pos = start
+	secondErr := p.speculate(second)
+	if secondErr == nil {
+		return
+	}
 
-func (v *ReflVisitor) VisitObjectLiteralPrimary(ctx *gen.ObjectLiteralPrimaryContext) any {
-	return ctx.ObjectLiteral().Accept(v)
-}
+	p.pos = start
 
-func (v *ReflVisitor) VisitArrayLiteralPrimary(ctx *gen.ArrayLiteralPrimaryContext) any {
-	return ctx.ArrayLiteral().Accept(v)
-}
+	furthest, rerun := secondErr, second
+	if secondErr.Line < firstErr.Line || secondErr.Line == firstErr.Line && secondErr.Column < firstErr.Column {
+		furthest, rerun = firstErr, first
+	}
 
-func (v *ReflVisitor) VisitParameters(ctx *gen.ParametersContext) any {
-	var params []string
-	for _, id := range ctx.AllIDENTIFIER() {
-		params = append(params, id.GetText())
+	if p.speculating > 0 {
+		panic(bailout{furthest})
 	}
-	return params
+
+	// re-run the alternative that got further without speculation, so errors
+	// in nested blocks are recovered from and reported individually
+	rerun()
 }
 
-func (v *ReflVisitor) VisitObjectLiteral(ctx *gen.ObjectLiteralContext) any {
-	ol := &ast.ObjectLiteral{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Properties: make(map[string]ast.Expression),
-	}
+func (p *Parser) speculate(fn func()) (err *SyntaxError) {
+	p.speculating++
+	spans := len(p.spans)
 
-	if ctx.AllProperty() != nil {
-		for _, propCtx := range ctx.AllProperty() {
-			prop := propCtx.(*gen.PropertyContext)
-			var key string
-			if prop.STRING() != nil {
-				key = parseString(prop.STRING().GetText())
-			} else {
-				key = prop.IDENTIFIER().GetText()
+	defer func() {
+		p.speculating--
+
+		if r := recover(); r != nil {
+			b, ok := r.(bailout)
+			if !ok {
+				panic(r)
 			}
-			value := prop.Expression().Accept(v).(ast.Expression)
-			ol.Properties[key] = value
+			err = b.err
+			// the nodes of the failed alternative are dropped
+			p.spans = p.spans[:spans]
 		}
-	}
+	}()
 
-	return ol
-}
+	fn()
 
-func (v *ReflVisitor) VisitProperty(ctx *gen.PropertyContext) any {
-	return ctx
+	return nil
 }
 
-func (v *ReflVisitor) VisitArrayLiteral(ctx *gen.ArrayLiteralContext) any {
-	al := &ast.ArrayLiteral{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
+func (p *Parser) canStartExpression() bool {
+	switch p.cur().Type {
+	case MINUS, BANG, AWAIT, NUMBER, STRING, RAW_STRING, NIL, IDENTIFIER, LPAREN, FUN, LBRACE:
+		return true
 	}
+	return false
+}
 
-	for _, exprCtx := range ctx.AllExpression() {
-		expr := exprCtx.Accept(v).(ast.Expression)
-		al.Elements = append(al.Elements, expr)
+func expressionStarts() []string {
+	types := []TokenType{MINUS, BANG, AWAIT, NUMBER, STRING, RAW_STRING, NIL, IDENTIFIER, LPAREN, FUN, LBRACE}
+	result := make([]string, len(types))
+	for i, t := range types {
+		result[i] = t.String()
 	}
+	return result
+}
 
-	return al
+func (p *Parser) cur() Token {
+	return p.tokens[p.pos]
 }
 
-func (v *ReflVisitor) VisitNumberLiteral(ctx *gen.NumberLiteralContext) any {
-	value, err := parseNumber(ctx.NUMBER().GetText())
-	if err != nil {
-		v.parser.error(err.Error())
-		return &ast.NumberLiteral{
-			Pos: ast.Position{
-				Line:   ctx.GetStart().GetLine(),
-				Column: ctx.GetStart().GetColumn(),
-			},
-			Value: 0,
-		}
+func (p *Parser) peek(n int) Token {
+	if p.pos+n >= len(p.tokens) {
+		return p.tokens[len(p.tokens)-1]
 	}
+	return p.tokens[p.pos+n]
+}
 
-	return &ast.NumberLiteral{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Value: value,
-	}
+func (p *Parser) at(t TokenType) bool {
+	return p.tokens[p.pos].Type == t
 }
 
-func (v *ReflVisitor) VisitStringLiteral(ctx *gen.StringLiteralContext) any {
-	return &ast.StringLiteral{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Value: parseString(ctx.STRING().GetText()),
+func (p *Parser) next() Token {
+	tok := p.tokens[p.pos]
+	if tok.Type != EOF {
+		p.pos++
 	}
+	return tok
 }
 
-func (v *ReflVisitor) VisitRawStringLiteral(ctx *gen.RawStringLiteralContext) any {
-	return &ast.RawStringLiteral{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
-		Value: parseRawString(ctx.RAW_STRING().GetText()),
+func (p *Parser) expect(t TokenType) Token {
+	tok := p.cur()
+	if tok.Type != t {
+		if tok.Type == EOF {
+			p.fail(tok, fmt.Sprintf("missing %s at %s", t, tok), []string{t.String()})
+		}
+		p.fail(tok, fmt.Sprintf("mismatched input %s expecting %s", tok, t), []string{t.String()})
 	}
+	return p.next()
 }
 
-func (v *ReflVisitor) VisitNilLiteral(ctx *gen.NilLiteralContext) any {
-	return &ast.NilLiteral{
-		Pos: ast.Position{
-			Line:   ctx.GetStart().GetLine(),
-			Column: ctx.GetStart().GetColumn(),
-		},
+// markSpan records the span of a node from the token at index start to the last consumed token,
+// when parsing with comments. A node keeps its first span, so parentheses are not part of it.
+func (p *Parser) markSpan(node ast.Node, start int) {
+	if !p.options.comments {
+		return
 	}
+	p.spans = append(p.spans, nodeSpan{node: node, start: start, end: max(p.pos-1, start)})
 }
 
-func (v *ReflVisitor) VisitStatement(ctx *gen.StatementContext) any {
-	if ctx.VarDeclaration() != nil {
-		return ctx.VarDeclaration().Accept(v)
-	}
-	if ctx.ExpressionStatement() != nil {
-		return ctx.ExpressionStatement().Accept(v)
-	}
-	if ctx.IfStatement() != nil {
-		return ctx.IfStatement().Accept(v)
-	}
-	if ctx.WhileStatement() != nil {
-		return ctx.WhileStatement().Accept(v)
-	}
-	if ctx.ForStatement() != nil {
-		return ctx.ForStatement().Accept(v)
-	}
-	if ctx.BlockStatement() != nil {
-		return ctx.BlockStatement().Accept(v)
+func (p *Parser) position(tok Token) ast.Position {
+	return ast.Position{Line: tok.Line, Column: tok.Column}
+}
+
+func (p *Parser) errorAt(tok Token, msg string) *SyntaxError {
+	return p.newError(tok, msg, nil)
+}
+
+func (p *Parser) newError(tok Token, msg string, expected []string) *SyntaxError {
+	endLine, endColumn := tok.Line, tok.Column+utf8.RuneCountInString(tok.Text)
+	if nl := strings.LastIndexByte(tok.Text, '\n'); nl >= 0 {
+		endLine += strings.Count(tok.Text, "\n")
+		endColumn = utf8.RuneCountInString(tok.Text[nl+1:])
 	}
-	if ctx.BreakStatement() != nil {
-		return ctx.BreakStatement().Accept(v)
+
+	text := tok.Text
+	if tok.Type == EOF {
+		text = "<EOF>"
 	}
-	if ctx.ContinueStatement() != nil {
-		return ctx.ContinueStatement().Accept(v)
+
+	return newSyntaxError(p.src, msg, text, tok.Line, tok.Column, endLine, endColumn, expected)
+}
+
+func (p *Parser) fail(tok Token, msg string, expected []string) {
+	panic(bailout{p.newError(tok, msg, expected)})
+}
+
+func (p *Parser) recordError(err *SyntaxError) {
+	if p.speculating > 0 {
+		return
 	}
-	if ctx.ReturnStatement() != nil {
-		return ctx.ReturnStatement().Accept(v)
+
+	// recovery can stop at the offending token, which must be reported only once
+	if n := len(p.errors); n > 0 {
+		last := p.errors[n-1].(*SyntaxError)
+		if last.Line == err.Line && last.Column == err.Column {
+			return
+		}
 	}
-	return nil
+
+	p.errors = append(p.errors, err)
 }
 
 func parseNumber(s string) (float64, error) {
@@ -1,6 +1,11 @@
 package parser
 
 import (
+	"errors"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
 	"testing"
 
 	"refl/ast"
@@ -637,6 +642,110 @@ func TestParseReturnStatement(t *testing.T) {
 	checkNumberLiteral(t, retStmt.Value, 42.0)
 }
 
+func TestParseDestructuring(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"var a, b = f()", "var a, b = f()"},
+		{"var {x, y} = point", "var {x, y} = point"},
+		{"var a, b = 1, 2 + 3", "var a, b = 1, (2 + 3)"},
+		{"a, b = b, a", "a, b = b, a"},
+		{"obj.x, arr[0] = 1, 2", "obj.x, arr[0] = 1, 2"},
+		{"{x, y} = point", "{x, y} = point"},
+		{"for i, {x, y} in points { f(x) }", "for i, {x, y} in points {\n  f(x)\n}"},
+		{"return a, b", "return a, b"},
+	}
+
+	for _, tt := range tests {
+		program, err := New().Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.input, err)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("Expected %q to print as %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	program, err := New().Parse("var {x, y} = point")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	vd := program.Statements[0].(*ast.VarDeclaration)
+	if vd.Name != "" || vd.Pattern == nil || !vd.Pattern.Braces || len(vd.Pattern.Elements) != 2 {
+		t.Fatalf("Expected a braces pattern of 2 names, got %#v", vd)
+	}
+
+	program, err = New().Parse("a, b = b, a")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	assign := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.Assignment)
+	if _, ok := assign.Left.(*ast.Pattern); !ok {
+		t.Errorf("Expected Pattern as target, got %T", assign.Left)
+	}
+	if tuple, ok := assign.Right.(*ast.Tuple); !ok || len(tuple.Elements) != 2 {
+		t.Errorf("Expected Tuple of 2 values, got %#v", assign.Right)
+	}
+}
+
+func TestParseParameters(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"fun(a, b = 10, ...rest) {}", "fun(a, b = 10, ...rest) {}"},
+		{"fun(a = 1 + 2) {}", "fun(a = (1 + 2)) {}"},
+		{"fun(...rest) {}", "fun(...rest) {}"},
+		{"f(...arr, 1)", "f(...arr, 1)"},
+		{"f(1, b: 2, c: x.y)", "f(1, b: 2, c: x.y)"},
+		{"f(a: (g()))", "f(a: (g()))"},
+		{"f(a:g())", "f(a:g())"},
+		{"obj:m(...xs, by: 2)", "obj:m(...xs, by: 2)"},
+	}
+
+	for _, tt := range tests {
+		program, err := New().Parse(tt.input)
+		if err != nil {
+			t.Fatalf("Failed to parse %q: %v", tt.input, err)
+		}
+		if got := program.String(); got != tt.expected {
+			t.Errorf("Expected %q to print as %q, got %q", tt.input, tt.expected, got)
+		}
+	}
+
+	program, err := New().Parse("fun(a, b = 10, ...rest) {}")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	fl := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionLiteral)
+	if len(fl.Parameters) != 2 || fl.Rest != "rest" {
+		t.Errorf("Expected parameters a, b and rest, got %v and %q", fl.Parameters, fl.Rest)
+	}
+	if _, ok := fl.Defaults["a"]; ok {
+		t.Error("Expected no default for a")
+	}
+	checkNumberLiteral(t, fl.Defaults["b"], 10.0)
+
+	_, err = New().Parse("fun(...r, a = f(1)) { return a }")
+	var errs ErrorList
+	if !errors.As(err, &errs) || len(errs) != 1 || errs[0].Message != "the rest parameter must be the last one" {
+		t.Errorf("Expected a single rest parameter error, got %v", err)
+	}
+
+	program, err = New().Parse("f(a:g(), a: g())")
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	args := program.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.FunctionCall).Arguments
+	if _, ok := args[0].(*ast.MethodCall); !ok {
+		t.Errorf("Expected MethodCall, got %T", args[0])
+	}
+	if _, ok := args[1].(*ast.MethodCall); !ok {
+		t.Errorf("Expected MethodCall, got %T", args[1])
+	}
+}
+
 func TestParseOperatorPrecedence(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -882,6 +991,17 @@ func TestParseInvalidSyntax(t *testing.T) {
 		{"obj:method(", true, ""},   // Missing closing paren
 		{"obj:method()", false, ""}, // Valid
 		{"(1 + 2", true, ""},        // Missing closing paren
+		{"var a, = 1", true, ""},    // Missing name in pattern
+		{"var {} = x", true, ""},    // Empty pattern
+		{"var {a.b} = x", true, ""}, // Declaring a member
+		{"a, b", true, ""},          // Missing assignment
+		{"a = 1, 2", true, ""},      // Values without pattern
+		{"var a = 1, 2", true, ""},  // Values without pattern
+		{"fun(...a,b){}", true, ""}, // Rest parameter not last
+		{"fun(a=){}", true, ""},     // Missing default
+		{"f(a:1, 2)", true, ""},     // Positional after keyword
+		{"f(...)", true, ""},        // Missing spread value
+		{"f(a:1,...b)", true, ""},   // Spread after keyword
 	}
 
 	for _, tt := range tests {
@@ -1153,3 +1273,315 @@ if x {
 		t.Errorf("Expected if statement at line 3, got %d", ifStmt.Pos.Line)
 	}
 }
+
+func TestParseSyntaxErrors(t *testing.T) {
+	type location struct {
+		line, column, endLine, endColumn int
+		token                            string
+	}
+
+	tests := []struct {
+		name     string
+		input    string
+		expected []location
+	}{
+		{"missing name", "var x = 1\nvar = 2", []location{{2, 4, 2, 5, "="}}},
+		{"errors in several statements", "var = 1\nx = (2\nvar y = 3\nvar z = }", []location{
+			{1, 4, 1, 5, "="},
+			{3, 0, 3, 3, "var"},
+			{4, 8, 4, 9, "}"},
+		}},
+		{"unexpected end", "var a = 1 +\n", []location{{2, 0, 2, 0, "<EOF>"}}},
+		{"unknown character", "var a = 1 ^ 2", []location{{1, 10, 1, 11, "^"}}},
+		{"unterminated raw string", "var a = 1\nvar s = `abc", []location{{2, 8, 2, 9, "`abc"}}},
+		// stray characters used to be skipped, so this parsed as `nx.y = 5`
+		{"stray backslash", `var x = {}\nx.y = 5`, []location{{1, 10, 1, 11, "\\"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := New()
+			program, err := p.Parse(tt.input)
+			if err == nil {
+				t.Fatalf("Expected a syntax error for %q", tt.input)
+			}
+			if program != nil {
+				t.Errorf("Expected no program on syntax errors")
+			}
+
+			var list ErrorList
+			if !errors.As(err, &list) {
+				t.Fatalf("Expected an ErrorList, got %T", err)
+			}
+			if len(list) != len(p.Errors()) {
+				t.Errorf("Expected the ErrorList to hold all %d errors, got %d", len(p.Errors()), len(list))
+			}
+
+			var actual []location
+			for _, e := range p.Errors() {
+				syntaxErr, ok := e.(*SyntaxError)
+				if !ok {
+					t.Fatalf("Expected *SyntaxError, got %T", e)
+				}
+				actual = append(actual, location{syntaxErr.Line, syntaxErr.Column, syntaxErr.EndLine, syntaxErr.EndColumn, syntaxErr.Token})
+			}
+
+			if !reflect.DeepEqual(actual, tt.expected) {
+				t.Errorf("Expected errors at %v, got %v", tt.expected, actual)
+			}
+		})
+	}
+}
+
+func TestParseSyntaxErrorDetails(t *testing.T) {
+	p := New()
+	_, err := p.Parse("var x = 1\n\tvar = 2")
+
+	var syntaxErr *SyntaxError
+	if !errors.As(err, &syntaxErr) {
+		t.Fatalf("Expected a *SyntaxError, got %T", err)
+	}
+
+	if syntaxErr.Error() != syntaxErr.Message+" at line 2, column 5" {
+		t.Errorf("Unexpected error text %q", syntaxErr.Error())
+	}
+	if !strings.Contains(syntaxErr.Message, "'='") {
+		t.Errorf("Expected the message to name the offending token, got %q", syntaxErr.Message)
+	}
+	if !slices.Contains(syntaxErr.Expected, "IDENTIFIER") {
+		t.Errorf("Expected IDENTIFIER among the expected tokens, got %v", syntaxErr.Expected)
+	}
+	if syntaxErr.Excerpt != "\tvar = 2\n\t    ^" {
+		t.Errorf("Unexpected excerpt %q", syntaxErr.Excerpt)
+	}
+}
+
+func TestLexer(t *testing.T) {
+	input := "var s = \"a\\\"b\" # comment\nx.y >= 1.5 && `raw\nstring` != nil"
+
+	expected := []struct {
+		typ          TokenType
+		text         string
+		line, column int
+	}{
+		{VAR, "var", 1, 0},
+		{IDENTIFIER, "s", 1, 4},
+		{ASSIGN, "=", 1, 6},
+		{STRING, "\"a\\\"b\"", 1, 8},
+		{IDENTIFIER, "x", 2, 0},
+		{DOT, ".", 2, 1},
+		{IDENTIFIER, "y", 2, 2},
+		{GE, ">=", 2, 4},
+		{NUMBER, "1.5", 2, 7},
+		{AND, "&&", 2, 11},
+		{RAW_STRING, "`raw\nstring`", 2, 14},
+		{NE, "!=", 3, 8},
+		{NIL, "nil", 3, 11},
+		{EOF, "", 3, 14},
+	}
+
+	lexer := NewLexer(input)
+	tokens := lexer.Tokenize()
+	if len(lexer.Errors()) > 0 {
+		t.Fatalf("Unexpected lexer errors: %v", lexer.Errors())
+	}
+	if len(tokens) != len(expected) {
+		t.Fatalf("Expected %d tokens, got %d: %v", len(expected), len(tokens), tokens)
+	}
+
+	for i, tok := range tokens {
+		want := expected[i]
+		if tok.Type != want.typ || tok.Text != want.text || tok.Line != want.line || tok.Column != want.column {
+			t.Errorf("Token %d: expected %v %q at %d:%d, got %v %q at %d:%d",
+				i, want.typ, want.text, want.line, want.column, tok.Type, tok.Text, tok.Line, tok.Column)
+		}
+		if input[tok.Offset:tok.End] != tok.Text {
+			t.Errorf("Token %d: offsets %d..%d don't match its text %q", i, tok.Offset, tok.End, tok.Text)
+		}
+	}
+}
+
+// largeScript generates a script like the ones produced by code generators: many small functions and objects
+func largeScript(functions int) string {
+	var b strings.Builder
+	for i := 0; i < functions; i++ {
+		fmt.Fprintf(&b, "var handler_%d = fun(event, state) {\n", i)
+		fmt.Fprintf(&b, "  var config = {name: \"handler_%d\", limits: {1, 2, 3}, enabled: 1}\n", i)
+		b.WriteString("  if event.type == \"update\" && state.count < config.limits[2] {\n")
+		b.WriteString("    state.count = state.count + 1 * 2 - (3 % 2)\n")
+		b.WriteString("  } elif !config.enabled {\n")
+		b.WriteString("    return errors.new(`disabled`)\n")
+		b.WriteString("  }\n")
+		b.WriteString("  for key, value in config {\n")
+		b.WriteString("    io.println(key, value, strings:upper(\"x\"))\n")
+		b.WriteString("  }\n")
+		b.WriteString("  return state\n")
+		b.WriteString("}\n")
+	}
+	return b.String()
+}
+
+func BenchmarkParse(b *testing.B) {
+	input := largeScript(1000)
+	b.SetBytes(int64(len(input)))
+
+	for b.Loop() {
+		if _, err := New().Parse(input); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestParseWithComments(t *testing.T) {
+	input := `# header
+# describes x
+var x = 1 # one
+
+var f = fun(a) {
+  # inside
+  return (a + 2) * x # doubled
+  # end of body
+}
+
+if x { y = {
+  # in object
+  k: 1
+} } elif x {
+}
+# end of file
+`
+
+	p := New(OptionComments{})
+	program, err := p.Parse(input)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	if len(program.Comments) != 8 {
+		t.Fatalf("Expected 8 comments, got %d", len(program.Comments))
+	}
+	if c := program.Comments[2]; c.Text != "# one" || c.Pos != (ast.Position{Line: 3, Column: 10}) || input[c.Span.Start:c.Span.End] != c.Text {
+		t.Errorf("Unexpected comment %+v", *c)
+	}
+
+	text := func(node ast.Node) string {
+		trivia := program.TriviaOf(node)
+		if trivia == nil {
+			t.Fatalf("No trivia for %T", node)
+		}
+		return input[trivia.Span.Start:trivia.Span.End]
+	}
+	comments := func(list []*ast.Comment) []string {
+		var result []string
+		for _, c := range list {
+			result = append(result, c.Text)
+		}
+		return result
+	}
+
+	varX := program.Statements[0].(*ast.VarDeclaration)
+	varF := program.Statements[1].(*ast.VarDeclaration)
+	fn := varF.Value.(*ast.FunctionLiteral)
+	ret := fn.Body.Statements[0].(*ast.ReturnStatement)
+	product := ret.Value.(*ast.BinaryExpression)
+	ifStmt := program.Statements[2].(*ast.IfStatement)
+	object := ifStmt.Then.Statements[0].(*ast.ExpressionStatement).Expression.(*ast.Assignment).Right
+
+	spans := []struct {
+		node     ast.Node
+		expected string
+	}{
+		{varX, "var x = 1"},
+		{varX.Value, "1"},
+		{ret, "return (a + 2) * x"},
+		{product, "(a + 2) * x"},
+		{product.Left, "a + 2"},
+		{fn.Body, "{\n  # inside\n  return (a + 2) * x # doubled\n  # end of body\n}"},
+		{ifStmt.Elif[0], "elif x {\n}"},
+		{object, "{\n  # in object\n  k: 1\n}"},
+		{program, input},
+	}
+	for _, tt := range spans {
+		if actual := text(tt.node); actual != tt.expected {
+			t.Errorf("Expected the span of %T to be %q, got %q", tt.node, tt.expected, actual)
+		}
+	}
+
+	attached := []struct {
+		node     ast.Node
+		leading  []string
+		trailing []string
+	}{
+		{varX, []string{"# header", "# describes x"}, []string{"# one"}},
+		{varF, nil, nil},
+		{ret, []string{"# inside"}, []string{"# doubled"}},
+		{fn.Body, nil, []string{"# end of body"}},
+		{object, nil, nil},
+		{object.(*ast.ObjectLiteral).Properties["k"], []string{"# in object"}, nil},
+		{program, nil, []string{"# end of file"}},
+	}
+	for _, tt := range attached {
+		trivia := program.TriviaOf(tt.node)
+		if actual := comments(trivia.Leading); !reflect.DeepEqual(actual, tt.leading) {
+			t.Errorf("Expected leading comments %v for %T, got %v", tt.leading, tt.node, actual)
+		}
+		if actual := comments(trivia.Trailing); !reflect.DeepEqual(actual, tt.trailing) {
+			t.Errorf("Expected trailing comments %v for %T, got %v", tt.trailing, tt.node, actual)
+		}
+	}
+
+	plain, err := New().Parse(input)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	if plain.Comments != nil || plain.TriviaOf(plain.Statements[0]) != nil {
+		t.Errorf("Expected no comments or trivia without OptionComments")
+	}
+}
+
+func TestParseDocComments(t *testing.T) {
+	input := `# license header
+
+## Adds two numbers.
+##
+##   add(1, 2) # 3
+var add = fun(a, b) { return a + b }
+
+## Not the doc of sub.
+# a plain comment
+var sub = fun(a, b) { return a - b }
+
+var shapes = {
+  ## Area of a rectangle.
+  area: fun(w, h) { return w * h },
+  # not documented
+  "perimeter": fun(w, h) { return 2 * (w + h) }
+}`
+
+	program, err := New(OptionComments{}).Parse(input)
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	object := program.Statements[2].(*ast.VarDeclaration).Value.(*ast.ObjectLiteral)
+
+	tests := []struct {
+		name     string
+		node     ast.Node
+		expected string
+	}{
+		{"declaration", program.Statements[0], "Adds two numbers.\n\n  add(1, 2) # 3"},
+		{"plain comment in between", program.Statements[1], ""},
+		{"undocumented declaration", program.Statements[2], ""},
+		{"property", object.Properties["area"], "Area of a rectangle."},
+		{"plain comment on property", object.Properties["perimeter"], ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := program.TriviaOf(tt.node).Doc(); actual != tt.expected {
+				t.Errorf("Expected doc %q, got %q", tt.expected, actual)
+			}
+		})
+	}
+}
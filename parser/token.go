@@ -0,0 +1,145 @@
+package parser
+
+import "fmt"
+
+type TokenType int
+
+const (
+	EOF TokenType = iota
+
+	IDENTIFIER
+	NUMBER
+	STRING
+	RAW_STRING
+
+	// Keywords
+	VAR
+	IF
+	ELIF
+	ELSE
+	WHILE
+	FOR
+	IN
+	BREAK
+	CONTINUE
+	RETURN
+	FUN
+	NIL
+	AWAIT
+
+	// Operators
+	DOT
+	ELLIPSIS
+	COLON
+	LPAREN
+	RPAREN
+	LBRACKET
+	RBRACKET
+	LBRACE
+	RBRACE
+	COMMA
+	SEMICOLON
+	ASSIGN
+	PLUS
+	MINUS
+	ASTERISK
+	SLASH
+	PERCENT
+	BANG
+	LT
+	GT
+	LE
+	GE
+	EQ
+	NE
+	AND
+	OR
+)
+
+var tokenNames = map[TokenType]string{
+	EOF:        "<EOF>",
+	IDENTIFIER: "IDENTIFIER",
+	NUMBER:     "NUMBER",
+	STRING:     "STRING",
+	RAW_STRING: "RAW_STRING",
+	VAR:        "'var'",
+	IF:         "'if'",
+	ELIF:       "'elif'",
+	ELSE:       "'else'",
+	WHILE:      "'while'",
+	FOR:        "'for'",
+	IN:         "'in'",
+	BREAK:      "'break'",
+	CONTINUE:   "'continue'",
+	RETURN:     "'return'",
+	FUN:        "'fun'",
+	NIL:        "'nil'",
+	AWAIT:      "'await'",
+	DOT:        "'.'",
+	ELLIPSIS:   "'...'",
+	COLON:      "':'",
+	LPAREN:     "'('",
+	RPAREN:     "')'",
+	LBRACKET:   "'['",
+	RBRACKET:   "']'",
+	LBRACE:     "'{'",
+	RBRACE:     "'}'",
+	COMMA:      "','",
+	SEMICOLON:  "';'",
+	ASSIGN:     "'='",
+	PLUS:       "'+'",
+	MINUS:      "'-'",
+	ASTERISK:   "'*'",
+	SLASH:      "'/'",
+	PERCENT:    "'%'",
+	BANG:       "'!'",
+	LT:         "'<'",
+	GT:         "'>'",
+	LE:         "'<='",
+	GE:         "'>='",
+	EQ:         "'=='",
+	NE:         "'!='",
+	AND:        "'&&'",
+	OR:         "'||'",
+}
+
+var keywords = map[string]TokenType{
+	"var":      VAR,
+	"if":       IF,
+	"elif":     ELIF,
+	"else":     ELSE,
+	"while":    WHILE,
+	"for":      FOR,
+	"in":       IN,
+	"break":    BREAK,
+	"continue": CONTINUE,
+	"return":   RETURN,
+	"fun":      FUN,
+	"nil":      NIL,
+	"await":    AWAIT,
+}
+
+func (t TokenType) String() string {
+	if name, ok := tokenNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
+// Token is a single lexical token. Line is 1-based, Column is 0-based and
+// counted in runes; Offset and End are byte offsets into the source.
+type Token struct {
+	Type   TokenType
+	Text   string
+	Line   int
+	Column int
+	Offset int
+	End    int
+}
+
+func (t Token) String() string {
+	if t.Type == EOF {
+		return "<EOF>"
+	}
+	return fmt.Sprintf("'%s'", t.Text)
+}
@@ -0,0 +1,37 @@
+package profile
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Coverage counts how many times the statements starting on each line of a file were evaluated
+type Coverage struct {
+	Filename string
+	// Lines maps the lines having statements to their hit counts, unexecuted lines are present with zero
+	Lines map[int]int64
+}
+
+// WriteLCOV writes the coverage as an lcov tracefile, which genhtml and most editors read
+func (c *Coverage) WriteLCOV(w io.Writer) error {
+	lines := make([]int, 0, len(c.Lines))
+	hit := 0
+	for line, count := range c.Lines {
+		lines = append(lines, line)
+		if count > 0 {
+			hit++
+		}
+	}
+	sort.Ints(lines)
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "TN:\nSF:%s\n", c.Filename)
+	for _, line := range lines {
+		fmt.Fprintf(bw, "DA:%d,%d\n", line, c.Lines[line])
+	}
+	fmt.Fprintf(bw, "LF:%d\nLH:%d\nend_of_record\n", len(lines), hit)
+
+	return bw.Flush()
+}
@@ -0,0 +1,212 @@
+// Package profile writes script profiles in the pprof format and line coverage in the lcov format
+package profile
+
+import (
+	"compress/gzip"
+	"io"
+	"time"
+)
+
+// Function is a script function, a builtin or the top level code of a script
+type Function struct {
+	Name      string
+	Filename  string
+	StartLine int
+}
+
+// Frame is a function on a call stack, Line is the line the function is executing
+type Frame struct {
+	Function Function
+	Line     int
+}
+
+// Sample is the aggregate of the calls made with the same call stack
+type Sample struct {
+	// Stack is the call stack, the called function first
+	Stack []Frame
+	Calls int64
+	// Time is spent in the called function itself, without the functions it called
+	Time time.Duration
+}
+
+// Profile holds the samples recorded over a period of time
+type Profile struct {
+	Samples  []Sample
+	Start    time.Time
+	Duration time.Duration
+}
+
+// Profile message field numbers of pprof's profile.proto
+const (
+	fieldProfileSampleType        = 1
+	fieldProfileSample            = 2
+	fieldProfileLocation          = 4
+	fieldProfileFunction          = 5
+	fieldProfileStringTable       = 6
+	fieldProfileTimeNanos         = 9
+	fieldProfileDurationNanos     = 10
+	fieldProfilePeriodType        = 11
+	fieldProfilePeriod            = 12
+	fieldProfileDefaultSampleType = 14
+
+	fieldValueTypeType = 1
+	fieldValueTypeUnit = 2
+
+	fieldSampleLocationID = 1
+	fieldSampleValue      = 2
+
+	fieldLocationID   = 1
+	fieldLocationLine = 4
+
+	fieldLineFunctionID = 1
+	fieldLineLine       = 2
+
+	fieldFunctionID         = 1
+	fieldFunctionName       = 2
+	fieldFunctionSystemName = 3
+	fieldFunctionFilename   = 4
+	fieldFunctionStartLine  = 5
+)
+
+// WritePprof writes the profile as a gzipped profile.proto message, which `go tool pprof` reads.
+// Samples have two values, the number of calls and the time in nanoseconds, the latter is shown by default.
+func (p *Profile) WritePprof(w io.Writer) error {
+	table := []string{""}
+	tableIndex := map[string]int{"": 0}
+	str := func(s string) uint64 {
+		if i, ok := tableIndex[s]; ok {
+			return uint64(i)
+		}
+		tableIndex[s] = len(table)
+		table = append(table, s)
+		return uint64(len(table) - 1)
+	}
+
+	var out protoBuffer
+
+	valueType := func(field int, typ, unit string) {
+		var vt protoBuffer
+		vt.uint(fieldValueTypeType, str(typ))
+		vt.uint(fieldValueTypeUnit, str(unit))
+		out.message(field, &vt)
+	}
+	valueType(fieldProfileSampleType, "calls", "count")
+	valueType(fieldProfileSampleType, "time", "nanoseconds")
+
+	functions := make(map[Function]uint64)
+	var functionsBuf protoBuffer
+	function := func(fn Function) uint64 {
+		if id, ok := functions[fn]; ok {
+			return id
+		}
+		id := uint64(len(functions) + 1)
+		functions[fn] = id
+
+		var buf protoBuffer
+		buf.uint(fieldFunctionID, id)
+		buf.uint(fieldFunctionName, str(fn.Name))
+		buf.uint(fieldFunctionSystemName, str(fn.Name))
+		buf.uint(fieldFunctionFilename, str(fn.Filename))
+		buf.uint(fieldFunctionStartLine, uint64(fn.StartLine))
+		functionsBuf.message(fieldProfileFunction, &buf)
+		return id
+	}
+
+	locations := make(map[Frame]uint64)
+	var locationsBuf protoBuffer
+	location := func(frame Frame) uint64 {
+		if id, ok := locations[frame]; ok {
+			return id
+		}
+		id := uint64(len(locations) + 1)
+		locations[frame] = id
+
+		var line protoBuffer
+		line.uint(fieldLineFunctionID, function(frame.Function))
+		line.uint(fieldLineLine, uint64(frame.Line))
+
+		var buf protoBuffer
+		buf.uint(fieldLocationID, id)
+		buf.message(fieldLocationLine, &line)
+		locationsBuf.message(fieldProfileLocation, &buf)
+		return id
+	}
+
+	for _, sample := range p.Samples {
+		ids := make([]uint64, len(sample.Stack))
+		for i, frame := range sample.Stack {
+			ids[i] = location(frame)
+		}
+
+		var buf protoBuffer
+		buf.packed(fieldSampleLocationID, ids)
+		buf.packed(fieldSampleValue, []uint64{uint64(sample.Calls), uint64(sample.Time.Nanoseconds())})
+		out.message(fieldProfileSample, &buf)
+	}
+
+	out.bytes = append(out.bytes, locationsBuf.bytes...)
+	out.bytes = append(out.bytes, functionsBuf.bytes...)
+
+	out.uint(fieldProfileTimeNanos, uint64(p.Start.UnixNano()))
+	out.uint(fieldProfileDurationNanos, uint64(p.Duration.Nanoseconds()))
+	valueType(fieldProfilePeriodType, "time", "nanoseconds")
+	out.uint(fieldProfilePeriod, 1)
+	out.uint(fieldProfileDefaultSampleType, str("time"))
+
+	// the string table goes last, every string has been interned by now
+	for _, s := range table {
+		out.string(fieldProfileStringTable, s)
+	}
+
+	gz := gzip.NewWriter(w)
+	if _, err := gz.Write(out.bytes); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// protoBuffer encodes protocol buffer fields
+type protoBuffer struct {
+	bytes []byte
+}
+
+func (b *protoBuffer) varint(x uint64) {
+	for x >= 0x80 {
+		b.bytes = append(b.bytes, byte(x)|0x80)
+		x >>= 7
+	}
+	b.bytes = append(b.bytes, byte(x))
+}
+
+func (b *protoBuffer) tag(field int, wireType int) {
+	b.varint(uint64(field)<<3 | uint64(wireType))
+}
+
+// uint writes a varint field, zero values are omitted like proto3 does
+func (b *protoBuffer) uint(field int, x uint64) {
+	if x == 0 {
+		return
+	}
+	b.tag(field, 0)
+	b.varint(x)
+}
+
+func (b *protoBuffer) string(field int, s string) {
+	b.tag(field, 2)
+	b.varint(uint64(len(s)))
+	b.bytes = append(b.bytes, s...)
+}
+
+func (b *protoBuffer) message(field int, msg *protoBuffer) {
+	b.tag(field, 2)
+	b.varint(uint64(len(msg.bytes)))
+	b.bytes = append(b.bytes, msg.bytes...)
+}
+
+func (b *protoBuffer) packed(field int, xs []uint64) {
+	var buf protoBuffer
+	for _, x := range xs {
+		buf.varint(x)
+	}
+	b.message(field, &buf)
+}
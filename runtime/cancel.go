@@ -0,0 +1,44 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+)
+
+// Cancelled is returned when an evaluation stops because its context was cancelled,
+// it unwraps to the context error
+type Cancelled struct {
+	Cause error
+}
+
+func (e *Cancelled) Error() string {
+	return "context cancelled"
+}
+
+func (e *Cancelled) Unwrap() error {
+	return e.Cause
+}
+
+func NewCancelled(ctx context.Context) *Cancelled {
+	cause := ctx.Err()
+	if cause == nil {
+		cause = context.Canceled
+	}
+
+	return &Cancelled{Cause: cause}
+}
+
+// IsCancelled reports whether err is caused by a context cancellation
+func IsCancelled(err error) bool {
+	var cancelled *Cancelled
+	return errors.As(err, &cancelled) || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// CheckContext returns a cancellation error if ctx is done
+func CheckContext(ctx context.Context) error {
+	if ctx.Err() != nil {
+		return NewCancelled(ctx)
+	}
+
+	return nil
+}
@@ -0,0 +1,149 @@
+package clock
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Fake is a manually advanced clock. Its timers only fire when Advance or Set moves
+// the time past their deadline, which makes timing in tests deterministic.
+type Fake struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	changed chan struct{}
+}
+
+// NewFake creates a fake clock starting at the given time
+func NewFake(start time.Time) *Fake {
+	return &Fake{
+		now:     start,
+		changed: make(chan struct{}),
+	}
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+func (f *Fake) NewTimer(d time.Duration) Timer {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	timer := &fakeTimer{
+		clock:    f,
+		deadline: f.now.Add(d),
+		c:        make(chan time.Time, 1),
+	}
+
+	if d <= 0 {
+		timer.c <- f.now
+		return timer
+	}
+
+	f.timers = append(f.timers, timer)
+	f.notifyLocked()
+
+	return timer
+}
+
+// Advance moves the clock forward and fires the timers whose deadline has passed
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	f.setLocked(f.now.Add(d))
+	f.mu.Unlock()
+}
+
+// Set moves the clock to the given time and fires the timers whose deadline has passed
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	f.setLocked(t)
+	f.mu.Unlock()
+}
+
+// Timers returns the number of active timers
+func (f *Fake) Timers() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.timers)
+}
+
+// BlockUntil waits until at least n timers are active, which means that
+// the goroutines under test are waiting for the clock to be advanced
+func (f *Fake) BlockUntil(n int) {
+	for {
+		f.mu.Lock()
+		if len(f.timers) >= n {
+			f.mu.Unlock()
+			return
+		}
+		changed := f.changed
+		f.mu.Unlock()
+
+		<-changed
+	}
+}
+
+func (f *Fake) setLocked(t time.Time) {
+	f.now = t
+
+	var fired []*fakeTimer
+	active := f.timers[:0]
+	for _, timer := range f.timers {
+		if timer.deadline.After(t) {
+			active = append(active, timer)
+		} else {
+			fired = append(fired, timer)
+		}
+	}
+	f.timers = active
+
+	sort.Slice(fired, func(i, j int) bool {
+		return fired[i].deadline.Before(fired[j].deadline)
+	})
+
+	for _, timer := range fired {
+		timer.c <- t
+	}
+
+	f.notifyLocked()
+}
+
+func (f *Fake) notifyLocked() {
+	close(f.changed)
+	f.changed = make(chan struct{})
+}
+
+func (f *Fake) removeLocked(timer *fakeTimer) bool {
+	for i, other := range f.timers {
+		if other == timer {
+			f.timers = append(f.timers[:i], f.timers[i+1:]...)
+			f.notifyLocked()
+			return true
+		}
+	}
+
+	return false
+}
+
+type fakeTimer struct {
+	clock    *Fake
+	deadline time.Time
+	c        chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	return t.clock.removeLocked(t)
+}
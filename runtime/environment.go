@@ -96,3 +96,19 @@ func (e *Environment) GlobalsIterator() iter.Seq2[string, Object] {
 		}
 	}
 }
+
+// Parent returns the enclosing environment, or nil for the global one
+func (e *Environment) Parent() *Environment {
+	return e.parent
+}
+
+// Locals iterates over the variables defined in this environment, without its parents
+func (e *Environment) Locals() iter.Seq2[string, Object] {
+	return func(yield func(string, Object) bool) {
+		for name, variable := range e.values {
+			if !yield(name, variable.value) {
+				return
+			}
+		}
+	}
+}
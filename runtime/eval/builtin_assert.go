@@ -0,0 +1,181 @@
+package eval
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// assertionFailed stops the script with the failure, prefixed by the optional message argument
+func assertionFailed(name string, args []runtime.Object, messageIndex int, format string, values ...any) error {
+	msg := fmt.Sprintf(format, values...)
+	if len(args) > messageIndex {
+		msg = args[messageIndex].String() + ": " + msg
+	}
+
+	return runtime.NewPanic(fmt.Sprintf("assert.%s failed: %s", name, msg), 0, 0)
+}
+
+// formatValue renders a value for assertion failures, strings are quoted and objects show their contents
+func formatValue(value runtime.Object) string {
+	return formatValueDepth(value, 0)
+}
+
+func formatValueDepth(value runtime.Object, depth int) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case *objects.String:
+		return strconv.Quote(v.Value)
+	case *objects.ReflObject:
+		if depth > 3 {
+			return "{...}"
+		}
+
+		var entries []string
+		for key, val := range v.Iterator() {
+			entries = append(entries, formatValueDepth(key, depth+1)+": "+formatValueDepth(val, depth+1))
+		}
+		sort.Strings(entries)
+
+		return "{" + strings.Join(entries, ", ") + "}"
+	case *objects.UserError:
+		return "error(" + strconv.Quote(v.String()) + ")"
+	}
+
+	return value.String()
+}
+
+// deepEqual compares objects by their contents, other values with Equal
+func deepEqual(a, b runtime.Object, visited map[[2]*objects.ReflObject]bool) bool {
+	objA, okA := a.(*objects.ReflObject)
+	objB, okB := b.(*objects.ReflObject)
+	if !okA || !okB {
+		return a.Equal(b)
+	}
+
+	if objA == objB || visited[[2]*objects.ReflObject{objA, objB}] {
+		return true
+	}
+	visited[[2]*objects.ReflObject{objA, objB}] = true
+
+	if objA.Length() != objB.Length() {
+		return false
+	}
+
+	for key, valA := range objA.Iterator() {
+		valB, err := objB.Get(key)
+		if err != nil || !deepEqual(valA, valB, visited) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func builtinAssertEqualFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) < 2 {
+		return nil, runtime.NewPanic("assert.equal() expects at least 2 arguments", 0, 0)
+	}
+
+	if !args[0].Equal(args[1]) {
+		return nil, assertionFailed("equal", args, 2, "expected %s, got %s", formatValue(args[1]), formatValue(args[0]))
+	}
+
+	return objects.NilInstance, nil
+}
+
+func builtinAssertDeepEqualFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) < 2 {
+		return nil, runtime.NewPanic("assert.deep_equal() expects at least 2 arguments", 0, 0)
+	}
+
+	if !deepEqual(args[0], args[1], make(map[[2]*objects.ReflObject]bool)) {
+		return nil, assertionFailed("deep_equal", args, 2, "expected %s, got %s", formatValue(args[1]), formatValue(args[0]))
+	}
+
+	return objects.NilInstance, nil
+}
+
+func builtinAssertThrowsFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) < 1 {
+		return nil, runtime.NewPanic("assert.throws() expects at least 1 argument", 0, 0)
+	}
+
+	fn, ok := args[0].(runtime.Callable)
+	if !ok {
+		return nil, runtime.NewPanic("assert.throws() first argument must be a function", 0, 0)
+	}
+
+	_, err := fn.Call(ctx, nil)
+	if runtime.IsCancelled(err) {
+		return nil, err
+	}
+
+	if err == nil {
+		return nil, assertionFailed("throws", args, 2, "function did not throw")
+	}
+
+	if len(args) > 1 && args[1] != objects.NilInstance && !strings.Contains(err.Error(), args[1].String()) {
+		return nil, assertionFailed("throws", args, 2, "expected an error containing %s, got %s",
+			strconv.Quote(args[1].String()), strconv.Quote(err.Error()))
+	}
+
+	return objects.ErrorFrom(err), nil
+}
+
+func builtinAssertIsErrFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) < 1 {
+		return nil, runtime.NewPanic("assert.is_err() expects at least 1 argument", 0, 0)
+	}
+
+	if _, ok := args[0].(*objects.UserError); !ok {
+		return nil, assertionFailed("is_err", args, 1, "expected an error, got %s", formatValue(args[0]))
+	}
+
+	return args[0], nil
+}
+
+func builtinAssertApproxFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) < 2 {
+		return nil, runtime.NewPanic("assert.approx() expects at least 2 arguments", 0, 0)
+	}
+
+	actual, ok1 := args[0].(*objects.Number)
+	expected, ok2 := args[1].(*objects.Number)
+	if !ok1 || !ok2 {
+		return nil, runtime.NewPanic("assert.approx() arguments must be numbers", 0, 0)
+	}
+
+	epsilon := 1e-9
+	if len(args) > 2 {
+		eps, ok := args[2].(*objects.Number)
+		if !ok {
+			return nil, runtime.NewPanic("assert.approx() epsilon must be a number", 0, 0)
+		}
+		epsilon = eps.Value
+	}
+
+	if math.Abs(actual.Value-expected.Value) > epsilon {
+		return nil, assertionFailed("approx", args, 3, "expected %v ± %v, got %v", expected.Value, epsilon, actual.Value)
+	}
+
+	return objects.NilInstance, nil
+}
+
+func createAssertObject() runtime.Object {
+	obj := objects.NewObject()
+
+	defLiteralBuiltinFunc("equal", obj, builtinAssertEqualFunc)
+	defLiteralBuiltinFunc("deep_equal", obj, builtinAssertDeepEqualFunc)
+	defLiteralBuiltinFunc("throws", obj, builtinAssertThrowsFunc)
+	defLiteralBuiltinFunc("is_err", obj, builtinAssertIsErrFunc)
+	defLiteralBuiltinFunc("approx", obj, builtinAssertApproxFunc)
+
+	return obj
+}
@@ -0,0 +1,110 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"reflect"
+	"time"
+)
+
+func builtinChanNewFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) > 1 {
+		return nil, runtime.NewPanic("chan.new() expects at most 1 argument", 0, 0)
+	}
+
+	size := 0
+	if len(args) == 1 {
+		sizeObj, ok := args[0].(*objects.Number)
+		if !ok || sizeObj.Value < 0 {
+			return nil, runtime.NewPanic("chan.new() argument must be a non-negative number", 0, 0)
+		}
+		size = int(sizeObj.Value)
+	}
+
+	return objects.NewChannel(size), nil
+}
+
+// builtinChanSelectFunc waits until any of the channels has a value or is closed.
+// An optional timeout in milliseconds limits the wait, 0 makes it non-blocking.
+// Returns {index, value, ok}, index is -1 if the timeout expired.
+func builtinChanSelectFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) != 1 && len(args) != 2 {
+		return nil, runtime.NewPanic("chan.select() expects 1 or 2 arguments", 0, 0)
+	}
+
+	iterable, ok := args[0].(runtime.Iterable)
+	if !ok {
+		return nil, runtime.NewPanic("chan.select() first argument must be an iterable object", 0, 0)
+	}
+
+	var channels []*objects.Channel
+	for _, value := range iterable.Iterator() {
+		channel, ok := value.(*objects.Channel)
+		if !ok {
+			return nil, runtime.NewPanic("chan.select() can only select on channels", 0, 0)
+		}
+		channels = append(channels, channel)
+	}
+
+	// every channel has a value case followed by a closed case
+	cases := make([]reflect.SelectCase, 0, len(channels)*2+2)
+	for _, channel := range channels {
+		cases = append(cases,
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(channel.Values())},
+			reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(channel.Closed())},
+		)
+	}
+
+	ctxCase := len(cases)
+	cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())})
+
+	if len(args) == 2 {
+		millis, ok := args[1].(*objects.Number)
+		if !ok {
+			return nil, runtime.NewPanic("chan.select() second argument must be a number", 0, 0)
+		}
+
+		if millis.Value <= 0 {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectDefault})
+		} else {
+			timer := clockFromContext(ctx).NewTimer(time.Duration(millis.Value) * time.Millisecond)
+			defer timer.Stop()
+
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(timer.C())})
+		}
+	}
+
+	chosen, recv, _ := reflect.Select(cases)
+
+	result := objects.NewObject()
+
+	switch {
+	case chosen == ctxCase:
+		return nil, runtime.NewCancelled(ctx)
+	case chosen > ctxCase:
+		result.SetLiteral("index", objects.NewNumber(-1))
+		result.SetLiteral("value", objects.NilInstance)
+		result.SetLiteral("ok", objects.NewBoolean(false))
+	case chosen%2 == 0:
+		result.SetLiteral("index", objects.NewNumber(float64(chosen/2)))
+		result.SetLiteral("value", recv.Interface().(runtime.Object))
+		result.SetLiteral("ok", objects.NewBoolean(true))
+	default:
+		value, ok := channels[chosen/2].TryRecv()
+		result.SetLiteral("index", objects.NewNumber(float64(chosen/2)))
+		result.SetLiteral("value", value)
+		result.SetLiteral("ok", objects.NewBoolean(ok))
+	}
+
+	return result, nil
+}
+
+func createChanObject() runtime.Object {
+	obj := objects.NewObject()
+
+	defLiteralBuiltinFunc("new", obj, builtinChanNewFunc)
+	defLiteralBuiltinFunc("select", obj, builtinChanSelectFunc)
+
+	return obj
+}
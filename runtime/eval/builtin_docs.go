@@ -0,0 +1,146 @@
+package eval
+
+import (
+	"context"
+	"refl/ast"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"sort"
+)
+
+// builtinDocs documents the builtin globals and module members, keyed like "len" or "math.abs"
+var builtinDocs = map[string]string{
+	"type":   "type(value) - returns the type name of the value",
+	"str":    "str(value) - converts the value to a string",
+	"number": "number(value) - converts the value to a number",
+	"len":    "len(value) - returns the length of a string or an object",
+	"range":  "range(from, to[, step]) - iterates over the numbers from `from` up to `to`, exclusive",
+	"clone":  "clone(value) - creates a deep copy of the value, functions are copied by reference",
+	"eval":   "eval(code) - evaluates refl code and returns its result, or an error",
+	"refl":   "refl(fn, args...) - runs fn in a coroutine and returns a promise of its result",
+	"$":      "$ - the global environment, `$.name` reads and writes global variables",
+
+	"refl.pool": "refl.pool(n) - creates a pool running at most n coroutines at once, submit(fn, args...) queues a coroutine",
+
+	"math":         "math - mathematical functions",
+	"math.abs":     "math.abs(x) - returns the absolute value of x",
+	"math.floor":   "math.floor(x) - rounds x down",
+	"math.ceil":    "math.ceil(x) - rounds x up",
+	"math.round":   "math.round(x) - rounds x to the nearest integer",
+	"math.sqrt":    "math.sqrt(x) - returns the square root of a non-negative x",
+	"math.pow":     "math.pow(x, y) - returns x to the power of y",
+	"math.max":     "math.max(x, ...) - returns the largest of the arguments",
+	"math.min":     "math.min(x, ...) - returns the smallest of the arguments",
+	"math.random":  "math.random() - returns a random number in [0, 1)",
+	"math.PI":      "math.PI - the ratio of a circle's circumference to its diameter",
+	"math.E":       "math.E - the base of natural logarithms",
+	"math.INF":     "math.INF - positive infinity",
+	"math.NEG_INF": "math.NEG_INF - negative infinity",
+	"math.NAN":     "math.NAN - not a number",
+
+	"strings":            "strings - string manipulation",
+	"strings.upper":      "strings.upper(s) - converts s to upper case",
+	"strings.lower":      "strings.lower(s) - converts s to lower case",
+	"strings.trim":       "strings.trim(s) - removes the leading and trailing whitespace",
+	"strings.split":      "strings.split(s, sep) - splits s around sep into an array",
+	"strings.join":       "strings.join(sep, arr) - joins the array elements with sep",
+	"strings.contains":   "strings.contains(s, substr) - checks whether s contains substr",
+	"strings.has_prefix": "strings.has_prefix(s, prefix) - checks whether s starts with prefix",
+	"strings.has_suffix": "strings.has_suffix(s, suffix) - checks whether s ends with suffix",
+	"strings.replace":    "strings.replace(s, old, new[, n]) - replaces the first n occurrences of old, all by default",
+	"strings.index":      "strings.index(s, substr) - returns the index of the first occurrence of substr, or -1",
+	"strings.last_index": "strings.last_index(s, substr) - returns the index of the last occurrence of substr, or -1",
+
+	"time":        "time - time functions, times are unix milliseconds",
+	"time.parse":  "time.parse(s) - parses a time in one of the common layouts such as RFC 3339",
+	"time.format": "time.format(t) - formats the time as RFC 3339",
+	"time.now":    "time.now() - returns the current time",
+	"time.sleep":  "time.sleep(ms) - blocks for the given number of milliseconds",
+
+	"io":         "io - input and output",
+	"io.print":   "io.print(values...) - prints the values separated by spaces",
+	"io.println": "io.println(values...) - prints the values separated by spaces and a newline",
+	"io.printf":  "io.printf(pattern, values...) - prints the pattern with each `$` replaced by the next value",
+
+	"errors":              "errors - creating and inspecting errors",
+	"errors.new":          "errors.new(message) - creates an error",
+	"errors.fmt":          "errors.fmt(pattern, values...) - creates an error with each `$` replaced by the next value",
+	"errors.is":           "errors.is(value) - checks whether the value is an error",
+	"errors.is_cancelled": "errors.is_cancelled(err) - checks whether the error was caused by a cancellation",
+	"errors.panic":        "errors.panic(message) - stops the program with an unrecoverable error",
+	"errors.on_unhandled": "errors.on_unhandled(fn) - calls fn with unhandled promise rejections, returns a function removing the hook",
+
+	"events":          "events - event loop functions",
+	"events.schedule": "events.schedule(fn, at, args...) - calls fn at the given unix time in milliseconds, returns a cancel function",
+	"events.register": "events.register(event, fn[, priority]) - calls fn(event, args...) for the event or a wildcard pattern like `order.*`, returns an unregister function",
+	"events.once":     "events.once(event, fn[, priority]) - like register, but the handler is removed after its first call",
+	"events.emit":     "events.emit(event, args...) - fires the event, handlers are called from the event loop",
+	"events.timeout":  "events.timeout(fn, ms, args...) - calls fn after ms milliseconds, returns a cancel function",
+	"events.interval": "events.interval(fn, ms, args...) - calls fn every ms milliseconds, returns a cancel function",
+	"events.debounce": "events.debounce(fn, ms) - returns a function calling fn once it hasn't been called for ms milliseconds",
+	"events.throttle": "events.throttle(fn, ms) - returns a function calling fn at most once per ms milliseconds",
+
+	"promise":             "promise - creating and combining promises",
+	"promise.new":         "promise.new(fn) - creates a promise settled by fn(resolve, reject)",
+	"promise.resolve":     "promise.resolve(value) - creates a promise resolved with the value",
+	"promise.reject":      "promise.reject(message) - creates a rejected promise",
+	"promise.all":         "promise.all(promises) - resolves with all results once every promise resolves, rejects on the first rejection",
+	"promise.race":        "promise.race(promises) - settles like the first settled promise",
+	"promise.any":         "promise.any(promises) - resolves with the first result, rejects once every promise rejects",
+	"promise.all_settled": "promise.all_settled(promises) - resolves with the {status, value, reason} of every promise once all settle",
+
+	"chan":        "chan - channels for message passing between coroutines",
+	"chan.new":    "chan.new([size]) - creates a channel, buffered if size is given",
+	"chan.select": "chan.select(channels[, ms]) - receives from the first ready channel, returns {index, value, ok}, index is -1 on timeout",
+
+	"sync":            "sync - coroutine synchronization",
+	"sync.mutex":      "sync.mutex() - creates a mutex with lock, try_lock and unlock",
+	"sync.rwmutex":    "sync.rwmutex() - creates a readers-writer mutex with lock, unlock, rlock and runlock",
+	"sync.wait_group": "sync.wait_group() - creates a wait group with add, done and wait",
+	"sync.semaphore":  "sync.semaphore(n) - creates a semaphore with n slots with acquire, try_acquire and release",
+	"sync.once":       "sync.once() - creates an object whose do(fn) calls fn only once",
+	"sync.shared":     "sync.shared([obj]) - copies the object into one which is shared between coroutines by reference",
+
+	"assert":            "assert - assertions for tests, a failed assertion stops the program with an error",
+	"assert.equal":      "assert.equal(actual, expected[, message]) - checks that the values are equal",
+	"assert.deep_equal": "assert.deep_equal(actual, expected[, message]) - checks that the values are equal, comparing objects by their contents",
+	"assert.throws":     "assert.throws(fn[, substr[, message]]) - checks that fn() fails with an error containing substr, returns the error",
+	"assert.is_err":     "assert.is_err(value[, message]) - checks that the value is an error and returns it",
+	"assert.approx":     "assert.approx(actual, expected[, epsilon[, message]]) - checks that the numbers differ by at most epsilon, 1e-9 by default",
+}
+
+// BuiltinDoc returns the documentation of a builtin global or module member such as "math.abs"
+func BuiltinDoc(name string) (string, bool) {
+	doc, ok := builtinDocs[name]
+	return doc, ok
+}
+
+// Builtins returns the names of the builtin globals, along with the sorted member names of the modules
+func Builtins() map[string][]string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	env := runtime.NewEnvironment(nil)
+	New(ctx, &ast.Program{}, env)
+
+	result := make(map[string][]string)
+	for name, value := range env.GlobalsIterator() {
+		var members []string
+
+		switch v := value.(type) {
+		case *objects.ReflObject:
+			for key := range v.Iterator() {
+				members = append(members, key.String())
+			}
+		case *reflObject:
+			for key := range v.members.Iterator() {
+				members = append(members, key.String())
+			}
+		}
+
+		sort.Strings(members)
+		result[name] = members
+	}
+
+	return result
+}
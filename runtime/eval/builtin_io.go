@@ -5,33 +5,31 @@ import (
 	"fmt"
 	"refl/runtime"
 	"refl/runtime/objects"
+	"strings"
 )
 
-func builtinIOPrintFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+// joinArgs joins the arguments with spaces, so that they're printed with a single write
+func joinArgs(args []runtime.Object) string {
+	parts := make([]string, len(args))
 	for i, arg := range args {
-		if i > 0 {
-			fmt.Print(" ")
-		}
-		fmt.Print(arg.String())
+		parts[i] = arg.String()
 	}
+	return strings.Join(parts, " ")
+}
+
+func builtinIOPrintFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	fmt.Fprint(stdoutFromContext(ctx), joinArgs(args))
 
 	return objects.NilInstance, nil
 }
 
-func builtinIOPrintlnFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
-	for i, arg := range args {
-		if i > 0 {
-			fmt.Print(" ")
-		}
-		fmt.Print(arg.String())
-	}
-
-	fmt.Println()
+func builtinIOPrintlnFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	fmt.Fprintln(stdoutFromContext(ctx), joinArgs(args))
 
 	return objects.NilInstance, nil
 }
 
-func builtinIOPrintfFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+func builtinIOPrintfFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
 	if len(args) < 1 {
 		return nil, runtime.NewPanic("printf() expects at least 1 argument", 0, 0)
 	}
@@ -65,7 +63,7 @@ func builtinIOPrintfFunc(_ context.Context, args []runtime.Object) (runtime.Obje
 		result += " $ERROR{" + args[i].String() + "}"
 	}
 
-	fmt.Print(result)
+	fmt.Fprint(stdoutFromContext(ctx), result)
 
 	return objects.NilInstance, nil
 }
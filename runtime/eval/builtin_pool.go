@@ -0,0 +1,194 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"slices"
+	"sync"
+)
+
+// coroutinePool limits the number of coroutines running at the same time. Queued coroutines
+// have neither a goroutine nor an evaluator until they get a slot. A nil pool doesn't limit anything.
+type coroutinePool struct {
+	size int
+
+	mu        sync.Mutex
+	active    int
+	waiting   []*poolEntry
+	completed int
+}
+
+// poolEntry is a coroutine waiting for a slot
+type poolEntry struct {
+	ctx   context.Context
+	start func(release func())
+	fail  func(error)
+	// stop unregisters the cancellation callback, it reports false if the callback already runs
+	stop func() bool
+}
+
+func newCoroutinePool(size int) *coroutinePool {
+	return &coroutinePool{size: size}
+}
+
+// schedule calls start with the function releasing the slot once one is free, right away if there is one.
+// If ctx is cancelled while waiting, fail is called with the cancellation instead.
+func (p *coroutinePool) schedule(ctx context.Context, start func(release func()), fail func(error)) {
+	if p == nil {
+		start(func() {})
+		return
+	}
+	if ctx.Err() != nil {
+		fail(runtime.NewCancelled(ctx))
+		return
+	}
+
+	p.mu.Lock()
+	if p.active < p.size {
+		p.active++
+		p.mu.Unlock()
+		start(p.release)
+		return
+	}
+
+	entry := &poolEntry{ctx: ctx, start: start, fail: fail}
+	p.waiting = append(p.waiting, entry)
+	// the callback runs in its own goroutine, after the lock is released
+	entry.stop = context.AfterFunc(ctx, func() {
+		p.mu.Lock()
+		i := slices.Index(p.waiting, entry)
+		if i >= 0 {
+			p.waiting = slices.Delete(p.waiting, i, i+1)
+		}
+		p.mu.Unlock()
+
+		if i >= 0 {
+			fail(runtime.NewCancelled(ctx))
+		}
+	})
+	p.mu.Unlock()
+}
+
+// release hands the slot over to the first queued coroutine, or frees it
+func (p *coroutinePool) release() {
+	var cancelled []*poolEntry
+
+	p.mu.Lock()
+	p.completed++
+	var next *poolEntry
+	for len(p.waiting) > 0 && next == nil {
+		entry := p.waiting[0]
+		p.waiting = p.waiting[1:]
+		if entry.stop() {
+			next = entry
+		} else {
+			// the cancellation callback no longer finds the entry, failing it is up to us
+			cancelled = append(cancelled, entry)
+		}
+	}
+	if next == nil {
+		p.active--
+	}
+	p.mu.Unlock()
+
+	for _, entry := range cancelled {
+		entry.fail(runtime.NewCancelled(entry.ctx))
+	}
+	if next != nil {
+		next.start(p.release)
+	}
+}
+
+func (p *coroutinePool) stats() *objects.ReflObject {
+	result := objects.NewObject()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	result.SetLiteral("size", objects.NewNumber(float64(p.size)))
+	result.SetLiteral("active", objects.NewNumber(float64(p.active)))
+	result.SetLiteral("queued", objects.NewNumber(float64(len(p.waiting))))
+	result.SetLiteral("completed", objects.NewNumber(float64(p.completed)))
+
+	return result
+}
+
+func newPoolObject(pool *coroutinePool) *objects.ReflObject {
+	obj := objects.NewSharedObject()
+
+	defLiteralBuiltinFunc("submit", obj, func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+		if len(args) < 1 {
+			return nil, runtime.NewPanic("submit() expects at least 1 argument", 0, 0)
+		}
+
+		fn, ok := args[0].(*objects.Function)
+		if !ok {
+			return nil, runtime.NewPanic("submit() first argument must be a function", 0, 0)
+		}
+
+		return spawnCoroutine(ctx, fn, args[1:], pool), nil
+	})
+
+	defLiteralBuiltinFunc("stats", obj, func(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+		return pool.stats(), nil
+	})
+
+	return obj
+}
+
+func builtinReflPoolFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) != 1 {
+		return nil, runtime.NewPanic("pool() expects exactly 1 argument", 0, 0)
+	}
+
+	size, ok := args[0].(*objects.Number)
+	if !ok || size.Value < 1 {
+		return nil, runtime.NewPanic("pool() argument must be a positive number", 0, 0)
+	}
+
+	return newPoolObject(newCoroutinePool(int(size.Value))), nil
+}
+
+// reflObject is the refl() builtin, it also holds coroutine helpers such as refl.pool()
+type reflObject struct {
+	members *objects.ReflObject
+}
+
+func newReflObject() *reflObject {
+	members := objects.NewObject()
+	defLiteralBuiltinFunc("pool", members, builtinReflPoolFunc)
+
+	return &reflObject{members: members}
+}
+
+func (r *reflObject) Type() runtime.ObjectType { return runtime.FunctionType }
+func (r *reflObject) String() string           { return "function" }
+func (r *reflObject) Truthy() bool             { return true }
+func (r *reflObject) Equal(other runtime.Object) bool {
+	return r == other
+}
+func (r *reflObject) Clone() runtime.Object { return r }
+
+func (r *reflObject) Call(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	return builtinReflFunc(ctx, args)
+}
+
+func (r *reflObject) Get(key runtime.Object) (runtime.Object, error) {
+	return r.members.Get(key)
+}
+
+func (r *reflObject) Set(key, value runtime.Object) error {
+	return runtime.NewPanic("cannot modify refl object", 0, 0)
+}
+
+func (r *reflObject) Length() int {
+	return r.members.Length()
+}
+
+func (r *reflObject) Not() runtime.Object {
+	return objects.NewBoolean(!r.Truthy())
+}
+
+func (r *reflObject) HashKey() runtime.HashKey {
+	return "refl"
+}
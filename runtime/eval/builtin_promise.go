@@ -0,0 +1,300 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"strings"
+	"sync"
+)
+
+// promiseItems collects the elements of the iterable argument of a promise combinator
+func promiseItems(name string, args []runtime.Object) ([]runtime.Object, error) {
+	if len(args) != 1 {
+		return nil, runtime.NewPanic(name+" expects exactly 1 argument", 0, 0)
+	}
+
+	iterable, ok := args[0].(runtime.Iterable)
+	if !ok {
+		return nil, runtime.NewPanic(name+" argument must be an iterable object", 0, 0)
+	}
+
+	var items []runtime.Object
+	for _, value := range iterable.Iterator() {
+		items = append(items, value)
+	}
+
+	return items, nil
+}
+
+// onSettled calls fn once the item is settled. Values other than promises count as fulfilled.
+func onSettled(item runtime.Object, fn func(result runtime.Object, err error)) {
+	if promise, ok := item.(*objects.Promise); ok {
+		promise.OnSettle(fn)
+		return
+	}
+
+	fn(item, nil)
+}
+
+// cancelAll returns a cancel function cancelling every promise in items
+func cancelAll(items []runtime.Object) context.CancelFunc {
+	return func() {
+		for _, item := range items {
+			if promise, ok := item.(*objects.Promise); ok {
+				promise.Cancel()
+			}
+		}
+	}
+}
+
+func newArray(values []runtime.Object) *objects.ReflObject {
+	result := objects.NewObject()
+	for i, value := range values {
+		_ = result.Set(objects.NewNumber(float64(i)), value)
+	}
+	return result
+}
+
+// newPromise creates a promise whose unhandled rejection is reported by the evaluator running the builtin
+func newPromise(ctx context.Context, cancel context.CancelFunc) *objects.Promise {
+	return objects.NewPromise(cancel).TrackRejections(ctx.Value("evaluator").(*Evaluator))
+}
+
+// resolveWith fulfills the promise with value, following it if value is a promise itself
+func resolveWith(promise *objects.Promise, value runtime.Object) {
+	if other, ok := value.(*objects.Promise); ok {
+		other.OnSettle(promise.Settle)
+		return
+	}
+
+	promise.Resolve(value)
+}
+
+func builtinPromiseNewFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) != 1 {
+		return nil, runtime.NewPanic("promise.new() expects exactly 1 argument", 0, 0)
+	}
+
+	executor, ok := args[0].(*objects.Function)
+	if !ok {
+		return nil, runtime.NewPanic("promise.new() argument must be a function", 0, 0)
+	}
+
+	promise := newPromise(ctx, nil)
+
+	resolve := objects.NewWrapperFunction(func(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+		var value runtime.Object = objects.NilInstance
+		if len(args) > 0 {
+			value = args[0]
+		}
+
+		resolveWith(promise, value)
+
+		return objects.NilInstance, nil
+	})
+
+	reject := objects.NewWrapperFunction(func(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+		msg := "< no message >"
+		if len(args) > 0 {
+			msg = args[0].String()
+		}
+
+		promise.Reject(runtime.NewPanic(msg, 0, 0))
+
+		return objects.NilInstance, nil
+	})
+
+	if _, err := executor.Call(ctx, []runtime.Object{resolve, reject}); err != nil {
+		promise.Reject(err)
+	}
+
+	return promise, nil
+}
+
+func builtinPromiseResolveFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) > 1 {
+		return nil, runtime.NewPanic("promise.resolve() expects at most 1 argument", 0, 0)
+	}
+
+	var value runtime.Object = objects.NilInstance
+	if len(args) == 1 {
+		value = args[0]
+	}
+
+	if other, ok := value.(*objects.Promise); ok {
+		return other, nil
+	}
+
+	promise := newPromise(ctx, nil)
+	promise.Resolve(value)
+
+	return promise, nil
+}
+
+func builtinPromiseRejectFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) != 1 {
+		return nil, runtime.NewPanic("promise.reject() expects exactly 1 argument", 0, 0)
+	}
+
+	promise := newPromise(ctx, nil)
+	promise.Reject(runtime.NewPanic(args[0].String(), 0, 0))
+
+	return promise, nil
+}
+
+func builtinPromiseAllFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	items, err := promiseItems("promise.all()", args)
+	if err != nil {
+		return nil, err
+	}
+
+	promise := newPromise(ctx, cancelAll(items))
+	if len(items) == 0 {
+		promise.Resolve(objects.NewObject())
+		return promise, nil
+	}
+
+	var mu sync.Mutex
+	values := make([]runtime.Object, len(items))
+	remaining := len(items)
+
+	for i, item := range items {
+		onSettled(item, func(result runtime.Object, err error) {
+			if err != nil {
+				promise.Reject(err)
+				return
+			}
+
+			mu.Lock()
+			values[i] = result
+			remaining--
+			done := remaining == 0
+			mu.Unlock()
+
+			if done {
+				promise.Resolve(newArray(values))
+			}
+		})
+	}
+
+	return promise, nil
+}
+
+func builtinPromiseRaceFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	items, err := promiseItems("promise.race()", args)
+	if err != nil {
+		return nil, err
+	}
+
+	promise := newPromise(ctx, cancelAll(items))
+
+	for _, item := range items {
+		onSettled(item, func(result runtime.Object, err error) {
+			if err != nil {
+				promise.Reject(err)
+				return
+			}
+
+			promise.Resolve(result)
+		})
+	}
+
+	return promise, nil
+}
+
+func builtinPromiseAnyFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	items, err := promiseItems("promise.any()", args)
+	if err != nil {
+		return nil, err
+	}
+
+	promise := newPromise(ctx, cancelAll(items))
+	if len(items) == 0 {
+		promise.Reject(errors.New("all promises were rejected"))
+		return promise, nil
+	}
+
+	var mu sync.Mutex
+	reasons := make([]string, len(items))
+	remaining := len(items)
+
+	for i, item := range items {
+		onSettled(item, func(result runtime.Object, err error) {
+			if err == nil {
+				promise.Resolve(result)
+				return
+			}
+
+			mu.Lock()
+			reasons[i] = err.Error()
+			remaining--
+			done := remaining == 0
+			mu.Unlock()
+
+			if done {
+				promise.Reject(fmt.Errorf("all promises were rejected: %s", strings.Join(reasons, "; ")))
+			}
+		})
+	}
+
+	return promise, nil
+}
+
+func builtinPromiseAllSettledFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	items, err := promiseItems("promise.all_settled()", args)
+	if err != nil {
+		return nil, err
+	}
+
+	promise := newPromise(ctx, cancelAll(items))
+	if len(items) == 0 {
+		promise.Resolve(objects.NewObject())
+		return promise, nil
+	}
+
+	var mu sync.Mutex
+	outcomes := make([]runtime.Object, len(items))
+	remaining := len(items)
+
+	for i, item := range items {
+		onSettled(item, func(result runtime.Object, err error) {
+			outcome := objects.NewObject()
+			if err != nil {
+				outcome.SetLiteral("status", objects.NewString(string(objects.PromiseStateRejected)))
+				outcome.SetLiteral("reason", objects.ErrorFrom(err))
+			} else {
+				outcome.SetLiteral("status", objects.NewString(string(objects.PromiseStateFulfilled)))
+				outcome.SetLiteral("value", result)
+			}
+
+			mu.Lock()
+			outcomes[i] = outcome
+			remaining--
+			done := remaining == 0
+			mu.Unlock()
+
+			if done {
+				promise.Resolve(newArray(outcomes))
+			}
+		})
+	}
+
+	return promise, nil
+}
+
+func createPromiseObject() runtime.Object {
+	obj := objects.NewObject()
+
+	defLiteralBuiltinFunc("new", obj, builtinPromiseNewFunc)
+	defLiteralBuiltinFunc("resolve", obj, builtinPromiseResolveFunc)
+	defLiteralBuiltinFunc("reject", obj, builtinPromiseRejectFunc)
+	defLiteralBuiltinFunc("all", obj, builtinPromiseAllFunc)
+	defLiteralBuiltinFunc("race", obj, builtinPromiseRaceFunc)
+	defLiteralBuiltinFunc("any", obj, builtinPromiseAnyFunc)
+	defLiteralBuiltinFunc("all_settled", obj, builtinPromiseAllSettledFunc)
+
+	return obj
+}
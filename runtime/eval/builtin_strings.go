@@ -46,7 +46,7 @@ func builtinStringTrimSpaceFunc(_ context.Context, args []runtime.Object) (runti
 	return objects.NewString(strings.TrimSpace(str.Value)), nil
 }
 
-func builtinStringSplitFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+func builtinStringSplitFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
 	if len(args) != 2 {
 		return nil, runtime.NewPanic("string.split() expects exactly 2 arguments", 0, 0)
 	}
@@ -65,13 +65,19 @@ func builtinStringSplitFunc(_ context.Context, args []runtime.Object) (runtime.O
 	result := objects.NewObject()
 
 	for i, part := range parts {
+		if i%cancelCheckInterval == 0 {
+			if err := runtime.CheckContext(ctx); err != nil {
+				return nil, err
+			}
+		}
+
 		_ = result.Set(objects.NewNumber(float64(i)), objects.NewString(part))
 	}
 
 	return result, nil
 }
 
-func builtinStringJoinFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+func builtinStringJoinFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
 	if len(args) != 2 {
 		return nil, runtime.NewPanic("string.join() expects exactly 2 arguments", 0, 0)
 	}
@@ -88,6 +94,12 @@ func builtinStringJoinFunc(_ context.Context, args []runtime.Object) (runtime.Ob
 
 	var stringParts []string
 	for key, value := range arr.Iterator() {
+		if len(stringParts)%cancelCheckInterval == 0 {
+			if err := runtime.CheckContext(ctx); err != nil {
+				return nil, err
+			}
+		}
+
 		if key.Type() == runtime.NumberType {
 			stringParts = append(stringParts, value.String())
 		}
@@ -150,7 +162,7 @@ func builtinStringHasSuffixFunc(_ context.Context, args []runtime.Object) (runti
 	return objects.NewBoolean(strings.HasSuffix(str.Value, suffix.Value)), nil
 }
 
-func builtinStringReplaceFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+func builtinStringReplaceFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
 	if len(args) != 3 && len(args) != 4 {
 		return nil, runtime.NewPanic("string.replace() expects 3 or 4 arguments", 0, 0)
 	}
@@ -179,10 +191,45 @@ func builtinStringReplaceFunc(_ context.Context, args []runtime.Object) (runtime
 		n = int(num.Value)
 	}
 
-	result := strings.Replace(str.Value, oldStr.Value, newStr.Value, n)
+	result, err := replaceContext(ctx, str.Value, oldStr.Value, newStr.Value, n)
+	if err != nil {
+		return nil, err
+	}
+
 	return objects.NewString(result), nil
 }
 
+// cancelCheckInterval is how many iterations long-running builtins do between context checks
+const cancelCheckInterval = 1024
+
+// replaceContext works like strings.Replace, but stops once ctx is cancelled
+func replaceContext(ctx context.Context, s, old, new string, n int) (string, error) {
+	if old == "" || n == 0 {
+		return strings.Replace(s, old, new, n), nil
+	}
+
+	var b strings.Builder
+	for replaced := 0; n < 0 || replaced < n; replaced++ {
+		if replaced%cancelCheckInterval == 0 {
+			if err := runtime.CheckContext(ctx); err != nil {
+				return "", err
+			}
+		}
+
+		i := strings.Index(s, old)
+		if i < 0 {
+			break
+		}
+
+		b.WriteString(s[:i])
+		b.WriteString(new)
+		s = s[i+len(old):]
+	}
+	b.WriteString(s)
+
+	return b.String(), nil
+}
+
 func builtinStringIndexFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
 	if len(args) != 2 {
 		return nil, runtime.NewPanic("string.index() expects exactly 2 arguments", 0, 0)
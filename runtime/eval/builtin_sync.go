@@ -0,0 +1,348 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"sync"
+)
+
+// semaphore is a counting semaphore whose acquire can be cancelled
+type semaphore chan struct{}
+
+func (s semaphore) acquire(ctx context.Context) error {
+	select {
+	case s <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return runtime.NewCancelled(ctx)
+	}
+}
+
+func (s semaphore) tryAcquire() bool {
+	select {
+	case s <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (s semaphore) release() bool {
+	select {
+	case <-s:
+		return true
+	default:
+		return false
+	}
+}
+
+// waiter tracks a state guarded by mu, waiting goroutines are woken up by closing changed
+type waiter struct {
+	mu      sync.Mutex
+	changed chan struct{}
+}
+
+// wait blocks until ready returns true, ready is called with the lock held
+func (w *waiter) wait(ctx context.Context, ready func() bool) error {
+	for {
+		w.mu.Lock()
+		if ready() {
+			w.mu.Unlock()
+			return nil
+		}
+
+		if w.changed == nil {
+			w.changed = make(chan struct{})
+		}
+		changed := w.changed
+		w.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return runtime.NewCancelled(ctx)
+		}
+	}
+}
+
+// update modifies the state and wakes up the waiting goroutines
+func (w *waiter) update(fn func() error) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := fn(); err != nil {
+		return err
+	}
+
+	if w.changed != nil {
+		close(w.changed)
+		w.changed = nil
+	}
+
+	return nil
+}
+
+func defSyncMethod(name string, obj *objects.ReflObject, fn func(ctx context.Context) error) {
+	defLiteralBuiltinFunc(name, obj, func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+		if len(args) != 0 {
+			return nil, runtime.NewPanic(name+"() expects no arguments", 0, 0)
+		}
+
+		if err := fn(ctx); err != nil {
+			return nil, err
+		}
+
+		return objects.NilInstance, nil
+	})
+}
+
+func defSyncTryMethod(name string, obj *objects.ReflObject, fn func() bool) {
+	defLiteralBuiltinFunc(name, obj, func(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+		if len(args) != 0 {
+			return nil, runtime.NewPanic(name+"() expects no arguments", 0, 0)
+		}
+
+		return objects.NewBoolean(fn()), nil
+	})
+}
+
+func newMutexObject() *objects.ReflObject {
+	obj := objects.NewSharedObject()
+	sem := make(semaphore, 1)
+
+	defSyncMethod("lock", obj, sem.acquire)
+	defSyncTryMethod("try_lock", obj, sem.tryAcquire)
+	defSyncMethod("unlock", obj, func(context.Context) error {
+		if !sem.release() {
+			return runtime.NewPanic("unlock of unlocked mutex", 0, 0)
+		}
+		return nil
+	})
+
+	return obj
+}
+
+func newRWMutexObject() *objects.ReflObject {
+	obj := objects.NewSharedObject()
+
+	var w waiter
+	readers := 0
+	writer := false
+	writersWaiting := 0
+
+	defSyncMethod("lock", obj, func(ctx context.Context) error {
+		_ = w.update(func() error {
+			writersWaiting++
+			return nil
+		})
+
+		err := w.wait(ctx, func() bool {
+			if writer || readers > 0 {
+				return false
+			}
+			writer = true
+			writersWaiting--
+			return true
+		})
+		if err != nil {
+			_ = w.update(func() error {
+				writersWaiting--
+				return nil
+			})
+		}
+
+		return err
+	})
+
+	defSyncMethod("unlock", obj, func(context.Context) error {
+		return w.update(func() error {
+			if !writer {
+				return runtime.NewPanic("unlock of unlocked rwmutex", 0, 0)
+			}
+			writer = false
+			return nil
+		})
+	})
+
+	defSyncMethod("rlock", obj, func(ctx context.Context) error {
+		return w.wait(ctx, func() bool {
+			if writer || writersWaiting > 0 {
+				return false
+			}
+			readers++
+			return true
+		})
+	})
+
+	defSyncMethod("runlock", obj, func(context.Context) error {
+		return w.update(func() error {
+			if readers == 0 {
+				return runtime.NewPanic("runlock of unlocked rwmutex", 0, 0)
+			}
+			readers--
+			return nil
+		})
+	})
+
+	return obj
+}
+
+func newWaitGroupObject() *objects.ReflObject {
+	obj := objects.NewSharedObject()
+
+	var w waiter
+	counter := 0
+
+	defLiteralBuiltinFunc("add", obj, func(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+		delta := 1.0
+		if len(args) > 0 {
+			num, ok := args[0].(*objects.Number)
+			if !ok {
+				return nil, runtime.NewPanic("add() argument must be a number", 0, 0)
+			}
+			delta = num.Value
+		}
+
+		err := w.update(func() error {
+			if counter+int(delta) < 0 {
+				return runtime.NewPanic("negative wait group counter", 0, 0)
+			}
+			counter += int(delta)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		return objects.NilInstance, nil
+	})
+
+	defSyncMethod("done", obj, func(context.Context) error {
+		return w.update(func() error {
+			if counter == 0 {
+				return runtime.NewPanic("negative wait group counter", 0, 0)
+			}
+			counter--
+			return nil
+		})
+	})
+
+	defSyncMethod("wait", obj, func(ctx context.Context) error {
+		return w.wait(ctx, func() bool {
+			return counter == 0
+		})
+	})
+
+	return obj
+}
+
+func newSemaphoreObject(size int) *objects.ReflObject {
+	obj := objects.NewSharedObject()
+	sem := make(semaphore, size)
+
+	defSyncMethod("acquire", obj, sem.acquire)
+	defSyncTryMethod("try_acquire", obj, sem.tryAcquire)
+	defSyncMethod("release", obj, func(context.Context) error {
+		if !sem.release() {
+			return runtime.NewPanic("release of unacquired semaphore", 0, 0)
+		}
+		return nil
+	})
+
+	return obj
+}
+
+func newOnceObject() *objects.ReflObject {
+	obj := objects.NewSharedObject()
+
+	var once sync.Once
+	var result runtime.Object = objects.NilInstance
+	var resultErr error
+
+	defLiteralBuiltinFunc("do", obj, func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+		if len(args) != 1 {
+			return nil, runtime.NewPanic("do() expects exactly 1 argument", 0, 0)
+		}
+
+		fn, ok := args[0].(*objects.Function)
+		if !ok {
+			return nil, runtime.NewPanic("do() argument must be a function", 0, 0)
+		}
+
+		once.Do(func() {
+			value, err := fn.Call(ctx, []runtime.Object{})
+			if ret, isReturn := value.(*objects.ReturnSignal); isReturn {
+				value = ret.Value
+			}
+			result, resultErr = value, err
+		})
+
+		return result, resultErr
+	})
+
+	return obj
+}
+
+func builtinSyncMutexFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	return newMutexObject(), nil
+}
+
+func builtinSyncRWMutexFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	return newRWMutexObject(), nil
+}
+
+func builtinSyncWaitGroupFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	return newWaitGroupObject(), nil
+}
+
+func builtinSyncSemaphoreFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) != 1 {
+		return nil, runtime.NewPanic("semaphore() expects exactly 1 argument", 0, 0)
+	}
+
+	size, ok := args[0].(*objects.Number)
+	if !ok || size.Value < 1 {
+		return nil, runtime.NewPanic("semaphore() argument must be a positive number", 0, 0)
+	}
+
+	return newSemaphoreObject(int(size.Value)), nil
+}
+
+func builtinSyncOnceFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	return newOnceObject(), nil
+}
+
+// builtinSyncSharedFunc copies an object into a shared object which can be used from multiple coroutines
+func builtinSyncSharedFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	shared := objects.NewSharedObject()
+	if len(args) == 0 {
+		return shared, nil
+	}
+
+	iterable, ok := args[0].(runtime.Iterable)
+	if !ok {
+		return nil, runtime.NewPanic("shared() argument must be an iterable object", 0, 0)
+	}
+
+	for key, value := range iterable.Iterator() {
+		if err := shared.Set(key, value.Clone()); err != nil {
+			return nil, err
+		}
+	}
+
+	return shared, nil
+}
+
+func createSyncObject() runtime.Object {
+	obj := objects.NewObject()
+
+	defLiteralBuiltinFunc("mutex", obj, builtinSyncMutexFunc)
+	defLiteralBuiltinFunc("rwmutex", obj, builtinSyncRWMutexFunc)
+	defLiteralBuiltinFunc("wait_group", obj, builtinSyncWaitGroupFunc)
+	defLiteralBuiltinFunc("semaphore", obj, builtinSyncSemaphoreFunc)
+	defLiteralBuiltinFunc("once", obj, builtinSyncOnceFunc)
+	defLiteralBuiltinFunc("shared", obj, builtinSyncSharedFunc)
+
+	return obj
+}
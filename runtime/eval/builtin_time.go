@@ -50,12 +50,12 @@ func builtinTimeFormatFunc(_ context.Context, args []runtime.Object) (runtime.Ob
 	return objects.NewString(formatted), nil
 }
 
-func builtinTimeNowFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+func builtinTimeNowFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
 	if len(args) != 0 {
 		return nil, runtime.NewPanic("time.now() expects no arguments", 0, 0)
 	}
 
-	now := time.Now()
+	now := clockFromContext(ctx).Now()
 	millis := now.UnixMilli()
 
 	return objects.NewNumber(float64(millis)), nil
@@ -77,11 +77,14 @@ func builtinTimeSleepFunc(ctx context.Context, args []runtime.Object) (runtime.O
 
 	duration := time.Duration(num.Value * float64(time.Millisecond))
 
+	timer := clockFromContext(ctx).NewTimer(duration)
+	defer timer.Stop()
+
 	select {
-	case <-time.After(duration):
+	case <-timer.C():
 		return objects.NilInstance, nil
 	case <-ctx.Done():
-		return nil, ctx.Err()
+		return nil, runtime.NewCancelled(ctx)
 	}
 }
 
@@ -72,25 +72,29 @@ func builtinEvalFunc(ctx context.Context, args []runtime.Object) (runtime.Object
 
 	program, err := p.Parse(code)
 	if err != nil {
-		return objects.NewError(err.Error()), nil
+		return objects.ErrorFrom(err), nil
 	}
 
 	options := ctx.Value("options").(Options)
 
 	evaluator := New(ctx, program, runtime.NewEnvironment(nil), OptionSetOptions{options})
+	// the loop is drained once Run returns, its context would stay attached to the caller's otherwise
+	defer evaluator.cancel()
 
 	result, err := evaluator.Run()
 	if err != nil {
-		return objects.NewError(err.Error()), nil
+		// cancellation stops the caller as well instead of becoming a value
+		if runtime.IsCancelled(err) {
+			return nil, err
+		}
+
+		return objects.ErrorFrom(err), nil
 	}
 
 	return result, nil
 }
 
 func builtinReflFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
-	originalEvaluator := ctx.Value("evaluator").(*Evaluator)
-	originalEventLoop := ctx.Value("event_loop").(*eventloop.EventLoop)
-
 	if len(args) < 1 {
 		return nil, runtime.NewPanic("refl() expects at least 1 argument", 0, 0)
 	}
@@ -100,32 +104,63 @@ func builtinReflFunc(ctx context.Context, args []runtime.Object) (runtime.Object
 		return nil, runtime.NewPanic("refl() first argument must be a function", 0, 0)
 	}
 
-	reflArgs := make([]runtime.Object, 0, len(args)-1)
-	for _, arg := range args[1:] {
+	return spawnCoroutine(ctx, fn, args[1:], nil), nil
+}
+
+// spawnCoroutine runs fn in a new goroutine with its own evaluator and returns a promise of its result.
+// The coroutine is queued until it gets a slot in the pool, if any, and in the evaluator-wide coroutine limit,
+// its goroutine and evaluator are only created then.
+func spawnCoroutine(ctx context.Context, fn *objects.Function, args []runtime.Object, pool *coroutinePool) *objects.Promise {
+	originalEvaluator := ctx.Value("evaluator").(*Evaluator)
+	originalEventLoop := ctx.Value("event_loop").(*eventloop.EventLoop)
+
+	reflArgs := make([]runtime.Object, 0, len(args))
+	for _, arg := range args {
 		reflArgs = append(reflArgs, arg.Clone())
 	}
 
 	options := ctx.Value("options").(Options)
 
 	ctx, cancel := context.WithCancel(ctx)
-	evaluator := New(ctx, nil, runtime.NewEnvironment(nil), OptionSetOptions{options})
 
-	promise := objects.NewPromise(cancel)
+	promise := objects.NewPromise(cancel).TrackRejections(originalEvaluator)
 	unlock := originalEventLoop.RegisterLock()
+	options.liveCoroutines.Add(1)
 
-	go func() {
-		defer cancel()
-		defer unlock()
+	done := func() {
+		options.liveCoroutines.Add(-1)
+		unlock()
+		cancel()
+	}
+	fail := func(err error) {
+		promise.Reject(err)
+		done()
+	}
 
-		result, err := evaluator.runCoroutine(fn, reflArgs)
-		if err != nil {
-			promise.Reject(err, originalEvaluator)
-		} else {
-			promise.Resolve(result, originalEvaluator)
-		}
-	}()
+	pool.schedule(ctx, func(releasePool func()) {
+		options.coroutines.schedule(ctx, func(release func()) {
+			evaluator := New(ctx, nil, runtime.NewEnvironment(nil), OptionSetOptions{options})
+			evaluator.coroutine = true
+
+			go func() {
+				defer done()
+				defer releasePool()
+				defer release()
+
+				result, err := evaluator.runCoroutine(fn, reflArgs)
+				if err != nil {
+					promise.Reject(err)
+				} else {
+					promise.Resolve(result)
+				}
+			}()
+		}, func(err error) {
+			releasePool()
+			fail(err)
+		})
+	}, fail)
 
-	return promise, nil
+	return promise
 }
 
 func builtinRangeFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
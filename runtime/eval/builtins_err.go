@@ -61,6 +61,17 @@ func builtinIsErrFunc(_ context.Context, args []runtime.Object) (runtime.Object,
 	return objects.NewBoolean(ok), nil
 }
 
+// builtinIsCancelledFunc checks whether an error was caused by a cancellation, such as promise.cancel()
+func builtinIsCancelledFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
+	if len(args) != 1 {
+		return nil, runtime.NewPanic("is_cancelled() expects exactly 1 argument", 0, 0)
+	}
+
+	userErr, ok := args[0].(*objects.UserError)
+
+	return objects.NewBoolean(ok && userErr.Cancelled()), nil
+}
+
 func builtinPanicFunc(_ context.Context, args []runtime.Object) (runtime.Object, error) {
 	msg := "< no message >"
 	if len(args) > 0 {
@@ -69,13 +80,38 @@ func builtinPanicFunc(_ context.Context, args []runtime.Object) (runtime.Object,
 	return nil, runtime.NewPanic(msg, 0, 0)
 }
 
+// builtinOnUnhandledFunc registers a hook called with the rejections no handler was attached to.
+// Returns a function removing the hook.
+func builtinOnUnhandledFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	evaluator := ctx.Value("evaluator").(*Evaluator)
+
+	if len(args) != 1 {
+		return nil, runtime.NewPanic("on_unhandled() expects exactly 1 argument", 0, 0)
+	}
+
+	fn, ok := args[0].(*objects.Function)
+	if !ok {
+		return nil, runtime.NewPanic("on_unhandled() argument must be a function", 0, 0)
+	}
+
+	remove := evaluator.rejections.addScript(fn)
+
+	return objects.NewWrapperFunction(func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+		remove()
+
+		return objects.NilInstance, nil
+	}), nil
+}
+
 func createErrorsObject() runtime.Object {
 	obj := objects.NewObject()
 
 	defLiteralBuiltinFunc("new", obj, builtinNewErrFunc)
 	defLiteralBuiltinFunc("fmt", obj, builtinErrFmtFunc)
 	defLiteralBuiltinFunc("is", obj, builtinIsErrFunc)
+	defLiteralBuiltinFunc("is_cancelled", obj, builtinIsCancelledFunc)
 	defLiteralBuiltinFunc("panic", obj, builtinPanicFunc)
+	defLiteralBuiltinFunc("on_unhandled", obj, builtinOnUnhandledFunc)
 
 	return obj
 }
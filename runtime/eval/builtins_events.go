@@ -5,42 +5,116 @@ import (
 	"refl/runtime"
 	"refl/runtime/eventloop"
 	"refl/runtime/objects"
+	"strings"
+	"sync"
 	"time"
 )
 
-func builtinRegisterFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+// registerHandler validates the (event, fn[, priority]) arguments of register and once
+func registerHandler(name string, ctx context.Context, args []runtime.Object, once bool) (runtime.Object, error) {
 	eventLoop := ctx.Value("event_loop").(*eventloop.EventLoop)
 
-	if len(args) < 2 {
-		return nil, runtime.NewPanic("register() expects at least 2 argument", 0, 0)
+	if len(args) < 2 || len(args) > 3 {
+		return nil, runtime.NewPanic(name+"() expects 2 or 3 arguments", 0, 0)
 	}
 
 	event, ok := args[0].(*objects.String)
 	if !ok {
-		return nil, runtime.NewPanic("register() first argument must be a string", 0, 0)
+		return nil, runtime.NewPanic(name+"() first argument must be a string", 0, 0)
 	}
 
 	fn, ok := args[1].(*objects.Function)
 	if !ok {
-		return nil, runtime.NewPanic("register() second argument must be a function", 0, 0)
+		return nil, runtime.NewPanic(name+"() second argument must be a function", 0, 0)
+	}
+
+	opts := eventloop.HandlerOptions{Once: once}
+	if len(args) == 3 {
+		priority, ok := args[2].(*objects.Number)
+		if !ok {
+			return nil, runtime.NewPanic(name+"() third argument must be a number", 0, 0)
+		}
+		opts.Priority = int(priority.Value)
 	}
 
-	cancelFunc := eventLoop.RegisterCallback(event.Value, func(ctx context.Context, event string, args []runtime.Object) {
-		reflArgs := make([]runtime.Object, len(args)+1)
-		reflArgs[0] = objects.NewString(event)
-		copy(reflArgs[1:], args)
+	return newCancelFunction(registerScriptHandler(eventLoop, event.Value, fn, opts)), nil
+}
+
+// scriptHandler is the meta of handlers calling a script function, it lets snapshots persist them
+type scriptHandler struct {
+	fn *objects.Function
+}
+
+func registerScriptHandler(eventLoop *eventloop.EventLoop, event string, fn *objects.Function, opts eventloop.HandlerOptions) func() {
+	opts.Meta = &scriptHandler{fn: fn}
+
+	return eventLoop.RegisterHandler(event, func(ctx context.Context, evt eventloop.Event) (runtime.Object, error) {
+		reflArgs := make([]runtime.Object, len(evt.Args)+1)
+		reflArgs[0] = objects.NewString(evt.Name)
+		copy(reflArgs[1:], evt.Args)
+
+		result, err := fn.Call(ctx, reflArgs)
+		if ret, isReturn := result.(*objects.ReturnSignal); isReturn {
+			result = ret.Value
+		}
+
+		return result, err
+	}, opts)
+}
+
+// scriptTimer is the meta of timers calling a script function, it lets snapshots persist them
+type scriptTimer struct {
+	// kind is the name of the builtin which created the timer
+	kind string
+	fn   *objects.Function
+	args []runtime.Object
+}
 
-		_, err := fn.Call(ctx, reflArgs)
+func scheduleScriptTimer(ctx context.Context, eventLoop *eventloop.EventLoop, timer *scriptTimer, at time.Time, interval time.Duration) func() {
+	return eventLoop.ScheduleWithOptions(func() {
+		_, err := timer.fn.Call(ctx, timer.args)
 		if err != nil {
-			panic("callback failed: " + err.Error())
+			panic(timer.kind + " call failed: " + err.Error())
 		}
-	})
+	}, at, eventloop.TaskOptions{Interval: interval, Meta: timer})
+}
 
-	return objects.NewWrapperFunction(func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
-		cancelFunc()
+// builtinRegisterFunc registers a handler for an event or a wildcard pattern like "order.*",
+// handlers with a higher optional priority are called first
+func builtinRegisterFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	return registerHandler("register", ctx, args, false)
+}
 
-		return objects.NilInstance, nil
-	}), nil
+// builtinOnceFunc registers a handler which is removed after its first call
+func builtinOnceFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	return registerHandler("once", ctx, args, true)
+}
+
+// builtinEmitFunc fires an event from the script, handlers are called from the event loop
+func builtinEmitFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	eventLoop := ctx.Value("event_loop").(*eventloop.EventLoop)
+
+	if len(args) < 1 {
+		return nil, runtime.NewPanic("emit() expects at least 1 argument", 0, 0)
+	}
+
+	event, ok := args[0].(*objects.String)
+	if !ok {
+		return nil, runtime.NewPanic("emit() first argument must be a string", 0, 0)
+	}
+
+	if strings.Contains(event.Value, "*") {
+		return nil, runtime.NewPanic("emit() event name cannot contain wildcards", 0, 0)
+	}
+
+	eventArgs := make([]runtime.Object, len(args)-1)
+	for i, arg := range args[1:] {
+		eventArgs[i] = arg.Clone()
+	}
+
+	eventLoop.Fire(event.Value, eventArgs)
+
+	return objects.NilInstance, nil
 }
 
 func builtinScheduleFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
@@ -60,20 +134,132 @@ func builtinScheduleFunc(ctx context.Context, args []runtime.Object) (runtime.Ob
 		return nil, runtime.NewPanic("schedule() second argument must be a number", 0, 0)
 	}
 
-	otherArgs := args[2:]
-	t := time.UnixMilli(int64(millis.Value))
+	timer := &scriptTimer{kind: "schedule", fn: fn, args: args[2:]}
+	cancelFunc := scheduleScriptTimer(ctx, eventLoop, timer, time.UnixMilli(int64(millis.Value)), 0)
 
-	cancelFunc := eventLoop.Schedule(func() {
-		_, err := fn.Call(ctx, otherArgs)
-		if err != nil {
-			panic("schedule call failed: " + err.Error())
-		}
-	}, t)
+	return newCancelFunction(cancelFunc), nil
+}
+
+// timerArgs validates the (fn, ms, args...) arguments shared by the timer builtins
+func timerArgs(name string, args []runtime.Object) (*objects.Function, time.Duration, error) {
+	if len(args) < 2 {
+		return nil, 0, runtime.NewPanic(name+"() expects at least 2 arguments", 0, 0)
+	}
+
+	fn, ok := args[0].(*objects.Function)
+	if !ok {
+		return nil, 0, runtime.NewPanic(name+"() first argument must be a function", 0, 0)
+	}
+
+	millis, ok := args[1].(*objects.Number)
+	if !ok || millis.Value < 0 {
+		return nil, 0, runtime.NewPanic(name+"() second argument must be a non-negative number", 0, 0)
+	}
+
+	return fn, time.Duration(millis.Value * float64(time.Millisecond)), nil
+}
 
+func newCancelFunction(cancelFunc func()) *objects.WrapperFunction {
 	return objects.NewWrapperFunction(func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
 		cancelFunc()
 
 		return objects.NilInstance, nil
+	})
+}
+
+func builtinTimeoutFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	eventLoop := ctx.Value("event_loop").(*eventloop.EventLoop)
+
+	fn, delay, err := timerArgs("timeout", args)
+	if err != nil {
+		return nil, err
+	}
+
+	timer := &scriptTimer{kind: "timeout", fn: fn, args: args[2:]}
+	cancelFunc := scheduleScriptTimer(ctx, eventLoop, timer, eventLoop.Clock().Now().Add(delay), 0)
+
+	return newCancelFunction(cancelFunc), nil
+}
+
+func builtinIntervalFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	eventLoop := ctx.Value("event_loop").(*eventloop.EventLoop)
+
+	fn, interval, err := timerArgs("interval", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if interval <= 0 {
+		return nil, runtime.NewPanic("interval() second argument must be a positive number", 0, 0)
+	}
+
+	timer := &scriptTimer{kind: "interval", fn: fn, args: args[2:]}
+	cancelFunc := scheduleScriptTimer(ctx, eventLoop, timer, eventLoop.Clock().Now().Add(interval), interval)
+
+	return newCancelFunction(cancelFunc), nil
+}
+
+// builtinDebounceFunc returns a function which calls fn with its latest arguments
+// once it hasn't been called for the given delay
+func builtinDebounceFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	eventLoop := ctx.Value("event_loop").(*eventloop.EventLoop)
+
+	fn, delay, err := timerArgs("debounce", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) > 2 {
+		return nil, runtime.NewPanic("debounce() expects exactly 2 arguments", 0, 0)
+	}
+
+	var mu sync.Mutex
+	cancelPending := func() {}
+
+	return objects.NewWrapperFunction(func(_ context.Context, callArgs []runtime.Object) (runtime.Object, error) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		cancelPending()
+		cancelPending = eventLoop.Schedule(func() {
+			_, err := fn.Call(ctx, callArgs)
+			if err != nil {
+				panic("debounce call failed: " + err.Error())
+			}
+		}, eventLoop.Clock().Now().Add(delay))
+
+		return objects.NilInstance, nil
+	}), nil
+}
+
+// builtinThrottleFunc returns a function which calls fn at most once per the given period,
+// calls made while the period hasn't passed yet are dropped
+func builtinThrottleFunc(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	fn, period, err := timerArgs("throttle", args)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(args) > 2 {
+		return nil, runtime.NewPanic("throttle() expects exactly 2 arguments", 0, 0)
+	}
+
+	clk := clockFromContext(ctx)
+
+	var mu sync.Mutex
+	var lastCall time.Time
+
+	return objects.NewWrapperFunction(func(callCtx context.Context, callArgs []runtime.Object) (runtime.Object, error) {
+		mu.Lock()
+		now := clk.Now()
+		if !lastCall.IsZero() && now.Sub(lastCall) < period {
+			mu.Unlock()
+			return objects.NilInstance, nil
+		}
+		lastCall = now
+		mu.Unlock()
+
+		return fn.Call(callCtx, callArgs)
 	}), nil
 }
 
@@ -82,6 +268,12 @@ func createEventsObject() runtime.Object {
 
 	defLiteralBuiltinFunc("schedule", obj, builtinScheduleFunc)
 	defLiteralBuiltinFunc("register", obj, builtinRegisterFunc)
+	defLiteralBuiltinFunc("once", obj, builtinOnceFunc)
+	defLiteralBuiltinFunc("emit", obj, builtinEmitFunc)
+	defLiteralBuiltinFunc("timeout", obj, builtinTimeoutFunc)
+	defLiteralBuiltinFunc("interval", obj, builtinIntervalFunc)
+	defLiteralBuiltinFunc("debounce", obj, builtinDebounceFunc)
+	defLiteralBuiltinFunc("throttle", obj, builtinThrottleFunc)
 
 	return obj
 }
@@ -0,0 +1,73 @@
+package eval
+
+import (
+	"refl/runtime"
+	"refl/runtime/objects"
+)
+
+// SharedBuiltins are the builtin modules and functions every evaluator defines in its environment.
+// Evaluators create their own unless given shared ones with OptionSharedBuiltins.
+type SharedBuiltins struct {
+	entries []builtinEntry
+}
+
+type builtinEntry struct {
+	name  string
+	value runtime.Object
+	// events entries are left out when events are disabled
+	events bool
+}
+
+// NewSharedBuiltins creates builtins whose modules are frozen, so that scripts can't modify them
+// and any number of evaluators can share them, even when running at the same time
+func NewSharedBuiltins() *SharedBuiltins {
+	b := newBuiltins()
+	for _, entry := range b.entries {
+		if obj, ok := entry.value.(*objects.ReflObject); ok {
+			obj.Freeze()
+		}
+	}
+	return b
+}
+
+func newBuiltins() *SharedBuiltins {
+	return &SharedBuiltins{entries: []builtinEntry{
+		{name: "math", value: createMathObject()},
+		{name: "strings", value: createStringObject()},
+		{name: "errors", value: createErrorsObject()},
+		{name: "io", value: createIoObject()},
+		{name: "time", value: createTimeObject()},
+		{name: "chan", value: createChanObject()},
+		{name: "sync", value: createSyncObject()},
+		{name: "assert", value: createAssertObject()},
+		{name: "events", value: createEventsObject(), events: true},
+		{name: "promise", value: createPromiseObject(), events: true},
+
+		{name: "type", value: objects.NewWrapperFunction(builtinTypeFunc)},
+		{name: "str", value: objects.NewWrapperFunction(builtinStrFunc)},
+		{name: "number", value: objects.NewWrapperFunction(builtinNumberFunc)},
+		{name: "len", value: objects.NewWrapperFunction(builtinLenFunc)},
+		{name: "range", value: objects.NewWrapperFunction(builtinRangeFunc)},
+		{name: "clone", value: objects.NewWrapperFunction(builtinCloneFunc)},
+		{name: "eval", value: objects.NewWrapperFunction(builtinEvalFunc), events: true},
+	}}
+}
+
+func (b *SharedBuiltins) define(env *runtime.Environment, options Options) {
+	for _, entry := range b.entries {
+		if entry.events && options.disableEvents {
+			continue
+		}
+		env.Define(entry.name, entry.value)
+	}
+}
+
+// OptionSharedBuiltins defines builtins created by NewSharedBuiltins instead of creating new ones,
+// which saves creating every module for each evaluator
+type OptionSharedBuiltins struct {
+	Builtins *SharedBuiltins
+}
+
+func (o OptionSharedBuiltins) Apply(opts *Options) {
+	opts.builtins = o.Builtins
+}
@@ -0,0 +1,142 @@
+package eval
+
+import (
+	"context"
+	"refl/ast"
+	"refl/parser"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"sync"
+	"sync/atomic"
+)
+
+// Frame is a function call on the call stack of a debugged evaluator
+type Frame struct {
+	// Name is the callee as written at the call site, "main" for the top level code and event handlers
+	Name string
+	// Pos is the position of the statement the frame is at
+	Pos ast.Position
+	// Env is the innermost environment of the statement
+	Env *runtime.Environment
+}
+
+// DebugHook is called before each statement is evaluated. The statement waits for the hook to return,
+// so a debugger pauses the evaluation by blocking in it. An error stops the evaluation.
+// Event handlers wait for the hook as well, while coroutines have call stacks of their own
+// and may call the hook concurrently.
+type DebugHook func(ctx context.Context, stop *DebugStop) error
+
+// DebugStop describes the statement about to be evaluated
+type DebugStop struct {
+	Pos ast.Position
+	// Frames is the call stack, innermost frame first
+	Frames []Frame
+
+	evaluator *Evaluator
+}
+
+// debugState is the call stack of an evaluator running with a debug hook
+type debugState struct {
+	hook   DebugHook
+	frames []Frame
+	// evaluating is set while DebugStop.Eval runs, its statements are not reported to the hook
+	evaluating atomic.Bool
+	mu         sync.Mutex
+}
+
+// OptionDebugHook sets a hook called before each statement, see DebugHook
+type OptionDebugHook struct {
+	Hook DebugHook
+}
+
+func (o OptionDebugHook) Apply(opts *Options) {
+	opts.debugHook = o.Hook
+}
+
+// debugStatement updates the innermost frame and calls the hook, it's called from evalGeneric
+func (e *Evaluator) debugStatement(stmt ast.Statement, env *runtime.Environment) error {
+	d := e.debug
+	if d.evaluating.Load() {
+		return nil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.frames) == 0 {
+		d.frames = append(d.frames, Frame{Name: "main"})
+	}
+
+	top := &d.frames[len(d.frames)-1]
+	top.Pos = stmt.Position()
+	top.Env = env
+
+	stop := &DebugStop{Pos: top.Pos, Frames: make([]Frame, len(d.frames)), evaluator: e}
+	for i, frame := range d.frames {
+		stop.Frames[len(d.frames)-1-i] = frame
+	}
+
+	return d.hook(e.ctx, stop)
+}
+
+// enterFrame pushes a call of a script function onto the call stack and returns a function popping it
+func (e *Evaluator) enterFrame(name string, callable runtime.Callable) func() {
+	d := e.debug
+	if _, ok := callable.(*objects.Function); !ok || d.evaluating.Load() {
+		return func() {}
+	}
+
+	d.mu.Lock()
+	d.frames = append(d.frames, Frame{Name: name})
+	depth := len(d.frames)
+	d.mu.Unlock()
+
+	return func() {
+		d.mu.Lock()
+		d.frames = d.frames[:depth-1]
+		d.mu.Unlock()
+	}
+}
+
+// Eval evaluates code in the environment of the frame with the given index, while the evaluation is paused in the hook.
+// Statements of the code are not reported to the hook, variables it defines are local to the frame's scope.
+func (s *DebugStop) Eval(frame int, code string) (runtime.Object, error) {
+	if frame < 0 || frame >= len(s.Frames) {
+		return nil, runtime.NewPanic("invalid frame", 0, 0)
+	}
+
+	program, err := parser.New().Parse(code)
+	if err != nil {
+		return nil, err
+	}
+
+	e := s.evaluator
+	e.debug.evaluating.Store(true)
+	defer e.debug.evaluating.Store(false)
+
+	env := runtime.NewEnvironment(s.Frames[frame].Env)
+
+	result, err := e.evalProgram(program, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if ret, isReturn := result.(*objects.ReturnSignal); isReturn {
+		result = ret.Value
+	}
+
+	return result, nil
+}
+
+// Globals returns the global variables, leaving out the builtins and the ones defined by the host
+func (s *DebugStop) Globals() map[string]runtime.Object {
+	result := make(map[string]runtime.Object)
+	for name, value := range s.evaluator.env.GlobalsIterator() {
+		if builtin, ok := s.evaluator.builtins[value]; ok && builtin == name {
+			continue
+		}
+		result[name] = value
+	}
+
+	return result
+}
@@ -2,10 +2,14 @@ package eval
 
 import (
 	"context"
+	"io"
+	"os"
 	"refl/ast"
 	"refl/runtime"
+	"refl/runtime/clock"
 	"refl/runtime/eventloop"
 	"refl/runtime/objects"
+	"sync/atomic"
 )
 
 func New(ctx context.Context, program *ast.Program, env *runtime.Environment, opts ...Option) *Evaluator {
@@ -15,48 +19,86 @@ func New(ctx context.Context, program *ast.Program, env *runtime.Environment, op
 		opt.Apply(&options)
 	}
 
+	if options.clock == nil {
+		options.clock = clock.Real()
+	}
+
+	if options.stdout == nil {
+		options.stdout = os.Stdout
+	}
+
+	if options.liveCoroutines == nil {
+		options.liveCoroutines = new(atomic.Int64)
+	}
+
+	if options.rejections == nil {
+		options.rejections = &rejectionHooks{host: options.onUnhandled}
+	}
+
+	if options.maxCoroutines > 0 && options.coroutines == nil {
+		options.coroutines = newCoroutinePool(options.maxCoroutines)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
 	ctx = context.WithValue(ctx, "options", options)
 
 	evaluator := &Evaluator{
-		program: program,
-		env:     env,
+		program:        program,
+		env:            env,
+		cancel:         cancel,
+		liveCoroutines: options.liveCoroutines,
+		rejections:     options.rejections,
+	}
+
+	if options.debugHook != nil {
+		evaluator.debug = &debugState{hook: options.debugHook}
+	}
+
+	if options.profiler != nil {
+		evaluator.profile = &profileState{profiler: options.profiler}
 	}
 
 	ctx = context.WithValue(ctx, "evaluator", evaluator)
 
-	env.Define("math", createMathObject())
-	env.Define("strings", createStringObject())
-	env.Define("errors", createErrorsObject())
-	env.Define("io", createIoObject())
-	env.Define("time", createTimeObject())
-	if !options.disableEvents {
-		env.Define("events", createEventsObject())
+	builtins := options.builtins
+	if builtins == nil {
+		builtins = newBuiltins()
 	}
+	builtins.define(env, options)
 
-	defEnvBuiltinFunc("type", env, builtinTypeFunc)
-	defEnvBuiltinFunc("str", env, builtinStrFunc)
-	defEnvBuiltinFunc("number", env, builtinNumberFunc)
-	defEnvBuiltinFunc("len", env, builtinLenFunc)
-	defEnvBuiltinFunc("range", env, builtinRangeFunc)
-	defEnvBuiltinFunc("clone", env, builtinCloneFunc)
 	if !options.disableRefl {
-		defEnvBuiltinFunc("refl", env, builtinReflFunc)
+		env.Define("refl", newReflObject())
 	}
 
 	if !options.disableEvents {
-		eventLoop := eventloop.New(ctx)
+		eventLoop := eventloop.NewWithClock(ctx, options.clock)
 		evaluator.eventLoop = eventLoop
 		ctx = context.WithValue(ctx, "event_loop", eventLoop)
-		defEnvBuiltinFunc("eval", env, builtinEvalFunc)
 	}
 
 	env.Define("$", &globalRefObject{env: env})
 
 	evaluator.ctx = ctx
 
+	// globals defined by now are builtins or come from the host, snapshots refer to them by name
+	evaluator.builtins = make(map[runtime.Object]string)
+	for name, value := range env.GlobalsIterator() {
+		evaluator.builtins[value] = name
+	}
+
 	return evaluator
 }
 
+// clockFromContext returns the clock of the evaluator running the builtin
+func clockFromContext(ctx context.Context) clock.Clock {
+	return ctx.Value("options").(Options).clock
+}
+
+// stdoutFromContext returns the writer the io module of the evaluator prints to
+func stdoutFromContext(ctx context.Context) io.Writer {
+	return ctx.Value("options").(Options).stdout
+}
+
 func defLiteralBuiltinFunc(
 	name string,
 	obj *objects.ReflObject,
@@ -64,11 +106,3 @@ func defLiteralBuiltinFunc(
 ) {
 	obj.SetLiteral(name, objects.NewWrapperFunction(fn))
 }
-
-func defEnvBuiltinFunc(
-	name string,
-	env *runtime.Environment,
-	fn func(_ context.Context, args []runtime.Object) (runtime.Object, error),
-) {
-	env.Define(name, objects.NewWrapperFunction(fn))
-}
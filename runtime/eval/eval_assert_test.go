@@ -0,0 +1,62 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalAssert verifies the assertions of the assert module and their failure messages
+func TestEvalAssert(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		errorSubstr string
+	}{
+		{"equal numbers", `assert.equal(1 + 1, 2) result = "ok"`, "ok", ""},
+		{"equal strings", `assert.equal("a" + "b", "ab") result = "ok"`, "ok", ""},
+		{"not equal", `assert.equal(1, 2)`, "", "assert.equal failed: expected 2, got 1"},
+		{"not equal strings", `assert.equal("a", "b")`, "", `assert.equal failed: expected "b", got "a"`},
+		{"equal with message", `assert.equal(1, 2, "sum")`, "", "assert.equal failed: sum: expected 2, got 1"},
+		{"equal objects by reference", `var a = {1} assert.equal(a, {1})`, "", "assert.equal failed: expected {0: 1}, got {0: 1}"},
+
+		{"deep equal", `assert.deep_equal({x: {1, 2}, y: "a"}, {y: "a", x: {1, 2}}) result = "ok"`, "ok", ""},
+		{"deep equal mismatch", `assert.deep_equal({x: {1, 2}}, {x: {1, 3}})`, "", "expected {\"x\": {0: 1, 1: 3}}, got {\"x\": {0: 1, 1: 2}}"},
+		{"deep equal extra key", `assert.deep_equal({x: 1, y: 2}, {x: 1})`, "", "assert.deep_equal failed"},
+		{"deep equal cycle", `var a = {} a.self = a var b = {} b.self = b assert.deep_equal(a, b) result = "ok"`, "ok", ""},
+
+		{"throws", `var err = assert.throws(fun() { errors.panic("boom") }) result = str(err)`, "boom", ""},
+		{"throws substring", `assert.throws(fun() { 1 / 0 }, "division by zero") result = "ok"`, "ok", ""},
+		{"throws wrong error", `assert.throws(fun() { 1 / 0 }, "overflow")`, "", `expected an error containing "overflow", got "division by zero"`},
+		{"does not throw", `assert.throws(fun() { return 1 }, nil, "no error")`, "", "assert.throws failed: no error: function did not throw"},
+		{"throws non-function", `assert.throws(1)`, "", "first argument must be a function"},
+
+		{"is_err", `var err = assert.is_err(errors.new("bad")) result = str(err)`, "bad", ""},
+		{"is_err with value", `assert.is_err(5)`, "", "assert.is_err failed: expected an error, got 5"},
+
+		{"approx", `assert.approx(0.1 + 0.2, 0.3) result = "ok"`, "ok", ""},
+		{"approx with epsilon", `assert.approx(3.14, 3.1416, 0.01) result = "ok"`, "ok", ""},
+		{"approx mismatch", `assert.approx(3.14, 3.1416)`, "", "assert.approx failed: expected 3.1416 ± 1e-09, got 3.14"},
+		{"approx non-number", `assert.approx("a", 1)`, "", "arguments must be numbers"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			env := runtime.NewEnvironment(nil)
+			_, err := New(context.Background(), parseProgram(t, tt.input), env).Run()
+
+			if tt.errorSubstr != "" {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), tt.errorSubstr)
+				return
+			}
+
+			require.NoError(t, err)
+			result, _ := env.Get("result")
+			require.Equal(t, tt.expected, result.String())
+		})
+	}
+}
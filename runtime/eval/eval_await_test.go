@@ -0,0 +1,133 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalAwait verifies that await and the promise combinators work correctly
+func TestEvalAwait(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"await coroutine result", `
+			refl(fun() {
+				var a = await refl(fun() { return 2 })
+				var b = await refl(fun(x) { return x * 10 }, a)
+				return a + b
+			}).then(fun(v) { result = v })
+		`, float64(22)},
+
+		{"await non-promise value", `
+			refl(fun() {
+				return await 5
+			}).then(fun(v) { result = v })
+		`, float64(5)},
+
+		{"await rejection is caught", `
+			refl(fun() {
+				await refl(fun() { errors.panic("boom") })
+				return "unreachable"
+			}).then(fun(v) {
+				result = v
+			}).catch(fun(e) {
+				result = "caught: " + e
+			})
+		`, "caught: boom"},
+
+		{"promise.all", `
+			refl(fun() {
+				var values = await promise.all({
+					refl(fun() { time.sleep(20) return 1 }),
+					refl(fun() { return 2 }),
+					3
+				})
+				return values[0] + values[1] + values[2]
+			}).then(fun(v) { result = v })
+		`, float64(6)},
+
+		{"promise.all rejects", `
+			promise.all({
+				refl(fun() { return 1 }),
+				refl(fun() { errors.panic("failed") })
+			}).catch(fun(e) { result = str(e) })
+		`, "failed"},
+
+		{"promise.race", `
+			promise.race({
+				refl(fun() { time.sleep(500) return "slow" }),
+				refl(fun() { return "fast" })
+			}).then(fun(v) { result = v })
+		`, "fast"},
+
+		{"promise.any", `
+			promise.any({
+				refl(fun() { errors.panic("nope") }),
+				refl(fun() { time.sleep(20) return "ok" })
+			}).then(fun(v) { result = v })
+		`, "ok"},
+
+		{"promise.any all rejected", `
+			promise.any({
+				refl(fun() { errors.panic("a") })
+			}).catch(fun(e) { result = str(e) })
+		`, "all promises were rejected: a"},
+
+		{"promise.all_settled", `
+			promise.all_settled({
+				refl(fun() { return 1 }),
+				refl(fun() { errors.panic("bad") })
+			}).then(fun(v) {
+				result = v[0].status + ":" + v[0].value + "," + v[1].status + ":" + v[1].reason
+			})
+		`, "fulfilled:1,rejected:bad"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+
+			switch expected := tt.expected.(type) {
+			case string:
+				assert.IsType(t, &objects.String{}, result)
+				assert.Equal(t, expected, result.String())
+			case float64:
+				assert.IsType(t, &objects.Number{}, result)
+				assert.Equal(t, expected, result.(*objects.Number).Value)
+			}
+		})
+	}
+}
+
+// TestEvalAwaitOutsideCoroutine verifies that await can't block the main program
+func TestEvalAwaitOutsideCoroutine(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	program := parseProgram(t, `await refl(fun() { return 1 })`)
+
+	evaluator := New(ctx, program, runtime.NewEnvironment(nil))
+	_, err := evaluator.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "await is only allowed inside refl() coroutines")
+}
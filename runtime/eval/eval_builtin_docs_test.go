@@ -0,0 +1,20 @@
+package eval
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalBuiltinDocs verifies that every builtin global and module member is documented
+func TestEvalBuiltinDocs(t *testing.T) {
+	for name, members := range Builtins() {
+		_, ok := BuiltinDoc(name)
+		require.True(t, ok, "%s has no doc", name)
+
+		for _, member := range members {
+			_, ok := BuiltinDoc(name + "." + member)
+			require.True(t, ok, "%s.%s has no doc", name, member)
+		}
+	}
+}
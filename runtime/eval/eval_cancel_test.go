@@ -0,0 +1,110 @@
+package eval
+
+import (
+	"context"
+	"errors"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const slowFib = `
+	var fib = fun(n) {
+		if n < 2 {
+			return n
+		}
+		return fib(n - 1) + fib(n - 2)
+	}
+`
+
+// TestEvalCancelRecursion verifies that deep recursion stops once the context is cancelled
+func TestEvalCancelRecursion(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	program := parseProgram(t, slowFib+`fib(40)`)
+	evaluator := New(ctx, program, runtime.NewEnvironment(nil))
+
+	start := time.Now()
+	_, err := evaluator.Run()
+	require.Error(t, err)
+
+	var cancelled *runtime.Cancelled
+	assert.True(t, errors.As(err, &cancelled))
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+}
+
+// TestEvalCancelCoroutine verifies that promise.cancel() stops a busy coroutine and
+// that scripts can tell cancellations from other errors
+func TestEvalCancelCoroutine(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected float64
+	}{
+		{"cancelled recursion", slowFib + `
+			var p = refl(fun() { return fib(40) })
+			events.timeout(fun() { p.cancel() }, 20)
+			p.catch(fun(e) { result = errors.is_cancelled(e) })
+		`, 1},
+
+		{"cancelled method calls", `
+			var p = refl(fun() {
+				var obj = {}
+				obj.loop = fun() { return obj.loop() + 1 }
+				return obj.loop()
+			})
+			events.timeout(fun() { p.cancel() }, 20)
+			p.catch(fun(e) { result = errors.is_cancelled(e) })
+		`, 1},
+
+		{"other errors are not cancellations", `
+			refl(fun() { errors.panic("boom") }).catch(fun(e) { result = errors.is_cancelled(e) })
+		`, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+			assert.Equal(t, tt.expected, result.(*objects.Number).Value)
+		})
+	}
+}
+
+// TestEvalCancelBuiltins verifies that long-running builtins stop on a cancelled context
+func TestEvalCancelBuiltins(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := builtinStringReplaceFunc(ctx, []runtime.Object{
+		objects.NewString("aaaa"), objects.NewString("a"), objects.NewString("b"),
+	})
+	assert.True(t, runtime.IsCancelled(err))
+
+	arr := objects.NewObject()
+	_ = arr.Set(objects.NewNumber(0), objects.NewString("a"))
+	_, err = builtinStringJoinFunc(ctx, []runtime.Object{objects.NewString(","), arr})
+	assert.True(t, runtime.IsCancelled(err))
+
+	result, err := builtinStringReplaceFunc(context.Background(), []runtime.Object{
+		objects.NewString("a-b-c"), objects.NewString("-"), objects.NewString("+"), objects.NewNumber(1),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "a+b-c", result.String())
+}
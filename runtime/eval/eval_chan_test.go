@@ -0,0 +1,159 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalChannels verifies that channels pass values between coroutines
+func TestEvalChannels(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"unbuffered producer and consumer", `
+			var ch = chan.new()
+			refl(fun(c) {
+				for i, v in {1, 2, 3} { c.send(v) }
+				c.close()
+			}, ch)
+			result = 0
+			for i, v in ch { result = result + v }
+		`, float64(6)},
+
+		{"buffered send does not block", `
+			var ch = chan.new(2)
+			ch.send(1)
+			ch.send(2)
+			result = len(ch)
+		`, float64(2)},
+
+		{"recv", `
+			var ch = chan.new()
+			refl(fun(c) { c.send("hello") }, ch)
+			result = ch.recv()
+		`, "hello"},
+
+		{"sent values are cloned", `
+			var ch = chan.new(1)
+			var obj = {a: 1}
+			ch.send(obj)
+			obj.a = 2
+			result = ch.recv().a
+		`, float64(1)},
+
+		{"try_recv on empty channel", `
+			var ch = chan.new(1)
+			result = ch.try_recv().ok
+		`, float64(0)},
+
+		{"try_recv with value", `
+			var ch = chan.new(1)
+			ch.send(7)
+			result = ch.try_recv().value
+		`, float64(7)},
+
+		{"recv on closed channel drains then returns nil", `
+			var ch = chan.new(1)
+			ch.send("last")
+			ch.close()
+			result = ch.recv() + ":" + type(ch.recv())
+		`, "last:nil"},
+
+		{"send on closed channel", `
+			var ch = chan.new(1)
+			ch.close()
+			refl(fun(c) { c.send(1) }, ch).catch(fun(e) { result = str(e) })
+		`, "send on closed channel"},
+
+		{"close of closed channel", `
+			var ch = chan.new()
+			ch.close()
+			refl(fun(c) { c.close() }, ch).catch(fun(e) { result = str(e) })
+		`, "close of closed channel"},
+
+		{"select picks ready channel", `
+			var a = chan.new(1)
+			var b = chan.new(1)
+			b.send("b")
+			var res = chan.select({a, b})
+			result = str(res.index) + ":" + res.value
+		`, "1:b"},
+
+		{"select waits for coroutine", `
+			var a = chan.new()
+			var b = chan.new()
+			refl(fun(c) { time.sleep(20) c.send("late") }, a)
+			var res = chan.select({a, b})
+			result = str(res.index) + ":" + res.value
+		`, "0:late"},
+
+		{"select timeout", `
+			var a = chan.new()
+			result = chan.select({a}, 20).index
+		`, float64(-1)},
+
+		{"select non-blocking", `
+			var a = chan.new()
+			result = chan.select({a}, 0).index
+		`, float64(-1)},
+
+		{"select closed channel", `
+			var a = chan.new()
+			a.close()
+			var res = chan.select({a})
+			result = str(res.index) + ":" + str(res.ok)
+		`, "0:0"},
+
+		{"cancel blocked recv", `
+			var ch = chan.new()
+			var p = refl(fun(c) { c.recv() return "received" }, ch)
+			p.catch(fun(e) { result = str(e) })
+			p.cancel()
+		`, "context cancelled"},
+
+		{"cancel blocked for loop", `
+			var ch = chan.new()
+			var p = refl(fun(c) {
+				for i, v in c {}
+				return "finished"
+			}, ch)
+			p.catch(fun(e) { result = str(e) })
+			p.cancel()
+		`, "context cancelled"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+
+			switch expected := tt.expected.(type) {
+			case string:
+				assert.IsType(t, &objects.String{}, result)
+				assert.Equal(t, expected, result.String())
+			case float64:
+				assert.IsType(t, &objects.Number{}, result)
+				assert.Equal(t, expected, result.(*objects.Number).Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"refl/runtime/clock"
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalFakeClock verifies that timers and the time module follow a fake clock
+func TestEvalFakeClock(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		advances []time.Duration
+		expected float64
+	}{
+		{"time.now", `result = time.now()`, nil, 1000},
+		{"timeout", `events.timeout(fun() { result = time.now() }, 5000)`, []time.Duration{5 * time.Second}, 6000},
+		{"schedule", `events.schedule(fun() { result = time.now() }, 61000)`, []time.Duration{time.Minute}, 61000},
+		{"sleep", `time.sleep(60000) result = time.now()`, []time.Duration{time.Minute}, 61000},
+		{"interval", `
+			var count = 0
+			var stop = nil
+			stop = events.interval(fun() {
+				count = count + 1
+				if count == 3 {
+					stop()
+					result = time.now()
+				}
+			}, 1000)
+		`, []time.Duration{time.Second, time.Second, time.Second}, 4000},
+		{"timeout not fired before deadline", `
+			result = 0
+			var cancel = events.timeout(fun() { result = 1 }, 5000)
+			events.timeout(fun() { cancel() }, 4999)
+		`, []time.Duration{4999 * time.Millisecond}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			fake := clock.NewFake(time.UnixMilli(1000))
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env, OptionClock{Clock: fake})
+
+			errChan := make(chan error, 1)
+			go func() {
+				_, err := evaluator.Run()
+				errChan <- err
+			}()
+
+			for _, advance := range tt.advances {
+				fake.BlockUntil(1)
+				fake.Advance(advance)
+			}
+
+			require.NoError(t, <-errChan)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+			assert.IsType(t, &objects.Number{}, result)
+			assert.Equal(t, tt.expected, result.(*objects.Number).Value)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"refl/runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalDebugHook verifies that the debug hook sees every statement with its call stack
+func TestEvalDebugHook(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []string
+	}{
+		{"statements", "var a = 1\nvar b = 2\nresult = a + b", []string{"1:main", "2:main", "3:main"}},
+		{"function call", "var f = fun(x) {\n  return x * 2\n}\nresult = f(2)", []string{
+			"1:main", "4:main", "2:f<main",
+		}},
+		{"method call", "var obj = {double: fun(self, x) {\n  return x * 2\n}}\nresult = obj:double(3)", []string{
+			"1:main", "4:main", "2:obj:double<main",
+		}},
+		{"loop", "var sum = 0\nvar arr = {5, 7}\nfor i, v in arr {\n  sum = sum + v\n}\nresult = sum", []string{
+			"1:main", "2:main", "3:main", "4:main", "4:main", "6:main",
+		}},
+		{"builtins have no frames", "result = len(\"abc\")", []string{"1:main"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var stops []string
+			hook := func(ctx context.Context, stop *DebugStop) error {
+				var names []string
+				for _, frame := range stop.Frames {
+					names = append(names, frame.Name)
+				}
+				stops = append(stops, fmt.Sprintf("%d:%s", stop.Pos.Line, strings.Join(names, "<")))
+				return nil
+			}
+
+			env := runtime.NewEnvironment(nil)
+			_, err := New(context.Background(), parseProgram(t, tt.input), env, OptionDisableEvents{}, OptionDebugHook{Hook: hook}).Run()
+			require.NoError(t, err)
+			require.Equal(t, tt.expected, stops)
+		})
+	}
+}
+
+// TestEvalDebugStop verifies evaluating code and listing globals while paused, and stopping from the hook
+func TestEvalDebugStop(t *testing.T) {
+	input := "var total = 10\nvar f = fun(x) {\n  var y = x + 1\n  return y\n}\nresult = f(total)\nio.println(result)"
+
+	stopErr := errors.New("stopped by debugger")
+	var evaluated, global []string
+
+	hook := func(ctx context.Context, stop *DebugStop) error {
+		switch stop.Pos.Line {
+		case 4:
+			for i, code := range []string{"y * 2", "total", "y = 100"} {
+				value, err := stop.Eval(i%len(stop.Frames), code)
+				require.NoError(t, err)
+				evaluated = append(evaluated, value.String())
+			}
+			_, err := stop.Eval(len(stop.Frames), "1")
+			require.Error(t, err)
+		case 7:
+			for name := range stop.Globals() {
+				global = append(global, name)
+			}
+			return stopErr
+		}
+		return nil
+	}
+
+	var out bytes.Buffer
+	env := runtime.NewEnvironment(nil)
+	evaluator := New(context.Background(), parseProgram(t, input), env, OptionDebugHook{Hook: hook}, OptionStdout{Writer: &out})
+
+	_, err := evaluator.Run()
+	require.ErrorIs(t, err, stopErr)
+	require.Equal(t, []string{"22", "10", "100"}, evaluated)
+	require.ElementsMatch(t, []string{"total", "f", "result"}, global)
+
+	result, _ := env.Get("result")
+	require.Equal(t, "100", result.String())
+	require.Empty(t, out.String())
+}
+
+// TestEvalStdout verifies that the io module prints to the configured writer
+func TestEvalStdout(t *testing.T) {
+	var out bytes.Buffer
+	input := `io.print("a", 1) io.println(" b") io.printf("$-$", 1, 2)`
+
+	_, err := New(context.Background(), parseProgram(t, input), runtime.NewEnvironment(nil), OptionStdout{Writer: &out}).Run()
+	require.NoError(t, err)
+	require.Equal(t, "a 1 b\n1-2", out.String())
+}
@@ -0,0 +1,73 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalDestructuring(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		errorSubstr string
+	}{
+		{"multiple return values", `var f = fun() { return 1, "err" }
+var a, b = f()
+result = str(a) + b`, "1err", ""},
+		{"declaration from values", `var a, b = 2, 3 result = a * b`, "6", ""},
+		{"declaration by name", `var point = {x: 1, y: 2}
+var {y, x} = point
+result = str(x) + str(y)`, "12", ""},
+		{"braces on arrays take positions", `var arr = {"a", "b", "c"}
+var {first, second} = arr
+result = first + second`, "ab", ""},
+		{"missing values are nil", `var a, b, c = {1} var {z} = {x: 1} result = str(b) + str(c) + str(z)`, "nilnilnil", ""},
+		{"declarations are local", `var a = 1
+if 1 { var a, b = 2, 3 }
+result = a`, "1", ""},
+		{"swap", `a = 1 b = 2 a, b = b, a result = str(a) + str(b)`, "21", ""},
+		{"assign members", `var obj = {} var arr = {}
+obj.x, arr[1] = "x", "y"
+result = obj.x + arr[1]`, "xy", ""},
+		{"assign by name", `var x = 0 var y = 0
+{x, y} = {y: 2, x: 1}
+result = str(x) + str(y)`, "12", ""},
+		{"assignment updates outer variables", `var a = 0 var b = 0
+var f = fun() { a, b = 1, 2 }
+f()
+result = a + b`, "3", ""},
+		{"for loop", `var points = {{x: 1, y: 2}, {x: 3, y: 4}}
+result = ""
+for i, {x, y} in points { result = result + str(i) + str(x * y) }`, "02112", ""},
+		{"for loop over arrays", `result = 0
+for _, {a, b} in {{1, 2}, {3, 4}} { result = result + a * b }`, "14", ""},
+		{"tuple values are arrays", `var f = fun() { return 1, 2, 3 } result = len(f())`, "3", ""},
+		{"strings", `var a, b = "hi" result = b + a`, "ih", ""},
+
+		{"not indexable", `var a, b = 1`, "", "cannot destructure number"},
+		{"invalid target", `a, f() = 1, 2`, "", "invalid assignment target"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			env := runtime.NewEnvironment(nil)
+			_, err := New(ctx, parseProgram(t, tt.input), env).Run()
+			if tt.errorSubstr != "" {
+				require.ErrorContains(t, err, tt.errorSubstr)
+				return
+			}
+			require.NoError(t, err)
+
+			result, _ := env.Get("result")
+			require.Equal(t, tt.expected, result.String())
+		})
+	}
+}
@@ -63,12 +63,12 @@ func TestEvalErrors(t *testing.T) {
 		{"assign to number property", "5.x = 10", "cannot assign to member of non-indexable object"},
 
 		// Chained invalid access
-		{"chained invalid property", `var x = {}\nx.y = 5\nx.y.z`, "cannot assign to member of non-indexable object"},
+		{"chained invalid property", "var x = {}\nx.y = 5\nx.y.z", "cannot access member of non-indexable object"},
 		{"property on result of invalid", "nil.x.y", "cannot access member of non-indexable object"},
 
 		// Invalid object operations
-		{"call object property that is not function", `var obj = {x: 5}\nobj:x()`, "cannot access method of non-indexable object"},
-		{"method not found", `var obj = {}\nobj:nonExistent()`, "cannot access method of non-indexable object"},
+		{"call object property that is not function", "var obj = {x: 5}\nobj:x()", "attempt to call non-function method"},
+		{"method not found", "var obj = {}\nobj:nonExistent()", "attempt to call non-function method"},
 	}
 
 	for _, tt := range tests {
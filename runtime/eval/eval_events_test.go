@@ -0,0 +1,151 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalEvents verifies wildcard subscriptions, once handlers, emit and priorities
+func TestEvalEvents(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"emit calls handlers with arguments", `
+			var remove = nil
+			remove = events.register("greet", fun(evt, name) {
+				result = evt + " " + name
+				remove()
+			})
+			events.emit("greet", "bob")
+		`, "greet bob"},
+
+		{"wildcard matches one segment", `
+			result = ""
+			var removeAll = events.register("order.*", fun(evt) { result = result + evt + ";" })
+			var removeDone = nil
+			removeDone = events.register("done", fun(evt) {
+				removeAll()
+				removeDone()
+			})
+			events.emit("order.created")
+			events.emit("order.created.eu")
+			events.emit("user.created")
+			events.emit("order.paid")
+			events.emit("done")
+		`, "order.created;order.paid;"},
+
+		{"double wildcard matches the namespace", `
+			result = ""
+			var removeAll = events.register("order.**", fun(evt) { result = result + evt + ";" })
+			events.once("done", fun(evt) { removeAll() })
+			events.emit("order")
+			events.emit("order.created.eu")
+			events.emit("done")
+		`, "order.created.eu;"},
+
+		{"once handler is called once", `
+			var calls = 0
+			events.once("ping", fun(evt) { calls = calls + 1 })
+			events.emit("ping")
+			events.emit("ping")
+			events.once("done", fun(evt) { result = calls })
+			events.emit("done")
+		`, float64(1)},
+
+		{"cancelled once handler", `
+			result = "not called"
+			var cancel = events.once("ping", fun(evt) { result = "called" })
+			cancel()
+			events.emit("ping")
+		`, "not called"},
+
+		{"handlers are ordered by priority", `
+			result = ""
+			events.once("save", fun(evt) { result = result + "default;" })
+			events.once("save", fun(evt) { result = result + "low;" }, -5)
+			events.once("save.*", fun(evt) { result = result + "wildcard;" })
+			events.once("save", fun(evt) { result = result + "high;" }, 10)
+			events.emit("save")
+			events.emit("save.x")
+		`, "high;default;low;wildcard;"},
+
+		{"emit copies arguments", `
+			var obj = {a: 1}
+			events.once("change", fun(evt, o) { o.a = 2 })
+			events.emit("change", obj)
+			events.once("done", fun(evt) { result = obj.a })
+			events.emit("done")
+		`, float64(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+
+			switch expected := tt.expected.(type) {
+			case string:
+				assert.IsType(t, &objects.String{}, result)
+				assert.Equal(t, expected, result.String())
+			case float64:
+				assert.IsType(t, &objects.Number{}, result)
+				assert.Equal(t, expected, result.(*objects.Number).Value)
+			}
+		})
+	}
+}
+
+// TestEvaluatorFireEventSync verifies that the host receives the return values of all handlers
+func TestEvaluatorFireEventSync(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	evaluator, errChan := serveProgram(t, ctx, `
+		events.register("order.*", fun(evt, id) { return "wildcard " + id })
+		events.register("order.created", fun(evt, id) { return "exact " + id }, 1)
+		events.register("order.failed", fun(evt) { errors.panic("failed") })
+	`)
+
+	result, err := evaluator.FireEventSync("order.created", []runtime.Object{objects.NewString("42")}).Await(ctx)
+	require.NoError(t, err)
+
+	results := result.(*objects.ReflObject)
+	first, _ := results.Get(objects.NewNumber(0))
+	second, _ := results.Get(objects.NewNumber(1))
+	assert.Equal(t, 2, results.Length())
+	assert.Equal(t, "exact 42", first.String())
+	assert.Equal(t, "wildcard 42", second.String())
+
+	_, err = evaluator.FireEventSync("order.failed", nil).Await(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "failed")
+
+	result, err = evaluator.FireEventSync("user.created", nil).Await(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 0, result.(*objects.ReflObject).Length())
+
+	require.NoError(t, evaluator.Shutdown(ctx))
+	require.NoError(t, <-errChan)
+
+	_, err = evaluator.FireEventSync("order.created", nil).Await(ctx)
+	require.Error(t, err)
+}
@@ -0,0 +1,150 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"refl/runtime/objects"
+	goruntime "runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveProgram(t *testing.T, ctx context.Context, input string) (*Evaluator, chan error) {
+	t.Helper()
+
+	program := parseProgram(t, input)
+	evaluator := New(ctx, program, runtime.NewEnvironment(nil))
+
+	errChan := make(chan error, 1)
+	go func() {
+		_, err := evaluator.Serve()
+		errChan <- err
+	}()
+
+	return evaluator, errChan
+}
+
+// TestEvaluatorStats verifies that the host can inspect events, tasks and coroutines
+func TestEvaluatorStats(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	evaluator, errChan := serveProgram(t, ctx, `
+		events.register("click", fun(e) {})
+		events.register("click", fun(e) {})
+		events.register("key", fun(e) {})
+		events.timeout(fun() {}, 60000)
+		refl(fun() { time.sleep(200) })
+	`)
+
+	require.Eventually(t, func() bool {
+		return len(evaluator.Stats().Events) == 2
+	}, time.Second, 5*time.Millisecond)
+
+	stats := evaluator.Stats()
+	assert.Equal(t, map[string]int{"click": 2, "key": 1}, stats.Events)
+	assert.Equal(t, 1, stats.DelayedTasks)
+	assert.Equal(t, 1, stats.Coroutines)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, time.Second)
+	defer shutdownCancel()
+
+	require.NoError(t, evaluator.Shutdown(shutdownCtx))
+	require.NoError(t, <-errChan)
+
+	stats = evaluator.Stats()
+	assert.Empty(t, stats.Events)
+	assert.Equal(t, 0, stats.DelayedTasks)
+	assert.Equal(t, 0, stats.Coroutines)
+}
+
+// TestEvaluatorServe verifies that serve mode keeps the loop alive until shutdown
+func TestEvaluatorServe(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	evaluator, errChan := serveProgram(t, ctx, `var pings = 0`)
+
+	select {
+	case err := <-errChan:
+		t.Fatalf("serve returned before shutdown: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	require.NoError(t, evaluator.Shutdown(ctx))
+	require.NoError(t, <-errChan)
+}
+
+// TestEvaluatorShutdownDeadline verifies that shutdown cancels work that doesn't finish in time
+func TestEvaluatorShutdownDeadline(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	evaluator, errChan := serveProgram(t, ctx, `
+		events.interval(fun() {}, 10)
+		refl(fun() { time.sleep(10000) })
+	`)
+
+	require.Eventually(t, func() bool {
+		return evaluator.Stats().Coroutines == 1
+	}, time.Second, 5*time.Millisecond)
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer shutdownCancel()
+
+	start := time.Now()
+	err := evaluator.Shutdown(shutdownCtx)
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), time.Second)
+
+	select {
+	case <-errChan:
+	case <-time.After(time.Second):
+		t.Fatal("serve did not return after shutdown")
+	}
+}
+
+// TestEvaluatorCall verifies that the host can call script functions repeatedly after Run
+func TestEvaluatorCall(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	env := runtime.NewEnvironment(nil)
+	evaluator := New(ctx, parseProgram(t, `var add = fun(a, b) { return a + b }`), env)
+	_, err := evaluator.Run()
+	require.NoError(t, err)
+
+	add, _ := env.Get("add")
+	before := goruntime.NumGoroutine()
+	for i := range 300 {
+		result, err := evaluator.Call(add, []runtime.Object{objects.NewNumber(float64(i)), objects.NewNumber(1)})
+		require.NoError(t, err)
+		require.Equal(t, objects.NewNumber(float64(i+1)), result)
+	}
+
+	// the loop is restarted by every call but watches the context only once
+	assert.Less(t, goruntime.NumGoroutine()-before, 10)
+}
+
+// TestEvaluatorNestedCleanup verifies that the evaluators of eval() don't outlive it
+func TestEvaluatorNestedCleanup(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	before := goruntime.NumGoroutine()
+
+	env := runtime.NewEnvironment(nil)
+	_, err := New(ctx, parseProgram(t, `result = 0
+		for _, i in range(0, 500) { result = result + eval("1 + 1") }`), env).Run()
+	require.NoError(t, err)
+
+	result, _ := env.Get("result")
+	assert.Equal(t, "1000", result.String())
+
+	require.Eventually(t, func() bool {
+		return goruntime.NumGoroutine()-before < 10
+	}, time.Second, 10*time.Millisecond)
+}
@@ -1,9 +1,32 @@
 package eval
 
+import (
+	"io"
+	"refl/runtime/clock"
+	"sync/atomic"
+)
+
 type Options struct {
 	disableEvents bool
 	disableEval   bool
 	disableRefl   bool
+
+	maxCoroutines int
+	coroutines    *coroutinePool
+
+	// liveCoroutines counts the running and queued coroutines of the whole evaluator tree
+	liveCoroutines *atomic.Int64
+
+	clock  clock.Clock
+	stdout io.Writer
+
+	onUnhandled func(err error)
+	rejections  *rejectionHooks
+
+	debugHook DebugHook
+	profiler  *Profiler
+
+	builtins *SharedBuiltins
 }
 
 type Option interface {
@@ -29,6 +52,46 @@ func (OptionDisableRefl) Apply(opts *Options) {
 	opts.disableRefl = true
 }
 
+// OptionMaxCoroutines limits the number of coroutines running at the same time.
+// Further refl() calls are queued until a running coroutine finishes,
+// so a coroutine awaiting nested coroutines needs a limit above the nesting depth.
+type OptionMaxCoroutines struct {
+	Limit int
+}
+
+func (o OptionMaxCoroutines) Apply(opts *Options) {
+	opts.maxCoroutines = o.Limit
+}
+
+// OptionClock sets the clock used by the event loop and the time module, e.g. clock.NewFake for tests
+type OptionClock struct {
+	Clock clock.Clock
+}
+
+func (o OptionClock) Apply(opts *Options) {
+	opts.clock = o.Clock
+}
+
+// OptionStdout sets the writer the io module prints to, os.Stdout by default
+type OptionStdout struct {
+	Writer io.Writer
+}
+
+func (o OptionStdout) Apply(opts *Options) {
+	opts.stdout = o.Writer
+}
+
+// OptionOnUnhandledRejection sets a callback receiving the promise rejections no handler was attached to,
+// instead of returning them from Run. Scripts' errors.on_unhandled() hooks take precedence.
+// The callback may be called from multiple goroutines.
+type OptionOnUnhandledRejection struct {
+	Handler func(err error)
+}
+
+func (o OptionOnUnhandledRejection) Apply(opts *Options) {
+	opts.onUnhandled = o.Handler
+}
+
 type OptionSetOptions struct {
 	opts Options
 }
@@ -0,0 +1,67 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalParameters(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		errorSubstr string
+	}{
+		{"defaults", `var f = fun(a, b = 10) { return a + b } result = str(f(1)) + " " + str(f(1, 2))`, "11 3", ""},
+		{"nil takes the default", `var f = fun(a = "x") { return a } result = f(nil)`, "x", ""},
+		{"defaults see earlier parameters", `var f = fun(a, b = a * 2) { return b } result = f(4)`, "8", ""},
+		{"defaults are evaluated at call time", `var n = 0
+var next = fun() { n = n + 1 return n }
+var f = fun(id = next()) { return id }
+f() f()
+result = f()`, "3", ""},
+		{"defaults see the closure", `var make = fun(x) { return fun(y = x) { return y } } result = make(5)()`, "5", ""},
+		{"rest", `var f = fun(a, ...rest) { return str(a) + str(len(rest)) + rest[1] } result = f(1, "b", "c")`, "12c", ""},
+		{"empty rest", `var f = fun(...rest) { return len(rest) } result = f()`, "0", ""},
+		{"args keeps every argument", `var f = fun(a, ...rest) { return len(args) } result = f(1, 2, 3)`, "3", ""},
+		{"spread", `var f = fun(a, b, c) { return a + b + c } var arr = {1, 2} result = f(...arr, 3)`, "6", ""},
+		{"spread into rest", `var f = fun(...xs) { return len(xs) } result = f(0, ...{1, 2}, ...{})`, "3", ""},
+		{"spread into builtins", `result = math.max(...{3, 9, 4})`, "9", ""},
+		{"keywords", `var f = fun(a, b = 2, c = 3) { return str(a) + str(b) + str(c) } result = f(1, c: 30)`, "1230", ""},
+		{"keywords in any order", `var f = fun(a, b) { return a - b } result = f(b: 1, a: 5)`, "4", ""},
+		{"keyword values", `var g = fun() { return 7 } var f = fun(x) { return x } result = f(x: (g())) + f(x: 1 + g())`, "15", ""},
+		{"method keywords", `var obj = {n: 1, add: fun(self, by = 1) { return self.n + by }} result = obj:add(by: 41)`, "42", ""},
+		{"method calls stay arguments", `var obj = {v: fun(self) { return "m" }} var f = fun(x) { return x } result = f(obj:v())`, "m", ""},
+
+		{"unknown keyword", `var f = fun(a) {} f(b: 1)`, "", "line 1, column 18: unknown keyword argument b"},
+		{"keyword given twice", `var f = fun(a) {} f(1, a: 2)`, "", "line 1, column 18: argument a given twice"},
+		{"method keyword given twice", `var o = {m: fun(self, a) {}}
+o:m(1, a: 2)`, "", "line 2, column 0: argument a given twice"},
+		{"repeated keyword", `var f = fun(a) {} f(a: 1, a: 2)`, "", "argument a given twice"},
+		{"keywords to builtins", `math.max(a: 1)`, "", "function does not take keyword arguments"},
+		{"spread objects", `var f = fun() {} f(...{a: 1})`, "", "cannot spread object"},
+		{"spread numbers", `var f = fun() {} f(...1)`, "", "cannot spread number"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			env := runtime.NewEnvironment(nil)
+			_, err := New(ctx, parseProgram(t, tt.input), env).Run()
+			if tt.errorSubstr != "" {
+				require.ErrorContains(t, err, tt.errorSubstr)
+				return
+			}
+			require.NoError(t, err)
+
+			result, _ := env.Get("result")
+			require.Equal(t, tt.expected, result.String())
+		})
+	}
+}
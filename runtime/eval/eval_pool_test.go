@@ -0,0 +1,159 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	goruntime "runtime"
+	"testing"
+	"time"
+
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const trackConcurrencyScript = `
+	var state = sync.shared({running: 0, max: 0})
+	var m = sync.mutex()
+	var track = fun(s, m) {
+		m.lock()
+		s.running = s.running + 1
+		if s.running > s.max { s.max = s.running }
+		m.unlock()
+		time.sleep(20)
+		m.lock()
+		s.running = s.running - 1
+		m.unlock()
+	}
+`
+
+// TestEvalPool verifies that coroutine pools bound the number of running coroutines
+func TestEvalPool(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		options  []Option
+		expected interface{}
+	}{
+		{"pool limits concurrency", trackConcurrencyScript + `
+			var pool = refl.pool(2)
+			var all = {}
+			for i, _ in range(0, 6) {
+				all[i] = pool.submit(track, state, m)
+			}
+			promise.all(all).then(fun() { result = state.max })
+		`, nil, float64(2)},
+
+		{"submit passes arguments", `
+			refl.pool(1).submit(fun(a, b) { return a + b }, 2, 3).then(fun(v) { result = v })
+		`, nil, float64(5)},
+
+		{"pool stats", `
+			var pool = refl.pool(1)
+			for i, _ in range(0, 3) {
+				pool.submit(fun() { time.sleep(200) })
+			}
+			time.sleep(50)
+			var stats = pool.stats()
+			result = str(stats.size) + "," + str(stats.active) + "," + str(stats.queued) + "," + str(stats.completed)
+		`, nil, "1,1,2,0"},
+
+		{"cancel queued coroutine", `
+			var pool = refl.pool(1)
+			pool.submit(fun() { time.sleep(100) })
+			var p = pool.submit(fun() { return "ran" })
+			p.catch(fun(e) { result = str(e) })
+			p.cancel()
+		`, nil, "context cancelled"},
+
+		{"max coroutines option", trackConcurrencyScript + `
+			var all = {}
+			for i, _ in range(0, 6) {
+				all[i] = refl(track, state, m)
+			}
+			promise.all(all).then(fun() { result = state.max })
+		`, []Option{OptionMaxCoroutines{Limit: 3}}, float64(3)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env, tt.options...)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+
+			switch expected := tt.expected.(type) {
+			case string:
+				assert.IsType(t, &objects.String{}, result)
+				assert.Equal(t, expected, result.String())
+			case float64:
+				assert.IsType(t, &objects.Number{}, result)
+				assert.Equal(t, expected, result.(*objects.Number).Value)
+			}
+		})
+	}
+}
+
+// TestEvalPoolInvalidSize verifies that pools must have a positive size
+func TestEvalPoolInvalidSize(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	program := parseProgram(t, `refl.pool(0)`)
+
+	evaluator := New(ctx, program, runtime.NewEnvironment(nil))
+	_, err := evaluator.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "pool() argument must be a positive number")
+}
+
+// TestEvalPoolQueuedCoroutines verifies that queued coroutines don't get a goroutine or an evaluator
+// before they get a slot
+func TestEvalPoolQueuedCoroutines(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		options []Option
+	}{
+		{"pool", `
+			var pool = refl.pool(2)
+			for i, _ in range(0, 500) { pool.submit(fun() { time.sleep(200) }) }
+		`, nil},
+		{"max coroutines option", `
+			for i, _ in range(0, 500) { refl(fun() { time.sleep(200) }) }
+		`, []Option{OptionMaxCoroutines{Limit: 2}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			before := goruntime.NumGoroutine()
+			evaluator := New(ctx, parseProgram(t, tt.input), runtime.NewEnvironment(nil), tt.options...)
+
+			done := make(chan error, 1)
+			go func() {
+				_, err := evaluator.Run()
+				done <- err
+			}()
+
+			time.Sleep(100 * time.Millisecond)
+			require.Equal(t, 500, evaluator.Stats().Coroutines)
+			require.Less(t, goruntime.NumGoroutine()-before, 50)
+
+			// the queued coroutines are cancelled without ever starting
+			cancel()
+			<-done
+		})
+	}
+}
@@ -0,0 +1,100 @@
+package eval
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"refl/runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalProfiler verifies the call counts per call stack and the line coverage recorded by the profiler
+func TestEvalProfiler(t *testing.T) {
+	input := `var fib = fun(n) {
+  if n < 2 {
+    return n
+  }
+  return fib(n - 1) + fib(n - 2)
+}
+var obj = {get: fun(self) {
+  return math.abs(-1)
+}}
+result = fib(5) + obj:get()
+if result > 100 {
+  result = 0
+}`
+
+	program := parseProgram(t, input)
+	profiler := NewProfiler("test.refl", program)
+
+	env := runtime.NewEnvironment(nil)
+	_, err := New(context.Background(), program, env, OptionProfiler{Profiler: profiler}).Run()
+	require.NoError(t, err)
+	profiler.Stop()
+
+	result, _ := env.Get("result")
+	require.Equal(t, "6", result.String())
+
+	calls := make(map[string]int64)
+	for _, sample := range profiler.Profile().Samples {
+		var names []string
+		for _, frame := range sample.Stack {
+			names = append(names, frame.Function.Name)
+		}
+		calls[strings.Join(names, "<")] += sample.Calls
+	}
+
+	require.Equal(t, map[string]int64{
+		"fib<main":                 1,
+		"fib<fib<main":             2,
+		"fib<fib<fib<main":         4,
+		"fib<fib<fib<fib<main":     6,
+		"fib<fib<fib<fib<fib<main": 2,
+		"obj:get<main":             1,
+		"math.abs<obj:get<main":    1,
+		"main":                     1,
+	}, calls)
+
+	for _, sample := range profiler.Profile().Samples {
+		if sample.Stack[0].Function.Name == "math.abs" {
+			require.Equal(t, "<builtin>", sample.Stack[0].Function.Filename)
+			require.Equal(t, 8, sample.Stack[1].Line, "call site line in the caller")
+			require.Equal(t, 10, sample.Stack[2].Line)
+		}
+		if sample.Stack[0].Function.Name == "fib" {
+			require.Equal(t, 1, sample.Stack[0].Function.StartLine)
+		}
+	}
+
+	var lcov bytes.Buffer
+	require.NoError(t, profiler.Coverage().WriteLCOV(&lcov))
+	require.Equal(t, `TN:
+SF:test.refl
+DA:1,1
+DA:2,15
+DA:3,8
+DA:5,7
+DA:7,1
+DA:8,1
+DA:10,1
+DA:11,1
+DA:12,0
+LF:9
+LH:8
+end_of_record
+`, lcov.String())
+
+	var pprof bytes.Buffer
+	require.NoError(t, profiler.Profile().WritePprof(&pprof))
+	gz, err := gzip.NewReader(&pprof)
+	require.NoError(t, err)
+	raw, err := io.ReadAll(gz)
+	require.NoError(t, err)
+	for _, name := range []string{"fib", "obj:get", "math.abs", "test.refl", "<builtin>", "nanoseconds"} {
+		require.True(t, bytes.Contains(raw, []byte(name)), name)
+	}
+}
@@ -0,0 +1,127 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalPromise verifies that promises can be constructed and chained from scripts
+func TestEvalPromise(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"promise.new resolved by schedule", `
+			promise.new(fun(resolve, reject) {
+				events.schedule(fun() { resolve("scheduled") }, time.now() + 20)
+			}).then(fun(v) { result = v })
+		`, "scheduled"},
+
+		{"promise.new rejected", `
+			promise.new(fun(resolve, reject) {
+				reject("nope")
+			}).catch(fun(e) { result = str(e) })
+		`, "nope"},
+
+		{"promise.new executor panic rejects", `
+			promise.new(fun(resolve, reject) {
+				errors.panic("executor failed")
+			}).catch(fun(e) { result = str(e) })
+		`, "executor failed"},
+
+		{"promise.new settles only once", `
+			promise.new(fun(resolve, reject) {
+				resolve(1)
+				resolve(2)
+				reject("late")
+			}).then(fun(v) { result = v })
+		`, float64(1)},
+
+		{"promise.resolve", `
+			promise.resolve(42).then(fun(v) { result = v })
+		`, float64(42)},
+
+		{"promise.reject", `
+			promise.reject("bad").catch(fun(e) { result = str(e) })
+		`, "bad"},
+
+		{"then chain passes return values", `
+			promise.resolve(1)
+				.then(fun(v) { return v + 1 })
+				.then(fun(v) { return v * 10 })
+				.then(fun(v) { result = v })
+		`, float64(20)},
+
+		{"then follows returned promise", `
+			promise.resolve(1)
+				.then(fun(v) { return refl(fun(x) { return x + 5 }, v) })
+				.then(fun(v) { result = v })
+		`, float64(6)},
+
+		{"then handler panic rejects chained promise", `
+			promise.resolve(1)
+				.then(fun(v) { errors.panic("handler failed") })
+				.then(fun(v) { result = "unreachable" })
+				.catch(fun(e) { result = str(e) })
+		`, "handler failed"},
+
+		{"then with rejection handler", `
+			promise.reject("oops").then(fun(v) {
+				result = "unreachable"
+			}, fun(e) {
+				result = "handled: " + e
+			})
+		`, "handled: oops"},
+
+		{"catch recovers", `
+			promise.reject("oops")
+				.catch(fun(e) { return "recovered" })
+				.then(fun(v) { result = v })
+		`, "recovered"},
+
+		{"finally passes outcome through", `
+			var calls = 0
+			promise.resolve("value")
+				.finally(fun() { calls = calls + 1 })
+				.then(fun(v) { result = v + calls })
+		`, "value1"},
+
+		{"promise.resolve follows promise", `
+			promise.resolve(refl(fun() { return "inner" })).then(fun(v) { result = v })
+		`, "inner"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+
+			switch expected := tt.expected.(type) {
+			case string:
+				assert.IsType(t, &objects.String{}, result)
+				assert.Equal(t, expected, result.String())
+			case float64:
+				assert.IsType(t, &objects.Number{}, result)
+				assert.Equal(t, expected, result.(*objects.Number).Value)
+			}
+		})
+	}
+}
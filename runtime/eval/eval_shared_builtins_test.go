@@ -0,0 +1,80 @@
+package eval
+
+import (
+	"bytes"
+	"context"
+	"refl/runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEvalSharedBuiltins(t *testing.T) {
+	builtins := NewSharedBuiltins()
+
+	tests := []struct {
+		name        string
+		input       string
+		expected    string
+		errorSubstr string
+	}{
+		{"modules work", `result = str(math.abs(-2)) + strings.upper("a") + type(len)`, "2Afunction", ""},
+		{"modules are frozen", `math.PI = 3`, "", "cannot modify frozen object"},
+		{"new members are rejected", `io.custom = fun() {}`, "", "cannot modify frozen object"},
+		{"clones are mutable", `var m = clone(math) m.PI = 3 result = str(m.PI) + " " + str(math.PI > 3)`, "3 1", ""},
+		{"globals can be shadowed", `math = {abs: fun(x) { return "mine" }} result = math.abs(1)`, "mine", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			env := runtime.NewEnvironment(nil)
+			_, err := New(ctx, parseProgram(t, tt.input), env, OptionSharedBuiltins{Builtins: builtins}).Run()
+			if tt.errorSubstr != "" {
+				require.ErrorContains(t, err, tt.errorSubstr)
+				return
+			}
+			require.NoError(t, err)
+
+			result, _ := env.Get("result")
+			require.Equal(t, tt.expected, result.String())
+		})
+	}
+
+	// the next evaluator still sees the original modules
+	env := runtime.NewEnvironment(nil)
+	_, err := New(context.Background(), parseProgram(t, `result = math.abs(-1)`), env, OptionSharedBuiltins{Builtins: builtins}).Run()
+	require.NoError(t, err)
+	result, _ := env.Get("result")
+	require.Equal(t, "1", result.String())
+}
+
+func TestEvalSharedBuiltinsConcurrently(t *testing.T) {
+	builtins := NewSharedBuiltins()
+	program := parseProgram(t, `var total = 0
+for i, word in strings.split("a b c", " ") {
+  total = total + len(word) + math.max(i, 1)
+}
+io.println(total)`)
+
+	var wg sync.WaitGroup
+	outputs := make([]bytes.Buffer, 16)
+	for i := range outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := New(context.Background(), program, runtime.NewEnvironment(nil),
+				OptionSharedBuiltins{Builtins: builtins}, OptionStdout{Writer: &outputs[i]}).Run()
+			require.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+
+	for i := range outputs {
+		require.Equal(t, "7\n", outputs[i].String())
+	}
+}
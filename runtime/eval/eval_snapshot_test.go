@@ -0,0 +1,136 @@
+package eval
+
+import (
+	"context"
+	"encoding/json"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const snapshotProgram = `
+	var makeCounter = fun() {
+		var n = 0
+		return fun() {
+			n = n + 1
+			return n
+		}
+	}
+	var next = makeCounter()
+	next()
+	next()
+
+	var state = {name: "refl", nested: {list: {1, 2, 3}}, err: errors.new("bad")}
+	state.self = state
+	var m = math
+	result = nil
+
+	events.register("inc", fun(evt) { return next() })
+	events.register("state", fun(evt) { return state.nested.list[2] + len(state.self.name) + m.abs(-1) })
+	events.register("error", fun(evt) { return state.err })
+	events.register("result", fun(evt) { return result })
+	events.timeout(fun(x) { result = x }, 100, "fired")
+`
+
+func fireSync(t *testing.T, ctx context.Context, evaluator *Evaluator, event string) runtime.Object {
+	t.Helper()
+
+	result, err := evaluator.FireEventSync(event, nil).Await(ctx)
+	require.NoError(t, err)
+
+	results := result.(*objects.ReflObject)
+	require.Equal(t, 1, results.Length())
+
+	value, _ := results.Get(objects.NewNumber(0))
+
+	return value
+}
+
+// TestEvaluatorSnapshotRestore verifies that a restored evaluator continues with the same
+// globals, closures, handlers and timers
+func TestEvaluatorSnapshotRestore(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	evaluator, errChan := serveProgram(t, ctx, snapshotProgram)
+	assert.Equal(t, float64(3), fireSync(t, ctx, evaluator, "inc").(*objects.Number).Value)
+
+	data, err := evaluator.Snapshot()
+	require.NoError(t, err)
+
+	require.NoError(t, evaluator.Shutdown(ctx))
+	require.NoError(t, <-errChan)
+
+	program := parseProgram(t, snapshotProgram)
+	restored, err := Restore(ctx, program, runtime.NewEnvironment(nil), data)
+	require.NoError(t, err)
+
+	restoredErrChan := make(chan error, 1)
+	go func() {
+		_, err := restored.Serve()
+		restoredErrChan <- err
+	}()
+
+	assert.Equal(t, float64(4), fireSync(t, ctx, restored, "inc").(*objects.Number).Value)
+	assert.Equal(t, float64(8), fireSync(t, ctx, restored, "state").(*objects.Number).Value)
+	assert.Equal(t, "bad", fireSync(t, ctx, restored, "error").String())
+
+	require.Eventually(t, func() bool {
+		return fireSync(t, ctx, restored, "result").String() == "fired"
+	}, time.Second, 10*time.Millisecond)
+
+	require.NoError(t, restored.Shutdown(ctx))
+	require.NoError(t, <-restoredErrChan)
+}
+
+// TestEvaluatorSnapshotDropped verifies that values which cannot be persisted are listed
+func TestEvaluatorSnapshotDropped(t *testing.T) {
+	program := parseProgram(t, `
+		var print = io.println
+		var p = promise.resolve(1)
+		var ok = {n: 1}
+	`)
+
+	evaluator := New(context.Background(), program, runtime.NewEnvironment(nil))
+	_, err := evaluator.Run()
+	require.NoError(t, err)
+
+	data, err := evaluator.Snapshot()
+	require.NoError(t, err)
+
+	var snap snapshot
+	require.NoError(t, json.Unmarshal(data, &snap))
+	assert.ElementsMatch(t, []string{"print", "p"}, snap.Dropped)
+}
+
+// TestEvaluatorRestoreErrors verifies that incompatible snapshots are rejected
+func TestEvaluatorRestoreErrors(t *testing.T) {
+	program := parseProgram(t, `var f = fun() { return 1 }`)
+
+	evaluator := New(context.Background(), program, runtime.NewEnvironment(nil))
+	_, err := evaluator.Run()
+	require.NoError(t, err)
+
+	data, err := evaluator.Snapshot()
+	require.NoError(t, err)
+
+	for _, input := range []string{
+		`var x = 1`,
+		// the function at the same position would be bound to the closure
+		`var f = fun() { return 2 }`,
+		// the function moved
+		"\nvar f = fun() { return 1 }",
+	} {
+		_, err = Restore(context.Background(), parseProgram(t, input), runtime.NewEnvironment(nil), data)
+		require.Error(t, err, input)
+		assert.Contains(t, err.Error(), "snapshot does not match the program", input)
+	}
+
+	_, err = Restore(context.Background(), program, runtime.NewEnvironment(nil), []byte(`{"version": 99}`))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "unsupported snapshot version 99")
+}
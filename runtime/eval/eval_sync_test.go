@@ -0,0 +1,156 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalSync verifies that the sync primitives coordinate coroutines correctly
+func TestEvalSync(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"mutex guards shared counter", `
+			var state = sync.shared({count: 0})
+			var m = sync.mutex()
+			var wg = sync.wait_group()
+			for i, _ in range(0, 20) {
+				wg.add(1)
+				refl(fun(s, m, wg) {
+					m.lock()
+					var count = s.count
+					time.sleep(1)
+					s.count = count + 1
+					m.unlock()
+					wg.done()
+				}, state, m, wg)
+			}
+			wg.wait()
+			result = state.count
+		`, float64(20)},
+
+		{"try_lock on locked mutex", `
+			var m = sync.mutex()
+			m.lock()
+			result = m.try_lock()
+		`, float64(0)},
+
+		{"unlock of unlocked mutex", `
+			refl(fun(m) { m.unlock() }, sync.mutex()).catch(fun(e) { result = str(e) })
+		`, "unlock of unlocked mutex"},
+
+		{"cancel blocked lock", `
+			var m = sync.mutex()
+			m.lock()
+			var p = refl(fun(m) { m.lock() return "locked" }, m)
+			p.catch(fun(e) { result = str(e) })
+			p.cancel()
+		`, "context cancelled"},
+
+		{"rwmutex allows multiple readers", `
+			var rw = sync.rwmutex()
+			rw.rlock()
+			rw.rlock()
+			rw.runlock()
+			rw.runlock()
+			rw.lock()
+			rw.unlock()
+			result = "ok"
+		`, "ok"},
+
+		{"rwmutex writer waits for readers", `
+			var rw = sync.rwmutex()
+			var log = sync.shared({value: ""})
+			rw.rlock()
+			var p = refl(fun(rw, log) {
+				rw.lock()
+				log.value = log.value + "write"
+				rw.unlock()
+			}, rw, log)
+			time.sleep(20)
+			log.value = log.value + "read,"
+			rw.runlock()
+			p.then(fun() { result = log.value })
+		`, "read,write"},
+
+		{"wait group waits for coroutines", `
+			var wg = sync.wait_group()
+			var state = sync.shared({done: 0})
+			wg.add(3)
+			for i, _ in range(0, 3) {
+				refl(fun(wg, s) { time.sleep(10) s.done = 1 wg.done() }, wg, state)
+			}
+			wg.wait()
+			result = state.done
+		`, float64(1)},
+
+		{"cancel wait group wait", `
+			var wg = sync.wait_group()
+			wg.add(1)
+			var p = refl(fun(wg) { wg.wait() }, wg)
+			p.catch(fun(e) { result = str(e) })
+			p.cancel()
+		`, "context cancelled"},
+
+		{"semaphore limits acquires", `
+			var s = sync.semaphore(2)
+			s.acquire()
+			s.acquire()
+			result = str(s.try_acquire())
+			s.release()
+			result = result + str(s.try_acquire())
+		`, "01"},
+
+		{"once runs function once", `
+			var o = sync.once()
+			var calls = 0
+			o.do(fun() { calls = calls + 1 return "first" })
+			result = o.do(fun() { calls = calls + 1 return "second" }) + calls
+		`, "first1"},
+
+		{"shared object is passed by reference", `
+			var s = sync.shared({a: 1})
+			refl(fun(s) { s.a = 2 }, s).then(fun() { result = s.a })
+		`, float64(2)},
+
+		{"regular object is cloned", `
+			var o = {a: 1}
+			refl(fun(o) { o.a = 2 }, o).then(fun() { result = o.a })
+		`, float64(1)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+
+			switch expected := tt.expected.(type) {
+			case string:
+				assert.IsType(t, &objects.String{}, result)
+				assert.Equal(t, expected, result.String())
+			case float64:
+				assert.IsType(t, &objects.Number{}, result)
+				assert.Equal(t, expected, result.(*objects.Number).Value)
+			}
+		})
+	}
+}
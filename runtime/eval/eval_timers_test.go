@@ -0,0 +1,103 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"testing"
+	"time"
+
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalTimers verifies that the timer helpers of the events module work correctly
+func TestEvalTimers(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected interface{}
+	}{
+		{"timeout", `
+			events.timeout(fun(x) { result = x }, 20, "done")
+		`, "done"},
+
+		{"cancelled timeout", `
+			result = "not fired"
+			var cancel = events.timeout(fun() { result = "fired" }, 20)
+			cancel()
+		`, "not fired"},
+
+		{"interval repeats until cancelled", `
+			var count = 0
+			var stop = nil
+			stop = events.interval(fun() {
+				count = count + 1
+				if count == 3 {
+					stop()
+					result = count
+				}
+			}, 10)
+		`, float64(3)},
+
+		{"interval does not drift", `
+			var start = time.now()
+			var count = 0
+			var stop = nil
+			stop = events.interval(fun() {
+				time.sleep(15)
+				count = count + 1
+				if count == 5 {
+					stop()
+					result = time.now() - start < 150
+				}
+			}, 20)
+		`, float64(1)},
+
+		{"debounce calls once with latest arguments", `
+			var calls = 0
+			var d = events.debounce(fun(x) {
+				calls = calls + 1
+				result = str(calls) + ":" + x
+			}, 20)
+			d("a")
+			d("b")
+			d("c")
+		`, "1:c"},
+
+		{"throttle drops calls within period", `
+			var calls = 0
+			var t = events.throttle(fun(x) { calls = calls + 1 return x }, 1000)
+			var first = t(1)
+			var second = t(2)
+			result = str(calls) + ":" + str(first) + ":" + type(second)
+		`, "1:1:nil"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+
+			switch expected := tt.expected.(type) {
+			case string:
+				assert.IsType(t, &objects.String{}, result)
+				assert.Equal(t, expected, result.String())
+			case float64:
+				assert.IsType(t, &objects.Number{}, result)
+				assert.Equal(t, expected, result.(*objects.Number).Value)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package eval
+
+import (
+	"context"
+	"refl/runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"refl/runtime/objects"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestEvalUnhandledRejections verifies that rejections without handlers are reported by Run
+func TestEvalUnhandledRejections(t *testing.T) {
+	tests := []struct {
+		name          string
+		input         string
+		expectedError []string
+	}{
+		{"unhandled coroutine rejection", `
+			refl(fun() { errors.panic("boom") })
+		`, []string{"Unhandled promise rejection: boom"}},
+
+		{"unhandled rejection at the end of a chain", `
+			refl(fun() { errors.panic("boom") }).then(fun(v) {})
+		`, []string{"Unhandled promise rejection: boom"}},
+
+		{"handled rejection", `
+			refl(fun() { errors.panic("boom") }).catch(fun(e) {})
+		`, nil},
+
+		{"handler attached after rejection", `
+			var p = promise.reject("late")
+			p.catch(fun(e) {})
+		`, nil},
+
+		{"awaited rejection", `
+			refl(fun() {
+				await promise.reject("awaited")
+			}).catch(fun(e) {})
+		`, nil},
+
+		{"multiple unhandled rejections", `
+			promise.reject("first")
+			promise.reject("second")
+		`, []string{"Unhandled promise rejection: first", "Unhandled promise rejection: second"}},
+
+		{"panic and unhandled rejection", `
+			promise.reject("ignored")
+			events.timeout(fun() { errors.panic("first") }, 10)
+			events.timeout(fun() { errors.panic("never runs") }, 1000)
+		`, []string{
+			"Unhandled promise rejection: ignored",
+			"Event loop panic in scheduled task: timeout call failed: first",
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+
+			evaluator := New(ctx, program, runtime.NewEnvironment(nil))
+			_, err := evaluator.Run()
+
+			if tt.expectedError == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.Error(t, err)
+			for _, expected := range tt.expectedError {
+				assert.Contains(t, err.Error(), expected)
+			}
+		})
+	}
+}
+
+// TestEvalOnUnhandledHook verifies that scripts can handle unhandled rejections themselves
+func TestEvalOnUnhandledHook(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{"hook receives rejection", `
+			errors.on_unhandled(fun(e) { result = "hook: " + e })
+			refl(fun() { errors.panic("boom") })
+		`, "hook: boom"},
+
+		{"hook receives rejections of nested coroutines", `
+			errors.on_unhandled(fun(e) { result = "hook: " + e })
+			refl(fun() {
+				refl(fun() { errors.panic("nested") })
+			})
+		`, "hook: nested"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+			defer cancel()
+
+			program := parseProgram(t, tt.input)
+			env := runtime.NewEnvironment(nil)
+
+			evaluator := New(ctx, program, env)
+			_, err := evaluator.Run()
+			require.NoError(t, err)
+
+			result, ok := env.Get("result")
+			require.True(t, ok, "result was not set")
+			assert.IsType(t, &objects.String{}, result)
+			assert.Equal(t, tt.expected, result.String())
+		})
+	}
+}
+
+// TestEvalOnUnhandledHookRemoved verifies that removed hooks are no longer called
+func TestEvalOnUnhandledHookRemoved(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	program := parseProgram(t, `
+		var remove = errors.on_unhandled(fun(e) {})
+		remove()
+		refl(fun() { errors.panic("boom") })
+	`)
+
+	evaluator := New(ctx, program, runtime.NewEnvironment(nil))
+	_, err := evaluator.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "Unhandled promise rejection: boom")
+}
+
+// TestEvalOnUnhandledRejectionOption verifies that the host can receive unhandled rejections
+func TestEvalOnUnhandledRejectionOption(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	var mu sync.Mutex
+	var rejections []string
+
+	program := parseProgram(t, `
+		refl(fun() { errors.panic("boom") })
+		promise.reject("bad")
+	`)
+
+	evaluator := New(ctx, program, runtime.NewEnvironment(nil), OptionOnUnhandledRejection{
+		Handler: func(err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			rejections = append(rejections, err.Error())
+		},
+	})
+	_, err := evaluator.Run()
+	require.NoError(t, err)
+
+	assert.ElementsMatch(t, []string{"boom", "bad"}, rejections)
+}
+
+// TestEvalEventPanicSource verifies that panics in event handlers name the event
+func TestEvalEventPanicSource(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+
+	program := parseProgram(t, `
+		var remove = nil
+		remove = events.register("click", fun(e) {
+			remove()
+			errors.panic("clicked")
+		})
+	`)
+
+	evaluator := New(ctx, program, runtime.NewEnvironment(nil))
+	evaluator.FireEvent("click", nil)
+
+	_, err := evaluator.Run()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `Event loop panic in event "click": callback failed: clicked`)
+}
@@ -7,13 +7,45 @@ import (
 	"refl/runtime"
 	"refl/runtime/eventloop"
 	"refl/runtime/objects"
+	"sync"
+	"sync/atomic"
 )
 
 type Evaluator struct {
 	ctx       context.Context
+	cancel    context.CancelFunc
 	program   *ast.Program
 	env       *runtime.Environment
 	eventLoop *eventloop.EventLoop
+	coroutine bool
+
+	liveCoroutines *atomic.Int64
+
+	rejections        *rejectionHooks
+	pendingRejections []*objects.Promise
+	unhandled         []error
+	rejectionsMu      sync.Mutex
+
+	serveUnlock func()
+	shutdown    bool
+	serveMu     sync.Mutex
+
+	// builtins maps the globals defined before the program runs to their names
+	builtins map[runtime.Object]string
+	// restored evaluators continue from a snapshot instead of running the program
+	restored bool
+
+	// debug is set when the evaluator runs with a debug hook
+	debug *debugState
+	// profile is set when the evaluator runs with a profiler
+	profile *profileState
+}
+
+// Stats is a snapshot of the evaluator's event loop and coroutines
+type Stats struct {
+	eventloop.Stats
+	// Coroutines is the number of running and queued coroutines, including nested ones
+	Coroutines int
 }
 
 func (e *Evaluator) Context() context.Context {
@@ -26,51 +58,163 @@ func (e *Evaluator) FireEvent(event string, args []runtime.Object) {
 	}
 }
 
+// FireEventSync fires an event and returns a promise resolved with an array of the
+// handlers' return values in call order, or rejected with the first handler error
+func (e *Evaluator) FireEventSync(event string, args []runtime.Object) *objects.Promise {
+	promise := objects.NewPromise(nil)
+
+	if e.eventLoop == nil {
+		promise.Reject(runtime.NewPanic("cannot fire events with events disabled", 0, 0))
+		return promise
+	}
+
+	e.eventLoop.FireSync(event, args, func(results []runtime.Object, err error) {
+		if err != nil {
+			promise.Reject(err)
+			return
+		}
+
+		arr := objects.NewObject()
+		for i, result := range results {
+			if result == nil {
+				result = objects.NilInstance
+			}
+			_ = arr.Set(objects.NewNumber(float64(i)), result)
+		}
+		promise.Resolve(arr)
+	})
+
+	return promise
+}
+
 func (e *Evaluator) EnqueueTask(task eventloop.Task) {
 	if e.eventLoop != nil {
 		e.eventLoop.Enqueue(task)
 	}
 }
 
-func (e *Evaluator) Run() (runtime.Object, error) {
-	result, err := e.evalProgram(e.program, e.env)
+// Stats returns a snapshot of the registered events, pending tasks and live coroutines
+func (e *Evaluator) Stats() Stats {
+	var stats Stats
+	if e.eventLoop != nil {
+		stats.Stats = e.eventLoop.Stats()
+	}
+	stats.Coroutines = int(e.liveCoroutines.Load())
+
+	return stats
+}
+
+// Serve runs the program like Run, but keeps the event loop alive
+// even without registered handlers until Shutdown is called
+func (e *Evaluator) Serve() (runtime.Object, error) {
+	if e.eventLoop == nil {
+		return nil, runtime.NewPanic("cannot serve with events disabled", 0, 0)
+	}
+
+	e.serveMu.Lock()
+	if !e.shutdown {
+		e.serveUnlock = e.eventLoop.RegisterLock()
+	}
+	e.serveMu.Unlock()
+
+	return e.Run()
+}
+
+// Shutdown gracefully stops the event loop, letting running tasks and coroutines finish.
+// If ctx is done first, the evaluator is cancelled and the ctx error is returned.
+func (e *Evaluator) Shutdown(ctx context.Context) error {
+	if e.eventLoop == nil {
+		return nil
+	}
+
+	e.serveMu.Lock()
+	e.shutdown = true
+	if e.serveUnlock != nil {
+		e.serveUnlock()
+		e.serveUnlock = nil
+	}
+	e.serveMu.Unlock()
+
+	err := e.eventLoop.Shutdown(ctx)
 	if err != nil {
-		return result, err
+		e.cancel()
+	}
+
+	return err
+}
+
+func (e *Evaluator) Run() (runtime.Object, error) {
+	var result runtime.Object = objects.NilInstance
+	if !e.restored {
+		var err error
+		result, err = e.evalProgram(e.program, e.env)
+		if err != nil {
+			return result, err
+		}
 	}
 
 	if e.eventLoop != nil {
 		e.eventLoop.Start()
 		e.eventLoop.Wait()
 
-		r := e.eventLoop.LastPanic()
-		if r != nil {
-			return nil, runtime.NewPanic(fmt.Sprintf("Event loop panic: %v", r), 0, 0)
+		if err := e.loopError(); err != nil {
+			return nil, err
 		}
 	}
 
 	return result, nil
 }
 
-func (e *Evaluator) runCoroutine(fn *objects.Function, args []runtime.Object) (runtime.Object, error) {
-	result, err := fn.Call(e.ctx, args)
+// Call calls a function with the evaluator's context and waits for the events it scheduled,
+// it's meant to call script functions after Run, e.g. the functions a program exported
+func (e *Evaluator) Call(fn runtime.Object, args []runtime.Object) (runtime.Object, error) {
+	callable, ok := fn.(runtime.Callable)
+	if !ok {
+		return nil, runtime.NewPanic("attempt to call non-function", 0, 0)
+	}
+
+	result, err := callable.Call(e.ctx, args)
 	if err != nil {
 		return nil, err
 	}
 
+	if ret, isReturn := result.(*objects.ReturnSignal); isReturn {
+		result = ret.Value
+	}
+
 	if e.eventLoop != nil {
 		e.eventLoop.Start()
 		e.eventLoop.Wait()
 
-		r := e.eventLoop.LastPanic()
-		if r != nil {
-			return nil, runtime.NewPanic(fmt.Sprintf("Event loop panic: %v", r), 0, 0)
+		if err := e.loopError(); err != nil {
+			return nil, err
 		}
 	}
 
 	return result, nil
 }
 
+func (e *Evaluator) runCoroutine(fn *objects.Function, args []runtime.Object) (runtime.Object, error) {
+	return e.Call(fn, args)
+}
+
 func (e *Evaluator) evalGeneric(node ast.Node, env *runtime.Environment) (runtime.Object, error) {
+	if e.profile != nil {
+		if stmt, ok := node.(ast.Statement); ok {
+			e.profile.profiler.countStatement(stmt)
+		}
+	}
+
+	if e.debug != nil {
+		if stmt, ok := node.(ast.Statement); ok {
+			if _, isBlock := stmt.(*ast.BlockStatement); !isBlock {
+				if err := e.debugStatement(stmt, env); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
 	switch n := node.(type) {
 	case *ast.Program:
 		return e.evalProgram(n, env)
@@ -118,10 +262,14 @@ func (e *Evaluator) evalGeneric(node ast.Node, env *runtime.Environment) (runtim
 		return e.evalMethodCall(n, env)
 	case *ast.UnaryExpression:
 		return e.evalUnaryExpression(n, env)
+	case *ast.AwaitExpression:
+		return e.evalAwaitExpression(n, env)
 	case *ast.BinaryExpression:
 		return e.evalBinaryExpression(n, env)
 	case *ast.Assignment:
 		return e.evalAssignment(n, env)
+	case *ast.Tuple:
+		return e.evalArrayLiteral(&ast.ArrayLiteral{Pos: n.Pos, Elements: n.Elements}, env)
 	default:
 		return nil, runtime.NewPanic(fmt.Sprintf("unknown node type: %T", node), 0, 0)
 	}
@@ -141,6 +289,11 @@ func (e *Evaluator) evalProgram(program *ast.Program, env *runtime.Environment)
 	return result, nil
 }
 
+// EvalExpression evaluates an expression in the environment
+func (e *Evaluator) EvalExpression(expr ast.Expression, env *runtime.Environment) (runtime.Object, error) {
+	return e.evalGeneric(expr, env)
+}
+
 func (e *Evaluator) EvalBlock(block *ast.BlockStatement, env *runtime.Environment) (runtime.Object, error) {
 	var result runtime.Object = objects.NilInstance
 	blockEnv := runtime.NewEnvironment(env)
@@ -184,6 +337,17 @@ func (e *Evaluator) evalVarDeclaration(vd *ast.VarDeclaration, env *runtime.Envi
 		value = val
 	}
 
+	if vd.Pattern != nil {
+		err := e.destructure(vd.Pattern, value, func(target ast.Expression, value runtime.Object) error {
+			env.Define(target.(*ast.Identifier).Name, value)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return value, nil
+	}
+
 	env.Define(vd.Name, value)
 	return value, nil
 }
@@ -251,10 +415,8 @@ func (e *Evaluator) evalWhileStatement(ws *ast.WhileStatement, env *runtime.Envi
 	var result runtime.Object = objects.NilInstance
 
 	for {
-		select {
-		case <-e.ctx.Done():
-			return nil, runtime.NewPanic("context cancelled", 0, 0)
-		default:
+		if err := runtime.CheckContext(e.ctx); err != nil {
+			return nil, err
 		}
 
 		cond, err := e.evalGeneric(ws.Condition, env)
@@ -303,18 +465,29 @@ func (e *Evaluator) evalForStatement(fs *ast.ForStatement, env *runtime.Environm
 		return nil, runtime.NewPanic("cannot iterate over non-iterable object", fs.Pos.Line, fs.Pos.Column)
 	}
 
+	iterator := iterable.Iterator()
+	if ctxIterable, ok := obj.(runtime.ContextIterable); ok {
+		iterator = ctxIterable.IteratorContext(e.ctx)
+	}
+
 	var result runtime.Object = objects.NilInstance
 
-	for key, value := range iterable.Iterator() {
-		select {
-		case <-e.ctx.Done():
-			return nil, runtime.NewPanic("context cancelled", 0, 0)
-		default:
+	for key, value := range iterator {
+		if err := runtime.CheckContext(e.ctx); err != nil {
+			return nil, err
 		}
 
 		forEnv := runtime.NewEnvironment(env)
 		forEnv.Define(fs.Key, key)
-		if fs.Value != "" {
+		if fs.ValuePattern != nil {
+			err := e.destructure(fs.ValuePattern, value, func(target ast.Expression, value runtime.Object) error {
+				forEnv.Define(target.(*ast.Identifier).Name, value)
+				return nil
+			})
+			if err != nil {
+				return nil, err
+			}
+		} else if fs.Value != "" {
 			forEnv.Define(fs.Value, value)
 		}
 
@@ -335,6 +508,10 @@ func (e *Evaluator) evalForStatement(fs *ast.ForStatement, env *runtime.Environm
 		}
 	}
 
+	if err := runtime.CheckContext(e.ctx); err != nil {
+		return nil, err
+	}
+
 	return result, nil
 }
 
@@ -415,7 +592,10 @@ func (e *Evaluator) evalArrayLiteral(al *ast.ArrayLiteral, env *runtime.Environm
 }
 
 func (e *Evaluator) evalFunctionLiteral(fl *ast.FunctionLiteral, env *runtime.Environment) (runtime.Object, error) {
-	return objects.NewFunction(fl.Parameters, fl.Body, runtime.NewEnvironment(env)), nil
+	fn := objects.NewFunction(fl.Parameters, fl.Body, runtime.NewEnvironment(env))
+	fn.Defaults = fl.Defaults
+	fn.Rest = fl.Rest
+	return fn, nil
 }
 
 func (e *Evaluator) evalMemberDot(md *ast.MemberDot, env *runtime.Environment) (runtime.Object, error) {
@@ -469,18 +649,26 @@ func (e *Evaluator) evalFunctionCall(fc *ast.FunctionCall, env *runtime.Environm
 		return nil, runtime.NewPanic("attempt to call non-function", fc.Pos.Line, fc.Pos.Column)
 	}
 
-	// Evaluate arguments
-	var args []runtime.Object
-	for _, argExpr := range fc.Arguments {
-		arg, err := e.evalGeneric(argExpr, env)
-		if err != nil {
-			return nil, err
-		}
-		args = append(args, arg)
+	args, keywords, err := e.evalArguments(fc.Arguments, env)
+	if err != nil {
+		return nil, err
+	}
+
+	// Stop before the call if the evaluation was cancelled, so that deep recursion ends too
+	if err := runtime.CheckContext(e.ctx); err != nil {
+		return nil, err
+	}
+
+	if e.debug != nil {
+		defer e.enterFrame(fc.Function.String(), callable)()
+	}
+
+	if e.profile != nil {
+		defer e.enterCall(fc.Function.String(), fc.Pos, callable)()
 	}
 
 	// Call the function
-	result, err := callable.Call(e.ctx, args)
+	result, err := e.call(callable, args, keywords, fc.Pos)
 	if err != nil {
 		return nil, err
 	}
@@ -521,19 +709,26 @@ func (e *Evaluator) evalMethodCall(mc *ast.MethodCall, env *runtime.Environment)
 		return nil, runtime.NewPanic("attempt to call non-function method", mc.Pos.Line, mc.Pos.Column)
 	}
 
-	// Evaluate arguments
-	var args []runtime.Object
-	for _, argExpr := range mc.Arguments {
-		arg, err := e.evalGeneric(argExpr, env)
-		if err != nil {
-			return nil, err
-		}
-		args = append(args, arg)
+	args, keywords, err := e.evalArguments(mc.Arguments, env)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := runtime.CheckContext(e.ctx); err != nil {
+		return nil, err
+	}
+
+	if e.debug != nil {
+		defer e.enterFrame(mc.Object.String()+":"+mc.Method, callable)()
+	}
+
+	if e.profile != nil {
+		defer e.enterCall(mc.Object.String()+":"+mc.Method, mc.Pos, callable)()
 	}
 
 	// Call method with object as first argument
 	allArgs := append([]runtime.Object{obj}, args...)
-	result, err := callable.Call(e.ctx, allArgs)
+	result, err := e.call(callable, allArgs, keywords, mc.Pos)
 	if err != nil {
 		return nil, err
 	}
@@ -546,6 +741,70 @@ func (e *Evaluator) evalMethodCall(mc *ast.MethodCall, env *runtime.Environment)
 	return result, nil
 }
 
+// evalArguments evaluates call arguments, expanding spread arrays and collecting keyword arguments by name
+func (e *Evaluator) evalArguments(exprs []ast.Expression, env *runtime.Environment) ([]runtime.Object, map[string]runtime.Object, error) {
+	var args []runtime.Object
+	var keywords map[string]runtime.Object
+
+	for _, argExpr := range exprs {
+		switch arg := argExpr.(type) {
+		case *ast.Spread:
+			value, err := e.evalGeneric(arg.Value, env)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			obj, ok := value.(*objects.ReflObject)
+			if !ok || obj.Length() > 0 && !isArray(obj) {
+				return nil, nil, runtime.NewPanic(fmt.Sprintf("cannot spread %s, expected an array", value.Type()), arg.Pos.Line, arg.Pos.Column)
+			}
+			for _, elem := range obj.Iterator() {
+				args = append(args, elem)
+			}
+		case *ast.KeywordArgument:
+			value, err := e.evalGeneric(arg.Value, env)
+			if err != nil {
+				return nil, nil, err
+			}
+
+			if keywords == nil {
+				keywords = make(map[string]runtime.Object)
+			}
+			if _, ok := keywords[arg.Name]; ok {
+				return nil, nil, runtime.NewPanic(fmt.Sprintf("argument %s given twice", arg.Name), arg.Pos.Line, arg.Pos.Column)
+			}
+			keywords[arg.Name] = value
+		default:
+			value, err := e.evalGeneric(argExpr, env)
+			if err != nil {
+				return nil, nil, err
+			}
+			args = append(args, value)
+		}
+	}
+
+	return args, keywords, nil
+}
+
+// call calls the callable, passing keyword arguments only to the callables taking them
+func (e *Evaluator) call(callable runtime.Callable, args []runtime.Object, keywords map[string]runtime.Object, pos ast.Position) (runtime.Object, error) {
+	if len(keywords) == 0 {
+		return callable.Call(e.ctx, args)
+	}
+
+	kc, ok := callable.(runtime.KeywordCallable)
+	if !ok {
+		return nil, runtime.NewPanic("function does not take keyword arguments", pos.Line, pos.Column)
+	}
+	// checked here as well to report the position of the call
+	if fn, ok := callable.(*objects.Function); ok {
+		if msg := fn.KeywordError(len(args), keywords); msg != "" {
+			return nil, runtime.NewPanic(msg, pos.Line, pos.Column)
+		}
+	}
+	return kc.CallKeywords(e.ctx, args, keywords)
+}
+
 func (e *Evaluator) evalUnaryExpression(ue *ast.UnaryExpression, env *runtime.Environment) (runtime.Object, error) {
 	right, err := e.evalGeneric(ue.Right, env)
 	if err != nil {
@@ -566,6 +825,30 @@ func (e *Evaluator) evalUnaryExpression(ue *ast.UnaryExpression, env *runtime.En
 	}
 }
 
+func (e *Evaluator) evalAwaitExpression(ae *ast.AwaitExpression, env *runtime.Environment) (runtime.Object, error) {
+	val, err := e.evalGeneric(ae.Value, env)
+	if err != nil {
+		return nil, err
+	}
+
+	promise, ok := val.(*objects.Promise)
+	if !ok {
+		// awaiting anything but a promise yields the value itself
+		return val, nil
+	}
+
+	if !e.coroutine {
+		return nil, runtime.NewPanic("await is only allowed inside refl() coroutines", ae.Pos.Line, ae.Pos.Column)
+	}
+
+	// keep running the coroutine's own tasks, the promise may depend on them
+	if e.eventLoop != nil {
+		e.eventLoop.RunUntil(promise.Done())
+	}
+
+	return promise.Await(e.ctx)
+}
+
 func (e *Evaluator) evalBinaryExpression(be *ast.BinaryExpression, env *runtime.Environment) (runtime.Object, error) {
 	left, err := e.evalGeneric(be.Left, env)
 	if err != nil {
@@ -662,47 +945,102 @@ func (e *Evaluator) evalAssignment(a *ast.Assignment, env *runtime.Environment)
 		return nil, err
 	}
 
-	switch left := a.Left.(type) {
+	if err := e.assign(a.Left, right, a.Pos, env); err != nil {
+		return nil, err
+	}
+	return right, nil
+}
+
+// assign stores the value in an assignment target, pos locates the assignment for errors
+func (e *Evaluator) assign(target ast.Expression, value runtime.Object, pos ast.Position, env *runtime.Environment) error {
+	switch left := target.(type) {
 	case *ast.Identifier:
-		env.Set(left.Name, right)
-		return right, nil
+		env.Set(left.Name, value)
+		return nil
 	case *ast.MemberDot:
 		obj, err := e.evalGeneric(left.Object, env)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		indexable, ok := obj.(runtime.Indexable)
 		if !ok {
-			return nil, runtime.NewPanic("cannot assign to member of non-indexable object", left.Pos.Line, left.Pos.Column)
+			return runtime.NewPanic("cannot assign to member of non-indexable object", left.Pos.Line, left.Pos.Column)
 		}
 
-		key := objects.NewString(left.Member)
-		if err := indexable.Set(key, right); err != nil {
-			return nil, err
-		}
-		return right, nil
+		return indexable.Set(objects.NewString(left.Member), value)
 	case *ast.MemberBracket:
 		obj, err := e.evalGeneric(left.Object, env)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		key, err := e.evalGeneric(left.Member, env)
 		if err != nil {
-			return nil, err
+			return err
 		}
 
 		indexable, ok := obj.(runtime.Indexable)
 		if !ok {
-			return nil, runtime.NewPanic("cannot assign to member of non-indexable object", left.Pos.Line, left.Pos.Column)
+			return runtime.NewPanic("cannot assign to member of non-indexable object", left.Pos.Line, left.Pos.Column)
 		}
 
-		if err := indexable.Set(key, right); err != nil {
-			return nil, err
-		}
-		return right, nil
+		return indexable.Set(key, value)
+	case *ast.Pattern:
+		return e.destructure(left, value, func(target ast.Expression, value runtime.Object) error {
+			return e.assign(target, value, pos, env)
+		})
 	default:
-		return nil, runtime.NewPanic("invalid assignment target", a.Pos.Line, a.Pos.Column)
+		return runtime.NewPanic("invalid assignment target", pos.Line, pos.Column)
+	}
+}
+
+// destructure calls bind with each target of the pattern and its value. `a, b` takes the values by position,
+// `{a, b}` by name unless the value is an array. Missing values are nil.
+// All the values are read before the first bind, so that `a, b = b, a` swaps.
+func (e *Evaluator) destructure(pattern *ast.Pattern, value runtime.Object, bind func(ast.Expression, runtime.Object) error) error {
+	indexable, ok := value.(runtime.Indexable)
+	if !ok {
+		return runtime.NewPanic(fmt.Sprintf("cannot destructure %s", value.Type()), pattern.Pos.Line, pattern.Pos.Column)
+	}
+
+	byName := pattern.Braces && !isArray(value)
+	values := make([]runtime.Object, len(pattern.Elements))
+	for i, target := range pattern.Elements {
+		var key runtime.Object = objects.NewNumber(float64(i))
+		if byName {
+			id, ok := target.(*ast.Identifier)
+			if !ok {
+				return runtime.NewPanic("invalid destructuring target", pattern.Pos.Line, pattern.Pos.Column)
+			}
+			key = objects.NewString(id.Name)
+		}
+
+		val, err := indexable.Get(key)
+		if err != nil {
+			return err
+		}
+		values[i] = val
+	}
+
+	for i, target := range pattern.Elements {
+		if err := bind(target, values[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isArray reports whether the value is an object with numeric keys only, such as `{1, 2}`
+func isArray(value runtime.Object) bool {
+	obj, ok := value.(*objects.ReflObject)
+	if !ok || obj.Length() == 0 {
+		return false
+	}
+	for key := range obj.Iterator() {
+		if key.Type() != runtime.NumberType {
+			return false
+		}
 	}
+	return true
 }
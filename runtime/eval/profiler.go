@@ -0,0 +1,221 @@
+package eval
+
+import (
+	"refl/ast"
+	"refl/profile"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Profiler records the time spent in and the number of calls of script functions and builtins,
+// per call stack, along with how many times each statement of the program was evaluated.
+// It's attached to an evaluator with OptionProfiler and is shared with its coroutines.
+type Profiler struct {
+	filename string
+	start    time.Time
+	main     profile.Function
+
+	// statements counts the evaluations of the program's statements, the map is read-only after NewProfiler
+	statements map[ast.Statement]*atomic.Int64
+
+	mu        sync.Mutex
+	functions map[any]profile.Function
+	samples   map[string]*profile.Sample
+	// order lists the sample keys in the order they were first recorded
+	order   []string
+	stopped time.Duration
+}
+
+// profileFrame is a call in progress
+type profileFrame struct {
+	function profile.Function
+	// callLine is the line of the call site in the caller
+	callLine int
+	start    time.Time
+	// children is the time spent in the calls made by this one
+	children time.Duration
+}
+
+// profileState is the call stack of an evaluator running with a profiler
+type profileState struct {
+	profiler *Profiler
+	stack    []profileFrame
+	mu       sync.Mutex
+}
+
+// NewProfiler creates a profiler for the program, filename is the name reported for the program's source
+func NewProfiler(filename string, program *ast.Program) *Profiler {
+	p := &Profiler{
+		filename:   filename,
+		start:      time.Now(),
+		main:       profile.Function{Name: "main", Filename: filename, StartLine: 1},
+		statements: make(map[ast.Statement]*atomic.Int64),
+		functions:  make(map[any]profile.Function),
+		samples:    make(map[string]*profile.Sample),
+	}
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if stmt, ok := node.(ast.Statement); ok {
+			if _, isBlock := stmt.(*ast.BlockStatement); !isBlock {
+				p.statements[stmt] = new(atomic.Int64)
+			}
+		}
+		return true
+	})
+
+	return p
+}
+
+// OptionProfiler records the evaluation with the profiler
+type OptionProfiler struct {
+	Profiler *Profiler
+}
+
+func (o OptionProfiler) Apply(opts *Options) {
+	opts.profiler = o.Profiler
+}
+
+// Stop ends the profiling period, calls made afterwards are still recorded
+func (p *Profiler) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.stopped == 0 {
+		p.stopped = time.Since(p.start)
+	}
+}
+
+// countStatement records an evaluation of a statement, it's called from evalGeneric
+func (p *Profiler) countStatement(stmt ast.Statement) {
+	if counter, ok := p.statements[stmt]; ok {
+		counter.Add(1)
+	}
+}
+
+// function describes a callee, script functions are named after the first call site they're called from
+func (p *Profiler) function(name string, callable runtime.Callable) profile.Function {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if fn, ok := callable.(*objects.Function); ok {
+		if result, ok := p.functions[fn.Body]; ok {
+			return result
+		}
+
+		result := profile.Function{Name: name, Filename: p.filename, StartLine: fn.Body.Pos.Line}
+		p.functions[fn.Body] = result
+		return result
+	}
+
+	return profile.Function{Name: name, Filename: "<builtin>"}
+}
+
+// enterCall pushes a call onto the evaluator's call stack and returns a function recording it once it returns
+func (e *Evaluator) enterCall(name string, pos ast.Position, callable runtime.Callable) func() {
+	s := e.profile
+	frame := profileFrame{function: s.profiler.function(name, callable), callLine: pos.Line}
+
+	s.mu.Lock()
+	s.stack = append(s.stack, frame)
+	depth := len(s.stack)
+	s.stack[depth-1].start = time.Now()
+	s.mu.Unlock()
+
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// event handlers running while the caller awaits share the stack, their calls may have unwound ours
+		if len(s.stack) < depth {
+			return
+		}
+
+		call := s.stack[depth-1]
+		elapsed := time.Since(call.start)
+
+		stack := make([]profile.Frame, 0, depth+1)
+		stack = append(stack, profile.Frame{Function: call.function, Line: call.function.StartLine})
+		for i := depth - 2; i >= 0; i-- {
+			stack = append(stack, profile.Frame{Function: s.stack[i].function, Line: s.stack[i+1].callLine})
+		}
+		stack = append(stack, profile.Frame{Function: s.profiler.main, Line: s.stack[0].callLine})
+
+		s.stack = s.stack[:depth-1]
+		if depth > 1 {
+			s.stack[depth-2].children += elapsed
+		}
+
+		s.profiler.record(stack, elapsed-call.children)
+	}
+}
+
+func (p *Profiler) record(stack []profile.Frame, self time.Duration) {
+	var key strings.Builder
+	for _, frame := range stack {
+		key.WriteString(frame.Function.Name)
+		key.WriteByte(0)
+		key.WriteString(frame.Function.Filename)
+		key.WriteByte(0)
+		key.WriteString(strconv.Itoa(frame.Function.StartLine))
+		key.WriteByte(0)
+		key.WriteString(strconv.Itoa(frame.Line))
+		key.WriteByte(1)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	sample, ok := p.samples[key.String()]
+	if !ok {
+		sample = &profile.Sample{Stack: stack}
+		p.samples[key.String()] = sample
+		p.order = append(p.order, key.String())
+	}
+	sample.Calls++
+	sample.Time += self
+}
+
+// Profile returns the recorded samples, the top level code gets the time not spent in calls
+func (p *Profiler) Profile() *profile.Profile {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	duration := p.stopped
+	if duration == 0 {
+		duration = time.Since(p.start)
+	}
+
+	result := &profile.Profile{Start: p.start, Duration: duration}
+
+	var inCalls time.Duration
+	for _, key := range p.order {
+		sample := p.samples[key]
+		inCalls += sample.Time
+		result.Samples = append(result.Samples, *sample)
+	}
+
+	result.Samples = append(result.Samples, profile.Sample{
+		Stack: []profile.Frame{{Function: p.main, Line: 1}},
+		Calls: 1,
+		Time:  max(duration-inCalls, 0),
+	})
+
+	return result
+}
+
+// Coverage returns how many times each line of the program was evaluated, the most evaluated statement of a line counts
+func (p *Profiler) Coverage() *profile.Coverage {
+	result := &profile.Coverage{Filename: p.filename, Lines: make(map[int]int64)}
+
+	for stmt, counter := range p.statements {
+		line := stmt.Position().Line
+		result.Lines[line] = max(result.Lines[line], counter.Load())
+	}
+
+	return result
+}
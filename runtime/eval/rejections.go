@@ -0,0 +1,125 @@
+package eval
+
+import (
+	"fmt"
+	"refl/runtime"
+	"refl/runtime/objects"
+	"strings"
+	"sync"
+)
+
+// rejectionHooks receive the unhandled promise rejections of an evaluator and its coroutines
+type rejectionHooks struct {
+	mu      sync.Mutex
+	scripts []*objects.Function
+	host    func(err error)
+}
+
+// addScript registers a hook from errors.on_unhandled() and returns a function removing it
+func (h *rejectionHooks) addScript(fn *objects.Function) func() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.scripts = append(h.scripts, fn)
+
+	return func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		for i, other := range h.scripts {
+			if other == fn {
+				h.scripts = append(h.scripts[:i], h.scripts[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+func (h *rejectionHooks) snapshot() ([]*objects.Function, func(err error)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return append([]*objects.Function(nil), h.scripts...), h.host
+}
+
+// TrackRejection is called when a promise created by this evaluator is rejected without handlers.
+// The check is deferred to the event loop, so handlers attached later in the current task still count.
+func (e *Evaluator) TrackRejection(p *objects.Promise) {
+	e.rejectionsMu.Lock()
+	e.pendingRejections = append(e.pendingRejections, p)
+	e.rejectionsMu.Unlock()
+
+	if e.eventLoop != nil {
+		e.eventLoop.Enqueue(e.checkRejections)
+	}
+}
+
+// checkRejections reports the pending rejections which still have no handlers
+func (e *Evaluator) checkRejections() {
+	e.rejectionsMu.Lock()
+	pending := e.pendingRejections
+	e.pendingRejections = nil
+	e.rejectionsMu.Unlock()
+
+	for _, p := range pending {
+		// cancellation is requested on purpose, so it isn't worth reporting
+		if p.Handled() || runtime.IsCancelled(p.Err()) {
+			continue
+		}
+
+		e.reportUnhandled(p.Err())
+	}
+}
+
+// reportUnhandled passes the rejection to the script hooks, the host callback,
+// or keeps it to be returned from Run if there are neither
+func (e *Evaluator) reportUnhandled(err error) {
+	scripts, host := e.rejections.snapshot()
+
+	if len(scripts) > 0 {
+		for _, fn := range scripts {
+			_, hookErr := fn.Call(e.ctx, []runtime.Object{objects.ErrorFrom(err)})
+			if hookErr != nil {
+				e.addUnhandled(fmt.Errorf("on_unhandled hook failed: %w", hookErr))
+			}
+		}
+		return
+	}
+
+	if host != nil {
+		host(err)
+		return
+	}
+
+	e.addUnhandled(err)
+}
+
+func (e *Evaluator) addUnhandled(err error) {
+	e.rejectionsMu.Lock()
+	defer e.rejectionsMu.Unlock()
+
+	e.unhandled = append(e.unhandled, err)
+}
+
+// loopError reports the panics recovered by the event loop and the unhandled rejections, if any
+func (e *Evaluator) loopError() error {
+	e.checkRejections()
+
+	var messages []string
+
+	for _, p := range e.eventLoop.Panics() {
+		messages = append(messages, fmt.Sprintf("Event loop panic in %s: %v", p.Source, p.Value))
+	}
+
+	e.rejectionsMu.Lock()
+	for _, err := range e.unhandled {
+		messages = append(messages, "Unhandled promise rejection: "+err.Error())
+	}
+	e.rejectionsMu.Unlock()
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	return runtime.NewPanic(strings.Join(messages, "\n"), 0, 0)
+}
@@ -0,0 +1,552 @@
+package eval
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math"
+	"refl/ast"
+	"refl/runtime"
+	"refl/runtime/eventloop"
+	"refl/runtime/objects"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// snapshotVersion is increased whenever the snapshot format changes incompatibly
+const snapshotVersion = 2
+
+// snapshot is the serialised interpreter state. Environments, objects and functions are
+// stored in tables and referenced by index, so shared references and cycles survive.
+type snapshot struct {
+	Version int `json:"version"`
+	// Program is the hash of the program the snapshot was taken of, see programHash
+	Program string `json:"program"`
+
+	Envs      []snapshotEnv      `json:"envs"`
+	Objects   []snapshotObject   `json:"objects"`
+	Functions []snapshotFunction `json:"functions"`
+	Handlers  []snapshotHandler  `json:"handlers"`
+	Timers    []snapshotTimer    `json:"timers"`
+
+	// Dropped lists the values which cannot be persisted, such as native functions or promises,
+	// they are restored as nil
+	Dropped []string `json:"dropped,omitempty"`
+}
+
+// snapshotEnv is an environment, the first one is the global environment
+type snapshotEnv struct {
+	Parent int                      `json:"parent"`
+	Vars   map[string]snapshotValue `json:"vars"`
+}
+
+type snapshotObject struct {
+	Shared  bool            `json:"shared,omitempty"`
+	Entries []snapshotEntry `json:"entries"`
+}
+
+type snapshotEntry struct {
+	Key   snapshotValue `json:"key"`
+	Value snapshotValue `json:"value"`
+}
+
+// snapshotFunction is a closure, its function literal is identified by the position of its body
+type snapshotFunction struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+	Env    int `json:"env"`
+}
+
+type snapshotHandler struct {
+	Event    string        `json:"event"`
+	Priority int           `json:"priority,omitempty"`
+	Once     bool          `json:"once,omitempty"`
+	Function snapshotValue `json:"function"`
+}
+
+type snapshotTimer struct {
+	Kind string `json:"kind"`
+	// At is the unix time in milliseconds of the next run
+	At int64 `json:"at"`
+	// Interval is the period of recurring timers in milliseconds
+	Interval int64           `json:"interval,omitempty"`
+	Function snapshotValue   `json:"function"`
+	Args     []snapshotValue `json:"args,omitempty"`
+}
+
+// snapshotValue is a value, objects and functions refer to the tables by index
+// and builtins refer to the globals of the restoring evaluator by name
+type snapshotValue struct {
+	Kind      string  `json:"kind"`
+	Number    float64 `json:"number,omitempty"`
+	String    string  `json:"string,omitempty"`
+	Ref       int     `json:"ref,omitempty"`
+	Cancelled bool    `json:"cancelled,omitempty"`
+}
+
+// Snapshot serialises the global environment along with everything reachable from it,
+// the registered event handlers and the pending timers into a versioned JSON document.
+// If the event loop is running, the snapshot is taken between its tasks.
+// Coroutines are not persisted and should not be running while the snapshot is taken.
+func (e *Evaluator) Snapshot() ([]byte, error) {
+	var data []byte
+	var err error
+
+	e.onLoop(func() {
+		data, err = e.snapshot()
+	})
+
+	return data, err
+}
+
+// onLoop runs fn as a task of the event loop if it is running, or right away otherwise
+func (e *Evaluator) onLoop(fn func()) {
+	if e.eventLoop == nil || !e.eventLoop.IsRunning() {
+		fn()
+		return
+	}
+
+	var once sync.Once
+	done := make(chan struct{})
+	e.eventLoop.Enqueue(func() {
+		once.Do(fn)
+		close(done)
+	})
+
+	// the loop may finish before it takes the task
+	finished := make(chan struct{})
+	go func() {
+		e.eventLoop.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-done:
+	case <-finished:
+		once.Do(fn)
+	case <-e.ctx.Done():
+		once.Do(fn)
+	}
+}
+
+func (e *Evaluator) snapshot() ([]byte, error) {
+	enc := &snapshotEncoder{
+		evaluator: e,
+		data:      &snapshot{Version: snapshotVersion, Program: programHash(e.program)},
+		envs:      make(map[*runtime.Environment]int),
+		objects:   make(map[*objects.ReflObject]int),
+		functions: make(map[*objects.Function]int),
+		literals:  functionLiterals(e.program),
+	}
+
+	enc.env(e.env, "")
+
+	if e.eventLoop != nil {
+		for _, h := range e.eventLoop.Handlers() {
+			meta, ok := h.Meta.(*scriptHandler)
+			if !ok {
+				enc.drop(fmt.Sprintf("handler of %q", h.Event))
+				continue
+			}
+
+			enc.data.Handlers = append(enc.data.Handlers, snapshotHandler{
+				Event:    h.Event,
+				Priority: h.Priority,
+				Once:     h.Once,
+				Function: enc.value(meta.fn, fmt.Sprintf("handler of %q", h.Event)),
+			})
+		}
+
+		for _, task := range e.eventLoop.Tasks() {
+			meta, ok := task.Meta.(*scriptTimer)
+			if !ok {
+				enc.drop("pending task")
+				continue
+			}
+
+			path := meta.kind + " timer"
+			timer := snapshotTimer{
+				Kind:     meta.kind,
+				At:       task.ExecuteAt.UnixMilli(),
+				Interval: task.Interval.Milliseconds(),
+				Function: enc.value(meta.fn, path),
+			}
+			for i, arg := range meta.args {
+				timer.Args = append(timer.Args, enc.value(arg, fmt.Sprintf("%s argument %d", path, i)))
+			}
+
+			enc.data.Timers = append(enc.data.Timers, timer)
+		}
+	}
+
+	return json.Marshal(enc.data)
+}
+
+type snapshotEncoder struct {
+	evaluator *Evaluator
+	data      *snapshot
+	envs      map[*runtime.Environment]int
+	objects   map[*objects.ReflObject]int
+	functions map[*objects.Function]int
+	literals  map[ast.Position]*ast.FunctionLiteral
+}
+
+func (s *snapshotEncoder) drop(path string) {
+	s.data.Dropped = append(s.data.Dropped, path)
+}
+
+func (s *snapshotEncoder) env(env *runtime.Environment, path string) int {
+	if env == nil {
+		return -1
+	}
+
+	if idx, ok := s.envs[env]; ok {
+		return idx
+	}
+
+	parent := s.env(env.Parent(), path)
+
+	idx := len(s.data.Envs)
+	s.envs[env] = idx
+
+	vars := make(map[string]snapshotValue)
+	s.data.Envs = append(s.data.Envs, snapshotEnv{Parent: parent, Vars: vars})
+
+	for name, value := range env.Locals() {
+		// builtins and host globals are defined by the restoring evaluator itself
+		if builtin, ok := s.evaluator.builtins[value]; ok && builtin == name && env == s.evaluator.env {
+			continue
+		}
+
+		vars[name] = s.value(value, path+name)
+	}
+
+	return idx
+}
+
+func (s *snapshotEncoder) value(obj runtime.Object, path string) snapshotValue {
+	if obj == nil || obj == objects.NilInstance {
+		return snapshotValue{Kind: "nil"}
+	}
+
+	if name, ok := s.evaluator.builtins[obj]; ok {
+		return snapshotValue{Kind: "builtin", String: name}
+	}
+
+	switch v := obj.(type) {
+	case *objects.Number:
+		if math.IsNaN(v.Value) || math.IsInf(v.Value, 0) {
+			return snapshotValue{Kind: "number", String: strconv.FormatFloat(v.Value, 'g', -1, 64)}
+		}
+		return snapshotValue{Kind: "number", Number: v.Value}
+
+	case *objects.String:
+		return snapshotValue{Kind: "string", String: v.Value}
+
+	case *objects.UserError:
+		return snapshotValue{Kind: "error", String: v.String(), Cancelled: v.Cancelled()}
+
+	case *objects.ReflObject:
+		if idx, ok := s.objects[v]; ok {
+			return snapshotValue{Kind: "object", Ref: idx}
+		}
+
+		idx := len(s.data.Objects)
+		s.objects[v] = idx
+		s.data.Objects = append(s.data.Objects, snapshotObject{Shared: v.Shared()})
+
+		var entries []snapshotEntry
+		for key, value := range v.Iterator() {
+			entries = append(entries, snapshotEntry{
+				Key:   s.value(key, path+"[key]"),
+				Value: s.value(value, path+"["+key.String()+"]"),
+			})
+		}
+		s.data.Objects[idx].Entries = entries
+
+		return snapshotValue{Kind: "object", Ref: idx}
+
+	case *objects.Function:
+		if idx, ok := s.functions[v]; ok {
+			return snapshotValue{Kind: "function", Ref: idx}
+		}
+
+		// functions created by eval() don't belong to the program
+		literal, ok := s.literals[v.Body.Pos]
+		if !ok || literal.Body != v.Body {
+			s.drop(path)
+			return snapshotValue{Kind: "nil"}
+		}
+
+		idx := len(s.data.Functions)
+		s.functions[v] = idx
+		s.data.Functions = append(s.data.Functions, snapshotFunction{Line: v.Body.Pos.Line, Column: v.Body.Pos.Column})
+		s.data.Functions[idx].Env = s.env(v.Env, path+".")
+
+		return snapshotValue{Kind: "function", Ref: idx}
+	}
+
+	s.drop(path)
+
+	return snapshotValue{Kind: "nil"}
+}
+
+// Restore creates an evaluator from a snapshot taken by Evaluator.Snapshot of the same program.
+// The env and options are used like in New. Run on the restored evaluator doesn't run the program
+// again, it continues handling the restored event handlers and timers.
+func Restore(ctx context.Context, program *ast.Program, env *runtime.Environment, data []byte, opts ...Option) (*Evaluator, error) {
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return nil, runtime.NewPanic("invalid snapshot: "+err.Error(), 0, 0)
+	}
+
+	if snap.Version != snapshotVersion {
+		return nil, runtime.NewPanic(fmt.Sprintf("unsupported snapshot version %d", snap.Version), 0, 0)
+	}
+
+	if snap.Program != programHash(program) {
+		return nil, runtime.NewPanic("snapshot does not match the program, it was taken of a different version of the script", 0, 0)
+	}
+
+	if len(snap.Envs) == 0 {
+		return nil, runtime.NewPanic("invalid snapshot: no global environment", 0, 0)
+	}
+
+	evaluator := New(ctx, program, env, opts...)
+
+	if evaluator.eventLoop == nil && (len(snap.Handlers) > 0 || len(snap.Timers) > 0) {
+		evaluator.cancel()
+		return nil, runtime.NewPanic("cannot restore handlers and timers with events disabled", 0, 0)
+	}
+
+	dec := &snapshotDecoder{
+		evaluator: evaluator,
+		snap:      &snap,
+		envs:      make([]*runtime.Environment, len(snap.Envs)),
+		objects:   make([]*objects.ReflObject, len(snap.Objects)),
+		functions: make([]*objects.Function, len(snap.Functions)),
+	}
+
+	if err := dec.decode(functionLiterals(program)); err != nil {
+		evaluator.cancel()
+		return nil, err
+	}
+
+	evaluator.restored = true
+
+	return evaluator, nil
+}
+
+type snapshotDecoder struct {
+	evaluator *Evaluator
+	snap      *snapshot
+	envs      []*runtime.Environment
+	objects   []*objects.ReflObject
+	functions []*objects.Function
+}
+
+func (d *snapshotDecoder) decode(literals map[ast.Position]*ast.FunctionLiteral) error {
+	// tables are created first, so values can refer to any of them
+	for i, snapEnv := range d.snap.Envs {
+		switch {
+		case i == 0:
+			d.envs[i] = d.evaluator.env
+		case snapEnv.Parent < 0:
+			d.envs[i] = runtime.NewEnvironment(nil)
+		case snapEnv.Parent < i:
+			d.envs[i] = runtime.NewEnvironment(d.envs[snapEnv.Parent])
+		default:
+			return runtime.NewPanic("invalid snapshot: environment defined before its parent", 0, 0)
+		}
+	}
+
+	for i, snapObj := range d.snap.Objects {
+		if snapObj.Shared {
+			d.objects[i] = objects.NewSharedObject()
+		} else {
+			d.objects[i] = objects.NewObject()
+		}
+	}
+
+	for i, snapFn := range d.snap.Functions {
+		literal, ok := literals[ast.Position{Line: snapFn.Line, Column: snapFn.Column}]
+		if !ok {
+			return runtime.NewPanic(fmt.Sprintf("snapshot does not match the program: no function at line %d, column %d", snapFn.Line, snapFn.Column), 0, 0)
+		}
+
+		env, err := d.env(snapFn.Env)
+		if err != nil {
+			return err
+		}
+
+		fn := objects.NewFunction(literal.Parameters, literal.Body, nil)
+		fn.Defaults = literal.Defaults
+		fn.Rest = literal.Rest
+		fn.Env = env
+		d.functions[i] = fn
+	}
+
+	for i, snapEnv := range d.snap.Envs {
+		for name, snapValue := range snapEnv.Vars {
+			value, err := d.value(snapValue)
+			if err != nil {
+				return err
+			}
+			d.envs[i].Define(name, value)
+		}
+	}
+
+	for i, snapObj := range d.snap.Objects {
+		for _, entry := range snapObj.Entries {
+			key, err := d.value(entry.Key)
+			if err != nil {
+				return err
+			}
+
+			value, err := d.value(entry.Value)
+			if err != nil {
+				return err
+			}
+
+			if err := d.objects[i].Set(key, value); err != nil {
+				return err
+			}
+		}
+	}
+
+	eventLoop := d.evaluator.eventLoop
+
+	for _, snapHandler := range d.snap.Handlers {
+		fn, err := d.function(snapHandler.Function)
+		if err != nil {
+			return err
+		}
+
+		registerScriptHandler(eventLoop, snapHandler.Event, fn, eventloop.HandlerOptions{
+			Priority: snapHandler.Priority,
+			Once:     snapHandler.Once,
+		})
+	}
+
+	// timers whose time has passed while the state was persisted run right away
+	for _, snapTimer := range d.snap.Timers {
+		fn, err := d.function(snapTimer.Function)
+		if err != nil {
+			return err
+		}
+
+		timer := &scriptTimer{kind: snapTimer.Kind, fn: fn, args: make([]runtime.Object, len(snapTimer.Args))}
+		for i, snapArg := range snapTimer.Args {
+			if timer.args[i], err = d.value(snapArg); err != nil {
+				return err
+			}
+		}
+
+		interval := time.Duration(snapTimer.Interval) * time.Millisecond
+		scheduleScriptTimer(d.evaluator.ctx, eventLoop, timer, time.UnixMilli(snapTimer.At), interval)
+	}
+
+	return nil
+}
+
+func (d *snapshotDecoder) env(idx int) (*runtime.Environment, error) {
+	if idx < 0 || idx >= len(d.envs) {
+		return nil, runtime.NewPanic(fmt.Sprintf("invalid snapshot: unknown environment %d", idx), 0, 0)
+	}
+
+	return d.envs[idx], nil
+}
+
+func (d *snapshotDecoder) function(value snapshotValue) (*objects.Function, error) {
+	obj, err := d.value(value)
+	if err != nil {
+		return nil, err
+	}
+
+	fn, ok := obj.(*objects.Function)
+	if !ok {
+		return nil, runtime.NewPanic("invalid snapshot: handler is not a function", 0, 0)
+	}
+
+	return fn, nil
+}
+
+func (d *snapshotDecoder) value(value snapshotValue) (runtime.Object, error) {
+	switch value.Kind {
+	case "nil":
+		return objects.NilInstance, nil
+
+	case "number":
+		if value.String != "" {
+			num, err := strconv.ParseFloat(value.String, 64)
+			if err != nil {
+				return nil, runtime.NewPanic("invalid snapshot: "+err.Error(), 0, 0)
+			}
+			return objects.NewNumber(num), nil
+		}
+		return objects.NewNumber(value.Number), nil
+
+	case "string":
+		return objects.NewString(value.String), nil
+
+	case "error":
+		if value.Cancelled {
+			return objects.ErrorFrom(&runtime.Cancelled{Cause: context.Canceled}), nil
+		}
+		return objects.NewError(value.String), nil
+
+	case "builtin":
+		builtin, ok := d.evaluator.env.Get(value.String)
+		if !ok {
+			return nil, runtime.NewPanic(fmt.Sprintf("cannot restore snapshot: global %q is not defined", value.String), 0, 0)
+		}
+		return builtin, nil
+
+	case "object":
+		if value.Ref < 0 || value.Ref >= len(d.objects) {
+			return nil, runtime.NewPanic(fmt.Sprintf("invalid snapshot: unknown object %d", value.Ref), 0, 0)
+		}
+		return d.objects[value.Ref], nil
+
+	case "function":
+		if value.Ref < 0 || value.Ref >= len(d.functions) {
+			return nil, runtime.NewPanic(fmt.Sprintf("invalid snapshot: unknown function %d", value.Ref), 0, 0)
+		}
+		return d.functions[value.Ref], nil
+	}
+
+	return nil, runtime.NewPanic(fmt.Sprintf("invalid snapshot: unknown value kind %q", value.Kind), 0, 0)
+}
+
+// functionLiterals indexes the function literals of the program by the position of their body
+func functionLiterals(program *ast.Program) map[ast.Position]*ast.FunctionLiteral {
+	literals := make(map[ast.Position]*ast.FunctionLiteral)
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if fl, ok := node.(*ast.FunctionLiteral); ok {
+			literals[fl.Body.Pos] = fl
+		}
+		return true
+	})
+
+	return literals
+}
+
+// programHash identifies the program a snapshot belongs to. Closures are restored by the
+// position of their function literal, so the positions are hashed along with the code.
+func programHash(program *ast.Program) string {
+	h := sha256.New()
+	h.Write([]byte(program.String()))
+
+	ast.Inspect(program, func(node ast.Node) bool {
+		if fl, ok := node.(*ast.FunctionLiteral); ok {
+			fmt.Fprintf(h, "\n%d:%d", fl.Body.Pos.Line, fl.Body.Pos.Column)
+		}
+		return true
+	})
+
+	return hex.EncodeToString(h.Sum(nil))
+}
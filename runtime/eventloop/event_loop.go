@@ -3,7 +3,12 @@ package eventloop
 import (
 	"container/heap"
 	"context"
+	"errors"
+	"fmt"
 	"refl/runtime"
+	"refl/runtime/clock"
+	"sort"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -13,25 +18,94 @@ import (
 
 type Task func()
 
-type EventCallback func(ctx context.Context, event string, args []runtime.Object)
+// Event is a fired event along with its payload
+type Event struct {
+	Name string
+	Args []runtime.Object
+}
+
+// EventCallback handles a fired event, its result is collected by FireSync
+type EventCallback func(ctx context.Context, evt Event) (runtime.Object, error)
 
 type EventHandler struct {
 	ID       uuid.UUID
 	Callback EventCallback
+	// Priority orders the handlers of an event, higher priorities are called first
+	Priority int
+	// Once handlers are unregistered right before their first call
+	Once bool
+	// Meta is opaque data describing the handler, such as the script function it calls
+	Meta any
+
+	seq uint64
+}
+
+// HandlerOptions configure a handler registered with RegisterHandler
+type HandlerOptions struct {
+	Priority int
+	Once     bool
+	Meta     any
+}
+
+// TaskOptions configure a delayed task scheduled with ScheduleWithOptions
+type TaskOptions struct {
+	// Interval makes the task recurring, see ScheduleInterval
+	Interval time.Duration
+	// Meta is opaque data describing the task, it is returned by Tasks
+	Meta any
+}
+
+// HandlerInfo describes a registered event handler
+type HandlerInfo struct {
+	Event    string
+	Priority int
+	Once     bool
+	Meta     any
+
+	seq uint64
+}
+
+// TaskInfo describes a pending delayed task
+type TaskInfo struct {
+	ExecuteAt time.Time
+	Interval  time.Duration
+	Meta      any
 }
 
 var noop = func() {}
 
+// ErrStopped is returned for events fired after the loop has stopped
+var ErrStopped = errors.New("event loop is stopped")
+
+// lockEventPrefix marks the internal events registered by RegisterLock
+const lockEventPrefix = "__lock__"
+
+// TaskPanic is a panic recovered from a task, along with where the task came from
+type TaskPanic struct {
+	Source string
+	Value  any
+}
+
+func (p TaskPanic) String() string {
+	return fmt.Sprintf("%s: %v", p.Source, p.Value)
+}
+
 type immediateTask struct {
 	cancelled *atomic.Bool
 	task      Task
+	source    string
 }
 
 type delayedTask struct {
 	cancelled *atomic.Bool
 	task      Task
+	source    string
 	executeAt time.Time
 	index     int
+	meta      any
+
+	// interval is set for recurring tasks, which are rescheduled after every run
+	interval time.Duration
 }
 
 type delayedTaskHeap struct {
@@ -73,6 +147,7 @@ func (h *delayedTaskHeap) Pop() any {
 type EventLoop struct {
 	ctx    context.Context
 	cancel context.CancelFunc
+	clock  clock.Clock
 
 	immediateTaskChan chan immediateTask
 	delayedTasks      *delayedTaskHeap
@@ -80,7 +155,9 @@ type EventLoop struct {
 
 	triggerChan chan struct{}
 
+	// handlers are keyed by the registered event name, which may be a wildcard pattern
 	handlers   map[string][]EventHandler
+	handlerSeq uint64
 	handlersMu sync.Mutex
 
 	wg sync.WaitGroup
@@ -88,18 +165,31 @@ type EventLoop struct {
 	loopRunning bool
 	loopMu      sync.Mutex
 
+	// watchOnce starts the goroutine stopping the loop when the context ends,
+	// the loop may be started many times but needs only one
+	watchOnce sync.Once
+
 	stopped bool
 	stopMu  sync.Mutex
 
-	lastPanic any
-	panicMu   sync.Mutex
+	// draining is set by Shutdown, no new handlers or delayed tasks are accepted afterwards
+	draining atomic.Bool
+
+	panics  []TaskPanic
+	panicMu sync.Mutex
 }
 
 func New(ctx context.Context) *EventLoop {
+	return NewWithClock(ctx, clock.Real())
+}
+
+// NewWithClock creates an event loop which schedules delayed tasks using the given clock
+func NewWithClock(ctx context.Context, clk clock.Clock) *EventLoop {
 	ctx, cancel := context.WithCancel(ctx)
 	return &EventLoop{
 		ctx:               ctx,
 		cancel:            cancel,
+		clock:             clk,
 		immediateTaskChan: make(chan immediateTask, 32),
 		delayedTasks:      &delayedTaskHeap{},
 		triggerChan:       make(chan struct{}, 1),
@@ -108,20 +198,31 @@ func New(ctx context.Context) *EventLoop {
 }
 
 func (e *EventLoop) RegisterCallback(event string, callback EventCallback) func() {
+	return e.RegisterHandler(event, callback, HandlerOptions{})
+}
+
+// RegisterHandler registers a callback for an event name or a wildcard pattern such as "order.*"
+func (e *EventLoop) RegisterHandler(event string, callback EventCallback, opts HandlerOptions) func() {
+	if e.draining.Load() {
+		return noop
+	}
+
 	e.handlersMu.Lock()
 	defer e.handlersMu.Unlock()
 
 	handlerID := uuid.New()
+	e.handlerSeq++
 
 	e.handlers[event] = append(e.handlers[event], EventHandler{
 		ID:       handlerID,
 		Callback: callback,
+		Priority: opts.Priority,
+		Once:     opts.Once,
+		Meta:     opts.Meta,
+		seq:      e.handlerSeq,
 	})
 
-	select {
-	case e.triggerChan <- struct{}{}:
-	default:
-	}
+	e.trigger()
 
 	return func() {
 		e.unregisterHandler(event, handlerID)
@@ -133,53 +234,114 @@ func (e *EventLoop) RegisterLock() func() {
 	defer e.handlersMu.Unlock()
 
 	handlerID := uuid.New()
-	event := "__lock__" + handlerID.String()
+	event := lockEventPrefix + handlerID.String()
 
 	e.handlers[event] = append(e.handlers[event], EventHandler{
-		ID:       handlerID,
-		Callback: func(ctx context.Context, event string, args []runtime.Object) {},
+		ID: handlerID,
+		Callback: func(ctx context.Context, evt Event) (runtime.Object, error) {
+			return nil, nil
+		},
 	})
 
-	select {
-	case e.triggerChan <- struct{}{}:
-	default:
-	}
+	e.trigger()
 
 	return func() {
 		e.unregisterHandler(event, handlerID)
 	}
 }
 
+// Fire enqueues calling the handlers matching the event, a failing handler panics the task
 func (e *EventLoop) Fire(event string, args []runtime.Object) {
-	e.Enqueue(func() {
-		e.fireEvent(event, args)
-	})
+	e.enqueue(func() {
+		if _, err := e.fireEvent(event, args); err != nil {
+			panic("callback failed: " + err.Error())
+		}
+	}, fmt.Sprintf("event %q", event))
 }
 
-func (e *EventLoop) fireEvent(event string, args []runtime.Object) {
-	e.handlersMu.Lock()
-	defer e.handlersMu.Unlock()
+// FireSync enqueues calling the handlers matching the event and passes their results
+// in call order to done. Handlers after a failing one are not called, and its error
+// is passed instead. If the loop is already stopped or shutting down, done is called right away.
+func (e *EventLoop) FireSync(event string, args []runtime.Object, done func(results []runtime.Object, err error)) {
+	e.stopMu.Lock()
+	stopped := e.stopped
+	e.stopMu.Unlock()
 
-	handlers := e.handlers[event]
+	if stopped || e.draining.Load() || e.ctx.Err() != nil {
+		done(nil, ErrStopped)
+		return
+	}
+
+	e.enqueue(func() {
+		done(e.fireEvent(event, args))
+	}, fmt.Sprintf("event %q", event))
+}
+
+// fireEvent calls the handlers matching the event ordered by priority, then by registration
+func (e *EventLoop) fireEvent(event string, args []runtime.Object) ([]runtime.Object, error) {
+	handlers := e.matchHandlers(event)
+
+	// handlers are called without the lock held, so they can unregister themselves
+	evt := Event{Name: event, Args: args}
+	results := make([]runtime.Object, 0, len(handlers))
 	for _, h := range handlers {
-		h.Callback(e.ctx, event, args)
+		result, err := h.Callback(e.ctx, evt)
+		if err != nil {
+			return results, err
+		}
+
+		results = append(results, result)
 	}
+
+	return results, nil
 }
 
-func (e *EventLoop) unregisterHandler(event string, handlerID uuid.UUID) {
+// matchHandlers collects the handlers matching the event and unregisters the once handlers among them
+func (e *EventLoop) matchHandlers(event string) []EventHandler {
 	e.handlersMu.Lock()
 	defer e.handlersMu.Unlock()
 
-	select {
-	case e.triggerChan <- struct{}{}:
-	default:
+	var handlers []EventHandler
+	for pattern, patternHandlers := range e.handlers {
+		if strings.HasPrefix(pattern, lockEventPrefix) || !matchEvent(pattern, event) {
+			continue
+		}
+
+		kept := patternHandlers[:0:0]
+		for _, h := range patternHandlers {
+			handlers = append(handlers, h)
+			if !h.Once {
+				kept = append(kept, h)
+			}
+		}
+
+		if len(kept) == 0 {
+			delete(e.handlers, pattern)
+		} else if len(kept) != len(patternHandlers) {
+			e.handlers[pattern] = kept
+		}
 	}
 
-	if len(e.handlers[event]) == 1 {
-		delete(e.handlers, event)
-		return
+	sort.Slice(handlers, func(i, j int) bool {
+		if handlers[i].Priority != handlers[j].Priority {
+			return handlers[i].Priority > handlers[j].Priority
+		}
+		return handlers[i].seq < handlers[j].seq
+	})
+
+	if len(handlers) > 0 {
+		e.trigger()
 	}
 
+	return handlers
+}
+
+func (e *EventLoop) unregisterHandler(event string, handlerID uuid.UUID) {
+	e.handlersMu.Lock()
+	defer e.handlersMu.Unlock()
+
+	e.trigger()
+
 	newHandlers := make([]EventHandler, 0, len(e.handlers[event]))
 	for _, h := range e.handlers[event] {
 		if h.ID == handlerID {
@@ -189,10 +351,20 @@ func (e *EventLoop) unregisterHandler(event string, handlerID uuid.UUID) {
 		newHandlers = append(newHandlers, h)
 	}
 
+	// the handler may be gone already, e.g. a once handler which was called
+	if len(newHandlers) == 0 {
+		delete(e.handlers, event)
+		return
+	}
+
 	e.handlers[event] = newHandlers
 }
 
 func (e *EventLoop) Enqueue(task Task) func() {
+	return e.enqueue(task, "task")
+}
+
+func (e *EventLoop) enqueue(task Task, source string) func() {
 	if task == nil {
 		panic("task cannot be nil")
 	}
@@ -207,6 +379,7 @@ func (e *EventLoop) Enqueue(task Task) func() {
 	imTask := immediateTask{
 		cancelled: new(atomic.Bool),
 		task:      task,
+		source:    source,
 	}
 	cancelFunc := func() {
 		imTask.cancelled.Store(true)
@@ -221,10 +394,50 @@ func (e *EventLoop) Enqueue(task Task) func() {
 }
 
 func (e *EventLoop) Schedule(task Task, atTime time.Time) func() {
+	return e.ScheduleWithOptions(task, atTime, TaskOptions{})
+}
+
+// ScheduleInterval runs the task at firstTime and then every interval until cancelled.
+// Runs are scheduled relative to the previous planned run, so slow tasks don't cause drift;
+// runs missed while the loop was busy are skipped.
+func (e *EventLoop) ScheduleInterval(task Task, firstTime time.Time, interval time.Duration) func() {
+	if interval <= 0 {
+		panic("interval must be positive")
+	}
+
+	return e.ScheduleWithOptions(task, firstTime, TaskOptions{Interval: interval})
+}
+
+// ScheduleWithOptions schedules a delayed task, which recurs if opts.Interval is set
+func (e *EventLoop) ScheduleWithOptions(task Task, atTime time.Time, opts TaskOptions) func() {
 	if task == nil {
 		panic("task cannot be nil")
 	}
 
+	if opts.Interval < 0 {
+		panic("interval must be positive")
+	}
+
+	source := "scheduled task"
+	if opts.Interval > 0 {
+		source = "interval"
+	}
+
+	return e.scheduleDelayed(&delayedTask{
+		cancelled: new(atomic.Bool),
+		task:      task,
+		source:    source,
+		executeAt: atTime,
+		interval:  opts.Interval,
+		meta:      opts.Meta,
+	})
+}
+
+func (e *EventLoop) scheduleDelayed(delTask *delayedTask) func() {
+	if e.draining.Load() {
+		return noop
+	}
+
 	e.stopMu.Lock()
 	if e.stopped {
 		e.stopMu.Unlock()
@@ -232,13 +445,17 @@ func (e *EventLoop) Schedule(task Task, atTime time.Time) func() {
 	}
 	e.stopMu.Unlock()
 
-	delTask := &delayedTask{
-		cancelled: new(atomic.Bool),
-		task:      task,
-		executeAt: atTime,
-	}
 	cancelFunc := func() {
 		delTask.cancelled.Store(true)
+
+		// remove the task from the heap right away, so it doesn't keep the loop alive
+		e.delayedTasksMu.Lock()
+		if delTask.index >= 0 && delTask.index < len(e.delayedTasks.heap) && e.delayedTasks.heap[delTask.index] == delTask {
+			heap.Remove(e.delayedTasks, delTask.index)
+		}
+		e.delayedTasksMu.Unlock()
+
+		e.trigger()
 	}
 
 	select {
@@ -249,15 +466,27 @@ func (e *EventLoop) Schedule(task Task, atTime time.Time) func() {
 		heap.Push(e.delayedTasks, delTask)
 		e.delayedTasksMu.Unlock()
 
-		select {
-		case e.triggerChan <- struct{}{}:
-		default:
-		}
+		e.trigger()
 
 		return cancelFunc
 	}
 }
 
+// trigger wakes up the loop to recheck its state
+func (e *EventLoop) trigger() {
+	e.stopMu.Lock()
+	defer e.stopMu.Unlock()
+
+	if e.stopped {
+		return
+	}
+
+	select {
+	case e.triggerChan <- struct{}{}:
+	default:
+	}
+}
+
 func (e *EventLoop) Start() {
 	e.loopMu.Lock()
 	if e.loopRunning {
@@ -267,12 +496,47 @@ func (e *EventLoop) Start() {
 	e.loopRunning = true
 	e.loopMu.Unlock()
 
-	go func() {
-		<-e.ctx.Done()
-		e.stop()
+	e.watchOnce.Do(func() {
+		go func() {
+			<-e.ctx.Done()
+			e.stop()
+		}()
+	})
+
+	e.wg.Go(func() {
+		e.runLoop(nil)
+
+		e.loopMu.Lock()
+		e.loopRunning = false
+		e.loopMu.Unlock()
+	})
+}
+
+// RunUntil processes tasks on the calling goroutine until done is closed or the
+// loop is stopped. Unlike Start, it does not return when there is nothing left to
+// do, since done may be closed from another goroutine. It returns false without
+// processing anything if the loop is already running.
+func (e *EventLoop) RunUntil(done <-chan struct{}) bool {
+	e.loopMu.Lock()
+	if e.loopRunning {
+		e.loopMu.Unlock()
+		return false
+	}
+	e.loopRunning = true
+	e.wg.Add(1)
+	e.loopMu.Unlock()
+
+	defer func() {
+		e.loopMu.Lock()
+		e.loopRunning = false
+		e.loopMu.Unlock()
+
+		e.wg.Done()
 	}()
 
-	e.wg.Go(e.runLoop)
+	e.runLoop(done)
+
+	return true
 }
 
 func (e *EventLoop) stop() {
@@ -295,8 +559,8 @@ func (e *EventLoop) stop() {
 	close(e.triggerChan)
 }
 
-func (e *EventLoop) runLoop() {
-	var timer *time.Timer
+func (e *EventLoop) runLoop(done <-chan struct{}) {
+	var timer clock.Timer
 	var timerC <-chan time.Time
 
 	defer func() {
@@ -313,12 +577,15 @@ outer:
 			e.drainTasks()
 			return
 
+		case <-done:
+			return
+
 		case imTask := <-e.immediateTaskChan:
 			if imTask.cancelled.Load() {
 				continue outer
 			}
 
-			if !e.executeTask(imTask.task) {
+			if !e.executeTask(imTask.task, imTask.source) {
 				return
 			}
 
@@ -342,14 +609,15 @@ outer:
 			handleCount := len(e.handlers)
 			e.handlersMu.Unlock()
 
-			// no scheduled or delayed tasks, no event handlers - nothing will ever happen again
-			if handleCount == 0 {
+			// no scheduled or delayed tasks, no event handlers - nothing will ever happen again,
+			// unless we are waiting for a signal from the outside
+			if handleCount == 0 && done == nil {
 				return
 			}
 		} else {
 			// at least 1 delayed task is pending
-			timer = time.NewTimer(nextDelay)
-			timerC = timer.C
+			timer = e.clock.NewTimer(nextDelay)
+			timerC = timer.C()
 		}
 
 		select {
@@ -357,12 +625,15 @@ outer:
 			e.drainTasks()
 			return
 
+		case <-done:
+			return
+
 		case imTask := <-e.immediateTaskChan:
 			if imTask.cancelled.Load() {
 				continue
 			}
 
-			if !e.executeTask(imTask.task) {
+			if !e.executeTask(imTask.task, imTask.source) {
 				return
 			}
 
@@ -385,7 +656,7 @@ func (e *EventLoop) getNextDelay() time.Duration {
 	}
 
 	next := e.delayedTasks.heap[0]
-	delay := time.Until(next.executeAt)
+	delay := next.executeAt.Sub(e.clock.Now())
 	if delay < 0 {
 		delay = 0
 	}
@@ -399,7 +670,7 @@ func (e *EventLoop) executeNextDelayedTask() bool {
 		return true
 	}
 
-	now := time.Now()
+	now := e.clock.Now()
 	if e.delayedTasks.heap[0].executeAt.After(now) {
 		e.delayedTasksMu.Unlock()
 		return true
@@ -412,16 +683,42 @@ func (e *EventLoop) executeNextDelayedTask() bool {
 		return true
 	}
 
-	return e.executeTask(task.task)
+	ok := e.executeTask(task.task, task.source)
+
+	if task.interval > 0 {
+		e.reschedule(task)
+	}
+
+	return ok
 }
 
-func (e *EventLoop) executeTask(task Task) (ok bool) {
+// reschedule pushes a recurring task back to the heap at its next planned run in the future
+func (e *EventLoop) reschedule(task *delayedTask) {
+	now := e.clock.Now()
+
+	next := task.executeAt.Add(task.interval)
+	if !next.After(now) {
+		missed := now.Sub(next)/task.interval + 1
+		next = next.Add(missed * task.interval)
+	}
+	task.executeAt = next
+
+	e.delayedTasksMu.Lock()
+	defer e.delayedTasksMu.Unlock()
+
+	// checked under the lock, so a concurrent cancel either sees the task in the heap or prevents the push
+	if task.cancelled.Load() || e.draining.Load() {
+		return
+	}
+
+	heap.Push(e.delayedTasks, task)
+}
+
+func (e *EventLoop) executeTask(task Task, source string) (ok bool) {
 	defer func() {
 		if r := recover(); r != nil {
 			e.panicMu.Lock()
-			if e.lastPanic == nil {
-				e.lastPanic = r
-			}
+			e.panics = append(e.panics, TaskPanic{Source: source, Value: r})
 			e.panicMu.Unlock()
 		}
 	}()
@@ -439,7 +736,7 @@ func (e *EventLoop) drainTasks() {
 				continue
 			}
 
-			if !e.executeTask(imTask.task) {
+			if !e.executeTask(imTask.task, imTask.source) {
 				return
 			}
 		default:
@@ -448,6 +745,147 @@ func (e *EventLoop) drainTasks() {
 	}
 }
 
+// Stats is a snapshot of the event loop state
+type Stats struct {
+	// Events maps registered event names to their handler counts
+	Events         map[string]int
+	ImmediateTasks int
+	DelayedTasks   int
+	// Locks is the number of RegisterLock holders keeping the loop alive, such as running coroutines
+	Locks int
+}
+
+// Stats returns a snapshot of the registered events and pending tasks
+func (e *EventLoop) Stats() Stats {
+	stats := Stats{
+		Events:         e.Events(),
+		ImmediateTasks: len(e.immediateTaskChan),
+	}
+
+	e.delayedTasksMu.Lock()
+	stats.DelayedTasks = len(e.delayedTasks.heap)
+	e.delayedTasksMu.Unlock()
+
+	e.handlersMu.Lock()
+	for event := range e.handlers {
+		if strings.HasPrefix(event, lockEventPrefix) {
+			stats.Locks++
+		}
+	}
+	e.handlersMu.Unlock()
+
+	return stats
+}
+
+// Events returns the registered events with their handler counts
+func (e *EventLoop) Events() map[string]int {
+	e.handlersMu.Lock()
+	defer e.handlersMu.Unlock()
+
+	result := make(map[string]int, len(e.handlers))
+	for event, handlers := range e.handlers {
+		if strings.HasPrefix(event, lockEventPrefix) {
+			continue
+		}
+		result[event] = len(handlers)
+	}
+
+	return result
+}
+
+// Shutdown stops the loop gracefully. Event handlers are unregistered, delayed tasks are dropped
+// and no new ones are accepted, while immediate tasks and lock holders such as running coroutines
+// are allowed to finish. If ctx is done before the loop exits, the loop is stopped right away
+// and the ctx error is returned.
+func (e *EventLoop) Shutdown(ctx context.Context) error {
+	e.draining.Store(true)
+
+	e.handlersMu.Lock()
+	for event := range e.handlers {
+		if !strings.HasPrefix(event, lockEventPrefix) {
+			delete(e.handlers, event)
+		}
+	}
+	e.handlersMu.Unlock()
+
+	e.delayedTasksMu.Lock()
+	for _, task := range e.delayedTasks.heap {
+		task.cancelled.Store(true)
+		task.index = -1
+	}
+	e.delayedTasks.heap = nil
+	e.delayedTasksMu.Unlock()
+
+	e.trigger()
+
+	done := make(chan struct{})
+	go func() {
+		e.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		e.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// Handlers returns the registered event handlers in registration order
+func (e *EventLoop) Handlers() []HandlerInfo {
+	e.handlersMu.Lock()
+	var handlers []EventHandler
+	var events []string
+	for event, eventHandlers := range e.handlers {
+		if strings.HasPrefix(event, lockEventPrefix) {
+			continue
+		}
+		for _, h := range eventHandlers {
+			handlers = append(handlers, h)
+			events = append(events, event)
+		}
+	}
+	e.handlersMu.Unlock()
+
+	result := make([]HandlerInfo, len(handlers))
+	for i, h := range handlers {
+		result[i] = HandlerInfo{Event: events[i], Priority: h.Priority, Once: h.Once, Meta: h.Meta, seq: h.seq}
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].seq < result[j].seq
+	})
+
+	return result
+}
+
+// Tasks returns the pending delayed tasks ordered by their execution time
+func (e *EventLoop) Tasks() []TaskInfo {
+	e.delayedTasksMu.Lock()
+	tasks := make([]TaskInfo, 0, len(e.delayedTasks.heap))
+	for _, task := range e.delayedTasks.heap {
+		if task.cancelled.Load() {
+			continue
+		}
+		tasks = append(tasks, TaskInfo{ExecuteAt: task.executeAt, Interval: task.interval, Meta: task.meta})
+	}
+	e.delayedTasksMu.Unlock()
+
+	sort.Slice(tasks, func(i, j int) bool {
+		return tasks[i].ExecuteAt.Before(tasks[j].ExecuteAt)
+	})
+
+	return tasks
+}
+
+// Clock returns the clock used for scheduling delayed tasks
+func (e *EventLoop) Clock() clock.Clock {
+	return e.clock
+}
+
 func (e *EventLoop) IsRunning() bool {
 	e.loopMu.Lock()
 	defer e.loopMu.Unlock()
@@ -458,9 +896,22 @@ func (e *EventLoop) Wait() {
 	e.wg.Wait()
 }
 
+// LastPanic returns the first panic recovered from a task, or nil
 func (e *EventLoop) LastPanic() any {
 	e.panicMu.Lock()
 	defer e.panicMu.Unlock()
 
-	return e.lastPanic
+	if len(e.panics) == 0 {
+		return nil
+	}
+
+	return e.panics[0].Value
+}
+
+// Panics returns all panics recovered from tasks in the order they happened
+func (e *EventLoop) Panics() []TaskPanic {
+	e.panicMu.Lock()
+	defer e.panicMu.Unlock()
+
+	return append([]TaskPanic(nil), e.panics...)
 }
@@ -0,0 +1,36 @@
+package eventloop
+
+import "strings"
+
+// isPattern reports whether the event name contains wildcards
+func isPattern(event string) bool {
+	return strings.Contains(event, "*")
+}
+
+// matchEvent matches a dot separated event name against a pattern,
+// "*" matches exactly one segment and "**" matches any number of trailing segments,
+// so "order.*" matches "order.created" and "order.**" matches "order.created.eu"
+func matchEvent(pattern, event string) bool {
+	if !isPattern(pattern) {
+		return pattern == event
+	}
+
+	patternParts := strings.Split(pattern, ".")
+	eventParts := strings.Split(event, ".")
+
+	for i, part := range patternParts {
+		if part == "**" && i == len(patternParts)-1 {
+			return len(eventParts) > i
+		}
+
+		if i >= len(eventParts) {
+			return false
+		}
+
+		if part != "*" && part != eventParts[i] {
+			return false
+		}
+	}
+
+	return len(patternParts) == len(eventParts)
+}
@@ -0,0 +1,211 @@
+package objects
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"refl/runtime"
+	"sync"
+)
+
+// Channel passes values between coroutines. Values are cloned on send,
+// the channel itself is shared by reference.
+type Channel struct {
+	id string
+
+	values chan runtime.Object
+	closed chan struct{}
+
+	// mu is held for reading by sends in flight, Close takes it for writing
+	// so no send can enqueue a value once it returns
+	mu        sync.RWMutex
+	closeOnce sync.Once
+}
+
+func NewChannel(size int) *Channel {
+	result := &Channel{
+		values: make(chan runtime.Object, size),
+		closed: make(chan struct{}),
+	}
+
+	result.id = fmt.Sprintf("%p", result)
+
+	return result
+}
+
+func (c *Channel) Type() runtime.ObjectType { return runtime.ObjectType_ }
+func (c *Channel) String() string {
+	return fmt.Sprintf("Channel<%d/%d>", len(c.values), cap(c.values))
+}
+func (c *Channel) Truthy() bool { return true }
+func (c *Channel) Equal(other runtime.Object) bool {
+	return c == other
+}
+func (c *Channel) Clone() runtime.Object { return c }
+
+func (c *Channel) Get(key runtime.Object) (runtime.Object, error) {
+	keyStr := key.String()
+
+	switch keyStr {
+	case "send":
+		return NewWrapperFunction(func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+			if len(args) != 1 {
+				return nil, runtime.NewPanic("send() expects exactly 1 argument", 0, 0)
+			}
+
+			if err := c.Send(ctx, args[0]); err != nil {
+				return nil, err
+			}
+
+			return NilInstance, nil
+		}), nil
+
+	case "recv":
+		return NewWrapperFunction(func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+			if len(args) != 0 {
+				return nil, runtime.NewPanic("recv() expects no arguments", 0, 0)
+			}
+
+			value, _, err := c.Recv(ctx)
+			if err != nil {
+				return nil, err
+			}
+
+			return value, nil
+		}), nil
+
+	case "try_recv":
+		return NewWrapperFunction(func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+			if len(args) != 0 {
+				return nil, runtime.NewPanic("try_recv() expects no arguments", 0, 0)
+			}
+
+			value, ok := c.TryRecv()
+
+			result := NewObject()
+			result.SetLiteral("ok", NewBoolean(ok))
+			result.SetLiteral("value", value)
+
+			return result, nil
+		}), nil
+
+	case "close":
+		return NewWrapperFunction(func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+			if !c.Close() {
+				return nil, runtime.NewPanic("close of closed channel", 0, 0)
+			}
+
+			return NilInstance, nil
+		}), nil
+	}
+
+	return nil, nil
+}
+
+// Send blocks until the value is sent, the channel is closed or the context is cancelled
+func (c *Channel) Send(ctx context.Context, value runtime.Object) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	select {
+	case <-c.closed:
+		return runtime.NewPanic("send on closed channel", 0, 0)
+	default:
+	}
+
+	select {
+	case c.values <- value.Clone():
+		return nil
+	case <-c.closed:
+		return runtime.NewPanic("send on closed channel", 0, 0)
+	case <-ctx.Done():
+		return runtime.NewCancelled(ctx)
+	}
+}
+
+// Recv blocks until a value is received or the context is cancelled.
+// Once the channel is closed and drained it returns nil and false.
+func (c *Channel) Recv(ctx context.Context) (runtime.Object, bool, error) {
+	select {
+	case value := <-c.values:
+		return value, true, nil
+	case <-c.closed:
+		value, ok := c.TryRecv()
+		return value, ok, nil
+	case <-ctx.Done():
+		return nil, false, runtime.NewCancelled(ctx)
+	}
+}
+
+// TryRecv receives a value if one is ready without blocking
+func (c *Channel) TryRecv() (runtime.Object, bool) {
+	select {
+	case value := <-c.values:
+		return value, true
+	default:
+		return NilInstance, false
+	}
+}
+
+// Close closes the channel, returning false if it was already closed
+func (c *Channel) Close() bool {
+	closed := false
+	c.closeOnce.Do(func() {
+		// wakes the blocked sends, then waits for them to return
+		close(c.closed)
+		c.mu.Lock()
+		c.mu.Unlock()
+		closed = true
+	})
+
+	return closed
+}
+
+// Values returns the underlying go channel of values
+func (c *Channel) Values() <-chan runtime.Object {
+	return c.values
+}
+
+// Closed returns a channel that is closed once the channel is closed
+func (c *Channel) Closed() <-chan struct{} {
+	return c.closed
+}
+
+func (c *Channel) Iterator() iter.Seq2[runtime.Object, runtime.Object] {
+	return c.IteratorContext(context.Background())
+}
+
+// IteratorContext yields received values until the channel is closed and drained
+// or the context is cancelled
+func (c *Channel) IteratorContext(ctx context.Context) iter.Seq2[runtime.Object, runtime.Object] {
+	return func(yield func(runtime.Object, runtime.Object) bool) {
+		i := 0.0
+
+		for {
+			value, ok, err := c.Recv(ctx)
+			if err != nil || !ok {
+				return
+			}
+
+			if !yield(NewNumber(i), value) {
+				return
+			}
+
+			i++
+		}
+	}
+}
+
+func (c *Channel) Set(_, _ runtime.Object) error {
+	return runtime.NewPanic("cannot modify Channel object", 0, 0)
+}
+
+func (c *Channel) Length() int { return len(c.values) }
+
+func (c *Channel) HashKey() runtime.HashKey {
+	return runtime.HashKey("chan_" + c.id)
+}
+
+func (c *Channel) Not() runtime.Object {
+	return NewBoolean(!c.Truthy())
+}
@@ -10,6 +10,7 @@ import (
 type Evaluator interface {
 	Context() context.Context
 	EvalBlock(block *ast.BlockStatement, env *runtime.Environment) (runtime.Object, error)
+	EvalExpression(expr ast.Expression, env *runtime.Environment) (runtime.Object, error)
 	FireEvent(event string, args []runtime.Object)
 	EnqueueTask(task eventloop.Task)
 }
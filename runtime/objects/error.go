@@ -6,8 +6,9 @@ import (
 )
 
 type UserError struct {
-	ID   string
-	text string
+	ID        string
+	text      string
+	cancelled bool
 }
 
 func NewError(text string) *UserError {
@@ -17,13 +18,31 @@ func NewError(text string) *UserError {
 	return result
 }
 
+// ErrorFrom converts a go error into an error object, keeping whether it is a cancellation
+func ErrorFrom(err error) *UserError {
+	result := NewError(err.Error())
+	result.cancelled = runtime.IsCancelled(err)
+
+	return result
+}
+
+// Cancelled reports whether the error was caused by a context cancellation
+func (e *UserError) Cancelled() bool {
+	return e.cancelled
+}
+
 func (e *UserError) Type() runtime.ObjectType { return runtime.ErrorType }
 func (e *UserError) String() string           { return e.text }
 func (e *UserError) Truthy() bool             { return false }
 func (e *UserError) Equal(other runtime.Object) bool {
 	return e == other
 }
-func (e *UserError) Clone() runtime.Object { return NewError(e.text) }
+func (e *UserError) Clone() runtime.Object {
+	result := NewError(e.text)
+	result.cancelled = e.cancelled
+
+	return result
+}
 
 func (e *UserError) Add(other runtime.Object) (runtime.Object, error) {
 	return nil, runtime.NewPanic("errors do not support addition", 0, 0)
@@ -3,15 +3,21 @@ package objects
 import (
 	"context"
 	"fmt"
+	"maps"
 	"refl/ast"
 	"refl/runtime"
+	"slices"
 )
 
 type Function struct {
 	ID         string
 	Parameters []string
-	Body       *ast.BlockStatement
-	Env        *runtime.Environment
+	// Defaults are evaluated when calling the function, in its scope, for missing or nil arguments
+	Defaults map[string]ast.Expression
+	// Rest is the name of the parameter collecting the extra arguments as an array
+	Rest string
+	Body *ast.BlockStatement
+	Env  *runtime.Environment
 }
 
 func NewFunction(
@@ -40,19 +46,51 @@ func (f *Function) Equal(other runtime.Object) bool {
 func (f *Function) Clone() runtime.Object { return f }
 
 func (f *Function) Call(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
+	return f.CallKeywords(ctx, args, nil)
+}
+
+// CallKeywords calls the function with positional arguments followed by arguments matched by parameter name
+func (f *Function) CallKeywords(ctx context.Context, args []runtime.Object, keywords map[string]runtime.Object) (runtime.Object, error) {
 	evaluator, ok := ctx.Value("evaluator").(Evaluator)
 	if !ok {
 		return nil, runtime.NewPanic("evaluator not found in context", 0, 0)
 	}
 
+	if msg := f.KeywordError(len(args), keywords); msg != "" {
+		return nil, runtime.NewPanic(msg, 0, 0)
+	}
+
+	values := make([]runtime.Object, len(f.Parameters))
+	copy(values, args)
+	for i, param := range f.Parameters {
+		if value, ok := keywords[param]; ok {
+			values[i] = value
+		}
+	}
+
 	funcEnv := runtime.NewEnvironment(f.Env)
 
 	for i, param := range f.Parameters {
-		if i < len(args) {
-			funcEnv.Define(param, args[i])
-		} else {
-			funcEnv.Define(param, NilInstance)
+		value := values[i]
+		if _, isNil := value.(*Nil); isNil || value == nil {
+			value = NilInstance
+			if def, ok := f.Defaults[param]; ok {
+				val, err := evaluator.EvalExpression(def, funcEnv)
+				if err != nil {
+					return nil, err
+				}
+				value = val
+			}
 		}
+		funcEnv.Define(param, value)
+	}
+
+	if f.Rest != "" {
+		rest := NewObject()
+		for i := len(f.Parameters); i < len(args); i++ {
+			_ = rest.Set(NewNumber(float64(i-len(f.Parameters))), args[i])
+		}
+		funcEnv.Define(f.Rest, rest)
 	}
 
 	argsObj := NewObject()
@@ -64,6 +102,25 @@ func (f *Function) Call(ctx context.Context, args []runtime.Object) (runtime.Obj
 	return evaluator.EvalBlock(f.Body, funcEnv)
 }
 
+// KeywordError returns the error message of keyword arguments not matching the parameters
+// after n positional arguments, or "" if they match
+func (f *Function) KeywordError(n int, keywords map[string]runtime.Object) string {
+	if len(keywords) == 0 {
+		return ""
+	}
+	for i, param := range f.Parameters {
+		if _, ok := keywords[param]; ok && i < n {
+			return fmt.Sprintf("argument %s given twice", param)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(keywords)) {
+		if !slices.Contains(f.Parameters, name) {
+			return fmt.Sprintf("unknown keyword argument %s", name)
+		}
+	}
+	return ""
+}
+
 func (f *Function) Not() runtime.Object {
 	return NewBoolean(!f.Truthy())
 }
@@ -5,12 +5,18 @@ import (
 	"iter"
 	"refl/runtime"
 	"sort"
+	"sync"
 )
 
 type ReflObject struct {
 	id          string
 	numFields   map[float64]runtime.Object
 	otherFields map[runtime.HashKey]otherFieldCarriage
+
+	// mu is only set for shared objects, see NewSharedObject
+	mu *sync.RWMutex
+	// frozen objects can't be modified, see Freeze
+	frozen bool
 }
 
 type otherFieldCarriage struct {
@@ -29,6 +35,49 @@ func NewObject() *ReflObject {
 	return result
 }
 
+// NewSharedObject creates an object that is safe to use from multiple coroutines.
+// Its fields are guarded by a lock and it is passed by reference instead of being cloned.
+func NewSharedObject() *ReflObject {
+	result := NewObject()
+	result.mu = &sync.RWMutex{}
+
+	return result
+}
+
+// Shared reports whether the object was created with NewSharedObject
+func (o *ReflObject) Shared() bool {
+	return o.mu != nil
+}
+
+// Freeze makes the object read-only, so that it can be used by several evaluators at once without locks.
+// Setting a field of a frozen object fails, its clones are regular objects.
+func (o *ReflObject) Freeze() {
+	o.frozen = true
+}
+
+// Frozen reports whether Freeze was called on the object
+func (o *ReflObject) Frozen() bool {
+	return o.frozen
+}
+
+func (o *ReflObject) lock() func() {
+	if o.mu == nil {
+		return func() {}
+	}
+
+	o.mu.Lock()
+	return o.mu.Unlock
+}
+
+func (o *ReflObject) rlock() func() {
+	if o.mu == nil {
+		return func() {}
+	}
+
+	o.mu.RLock()
+	return o.mu.RUnlock
+}
+
 func (o *ReflObject) Type() runtime.ObjectType { return runtime.ObjectType_ }
 func (o *ReflObject) String() string           { return "object" }
 func (o *ReflObject) Truthy() bool             { return true }
@@ -36,6 +85,10 @@ func (o *ReflObject) Equal(other runtime.Object) bool {
 	return o == other
 }
 func (o *ReflObject) Clone() runtime.Object {
+	if o.Shared() {
+		return o
+	}
+
 	cloned := NewObject()
 
 	for key, value := range o.numFields {
@@ -100,6 +153,8 @@ func (o *ReflObject) Not() runtime.Object {
 }
 
 func (o *ReflObject) Get(key runtime.Object) (runtime.Object, error) {
+	defer o.rlock()()
+
 	if key.Type() == runtime.NumberType {
 		numKey, _ := key.(*Number)
 
@@ -120,6 +175,12 @@ func (o *ReflObject) Get(key runtime.Object) (runtime.Object, error) {
 }
 
 func (o *ReflObject) Set(key, value runtime.Object) error {
+	if o.frozen {
+		return runtime.NewPanic("cannot modify frozen object", 0, 0)
+	}
+
+	defer o.lock()()
+
 	if key.Type() == runtime.NumberType {
 		numKey, _ := key.(*Number)
 
@@ -143,10 +204,16 @@ func (o *ReflObject) SetLiteral(key string, value runtime.Object) {
 }
 
 func (o *ReflObject) Length() int {
+	defer o.rlock()()
+
 	return len(o.numFields) + len(o.otherFields)
 }
 
 func (o *ReflObject) Iterator() iter.Seq2[runtime.Object, runtime.Object] {
+	if o.Shared() {
+		return o.snapshot().Iterator()
+	}
+
 	return func(yield func(runtime.Object, runtime.Object) bool) {
 		if len(o.numFields) > 0 {
 			keys := make([]float64, 0, len(o.numFields))
@@ -173,6 +240,21 @@ func (o *ReflObject) Iterator() iter.Seq2[runtime.Object, runtime.Object] {
 	}
 }
 
+// snapshot copies the fields of the object without cloning their values
+func (o *ReflObject) snapshot() *ReflObject {
+	defer o.rlock()()
+
+	result := NewObject()
+	for key, value := range o.numFields {
+		result.numFields[key] = value
+	}
+	for key, carriage := range o.otherFields {
+		result.otherFields[key] = carriage
+	}
+
+	return result
+}
+
 func (o *ReflObject) HashKey() runtime.HashKey {
 	return runtime.HashKey("obj_" + o.id)
 }
@@ -15,6 +15,11 @@ const (
 	PromiseStateRejected  PromiseState = "rejected"
 )
 
+// RejectionTracker is notified when a promise is rejected while no handlers are attached to it
+type RejectionTracker interface {
+	TrackRejection(p *Promise)
+}
+
 type Promise struct {
 	id string
 
@@ -24,20 +29,20 @@ type Promise struct {
 	result runtime.Object
 	err    error
 
-	then    []*Function
-	catch   []*Function
-	finally []*Function
+	listeners []func(result runtime.Object, err error)
+	done      chan struct{}
+
+	handled bool
+	tracker RejectionTracker
 
 	mu sync.RWMutex
 }
 
 func NewPromise(cancel context.CancelFunc) *Promise {
 	result := &Promise{
-		state:   PromiseStatePending,
-		cancel:  cancel,
-		then:    make([]*Function, 0),
-		catch:   make([]*Function, 0),
-		finally: make([]*Function, 0),
+		state:  PromiseStatePending,
+		cancel: cancel,
+		done:   make(chan struct{}),
 	}
 
 	result.id = fmt.Sprintf("%p", result)
@@ -45,6 +50,13 @@ func NewPromise(cancel context.CancelFunc) *Promise {
 	return result
 }
 
+// TrackRejections sets the tracker notified if the promise is rejected without handlers.
+// Must be called before the promise is shared.
+func (p *Promise) TrackRejections(tracker RejectionTracker) *Promise {
+	p.tracker = tracker
+	return p
+}
+
 func (p *Promise) Type() runtime.ObjectType { return runtime.ObjectType_ }
 func (p *Promise) String() string {
 	p.mu.RLock()
@@ -72,32 +84,24 @@ func (p *Promise) Get(key runtime.Object) (runtime.Object, error) {
 		}), nil
 	case "then":
 		return NewWrapperFunction(func(ctx context.Context, args []runtime.Object) (runtime.Object, error) {
-			if len(args) != 1 {
-				return nil, runtime.NewPanic("then() expects exactly 1 argument", 0, 0)
+			if len(args) != 1 && len(args) != 2 {
+				return nil, runtime.NewPanic("then() expects 1 or 2 arguments", 0, 0)
 			}
 
-			fn, ok := args[0].(*Function)
+			onFulfilled, ok := args[0].(*Function)
 			if !ok {
 				return nil, runtime.NewPanic("then() argument must be a function", 0, 0)
 			}
 
-			p.mu.Lock()
-			defer p.mu.Unlock()
-
-			if p.state == PromiseStateFulfilled {
-				evaluator := ctx.Value("evaluator").(Evaluator)
-				evaluator.EnqueueTask(func() {
-					_, err := fn.Call(evaluator.Context(), []runtime.Object{p.result})
-					if err != nil {
-						panic("promise resolve() failed: " + err.Error())
-					}
-				})
-				return p, nil
+			var onRejected *Function
+			if len(args) == 2 {
+				onRejected, ok = args[1].(*Function)
+				if !ok {
+					return nil, runtime.NewPanic("then() argument must be a function", 0, 0)
+				}
 			}
 
-			p.then = append(p.then, fn)
-
-			return p, nil
+			return p.chain(ctx.Value("evaluator").(Evaluator), onFulfilled, onRejected, nil), nil
 		}), nil
 
 	case "catch":
@@ -111,24 +115,7 @@ func (p *Promise) Get(key runtime.Object) (runtime.Object, error) {
 				return nil, runtime.NewPanic("catch() argument must be a function", 0, 0)
 			}
 
-			p.mu.Lock()
-			defer p.mu.Unlock()
-
-			if p.state == PromiseStateRejected {
-				evaluator := ctx.Value("evaluator").(Evaluator)
-				evaluator.EnqueueTask(func() {
-					_, err := fn.Call(ctx, []runtime.Object{NewError(p.err.Error())})
-					if err != nil {
-						panic("promise resolve() failed: " + err.Error())
-					}
-				})
-
-				return p, nil
-			}
-
-			p.catch = append(p.catch, fn)
-
-			return p, nil
+			return p.chain(ctx.Value("evaluator").(Evaluator), nil, fn, nil), nil
 		}), nil
 
 	case "finally":
@@ -142,28 +129,165 @@ func (p *Promise) Get(key runtime.Object) (runtime.Object, error) {
 				return nil, runtime.NewPanic("finally() argument must be a function", 0, 0)
 			}
 
-			p.mu.Lock()
-			defer p.mu.Unlock()
+			return p.chain(ctx.Value("evaluator").(Evaluator), nil, nil, fn), nil
+		}), nil
+	}
+
+	return nil, nil
+}
+
+// chain schedules the handlers on the evaluator's event loop once the promise is settled
+// and returns a new promise which is settled with the outcome of the handler that ran.
+// An outcome without a matching handler is passed through unchanged.
+func (p *Promise) chain(evaluator Evaluator, onFulfilled, onRejected, onFinally *Function) *Promise {
+	next := NewPromise(p.cancel)
+	if tracker, ok := evaluator.(RejectionTracker); ok {
+		next.TrackRejections(tracker)
+	}
 
-			if p.state != PromiseStatePending {
-				evaluator := ctx.Value("evaluator").(Evaluator)
-				evaluator.EnqueueTask(func() {
-					_, err := fn.Call(evaluator.Context(), []runtime.Object{})
-					if err != nil {
-						panic("promise finally() failed: " + err.Error())
-					}
-				})
+	p.OnSettle(func(result runtime.Object, err error) {
+		evaluator.EnqueueTask(func() {
+			ctx := evaluator.Context()
 
-				return p, nil
+			// handlers don't run once the evaluator is cancelled
+			if cancelErr := runtime.CheckContext(ctx); cancelErr != nil {
+				next.Reject(cancelErr)
+				return
 			}
 
-			p.finally = append(p.finally, fn)
+			switch {
+			case onFinally != nil:
+				if _, finallyErr := onFinally.Call(ctx, []runtime.Object{}); finallyErr != nil {
+					next.Reject(finallyErr)
+					return
+				}
+				next.Settle(result, err)
+			case err == nil && onFulfilled != nil:
+				next.adopt(onFulfilled.Call(ctx, []runtime.Object{result}))
+			case err != nil && onRejected != nil:
+				next.adopt(onRejected.Call(ctx, []runtime.Object{ErrorFrom(err)}))
+			default:
+				next.Settle(result, err)
+			}
+		})
+	})
 
-			return p, nil
-		}), nil
+	return next
+}
+
+// adopt settles the promise with the outcome of a handler call.
+// If the handler returned a promise, this promise follows it.
+func (p *Promise) adopt(value runtime.Object, err error) {
+	if err != nil {
+		p.Reject(err)
+		return
 	}
 
-	return nil, nil
+	if ret, isReturn := value.(*ReturnSignal); isReturn {
+		value = ret.Value
+	}
+
+	if value == nil {
+		value = NilInstance
+	}
+
+	if other, ok := value.(*Promise); ok {
+		other.OnSettle(p.Settle)
+		return
+	}
+
+	p.Resolve(value)
+}
+
+// Settle resolves the promise if err is nil and rejects it otherwise
+func (p *Promise) Settle(result runtime.Object, err error) {
+	if err != nil {
+		p.Reject(err)
+		return
+	}
+
+	p.Resolve(result)
+}
+
+// State returns the current state of the promise
+func (p *Promise) State() PromiseState {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.state
+}
+
+// Handled reports whether any handler was ever attached to the promise
+func (p *Promise) Handled() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.handled
+}
+
+// Err returns the rejection error, or nil if the promise isn't rejected
+func (p *Promise) Err() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.state != PromiseStateRejected {
+		return nil
+	}
+
+	return p.err
+}
+
+// Done returns a channel that is closed once the promise is settled
+func (p *Promise) Done() <-chan struct{} {
+	return p.done
+}
+
+// Cancel cancels the computation the promise is waiting for, if any
+func (p *Promise) Cancel() {
+	if p.cancel != nil {
+		p.cancel()
+	}
+}
+
+// Await blocks until the promise is settled and returns its result,
+// or the rejection error if the promise was rejected
+func (p *Promise) Await(ctx context.Context) (runtime.Object, error) {
+	select {
+	case <-p.done:
+	case <-ctx.Done():
+		return nil, runtime.NewCancelled(ctx)
+	}
+
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.state == PromiseStateRejected {
+		return nil, p.err
+	}
+
+	return p.result, nil
+}
+
+// OnSettle registers a go callback which is called once the promise is settled.
+// The callback runs synchronously in the goroutine settling the promise,
+// or immediately if the promise is already settled.
+func (p *Promise) OnSettle(fn func(result runtime.Object, err error)) {
+	p.mu.Lock()
+	p.handled = true
+
+	if p.state == PromiseStatePending {
+		p.listeners = append(p.listeners, fn)
+		p.mu.Unlock()
+		return
+	}
+
+	result, err := p.result, p.err
+	if p.state == PromiseStateFulfilled {
+		err = nil
+	}
+	p.mu.Unlock()
+
+	fn(result, err)
 }
 
 func (p *Promise) Set(_, _ runtime.Object) error {
@@ -180,62 +304,57 @@ func (p *Promise) Not() runtime.Object {
 	return NewBoolean(!p.Truthy())
 }
 
-func (p *Promise) Resolve(value runtime.Object, evaluator Evaluator) {
+// Resolve fulfills the promise with value. Settling an already settled promise is a no-op.
+func (p *Promise) Resolve(value runtime.Object) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 
 	if p.state != PromiseStatePending {
+		p.mu.Unlock()
 		return
 	}
 
 	p.state = PromiseStateFulfilled
 	p.result = value
 
-	for _, handler := range p.then {
-		evaluator.EnqueueTask(func() {
-			_, err := handler.Call(evaluator.Context(), []runtime.Object{value})
-			if err != nil {
-				panic("promise resolve() failed: " + err.Error())
-			}
-		})
-	}
+	listeners := p.settleLocked()
+	p.mu.Unlock()
 
-	for _, handler := range p.finally {
-		evaluator.EnqueueTask(func() {
-			_, err := handler.Call(evaluator.Context(), []runtime.Object{})
-			if err != nil {
-				panic("promise finally() failed: " + err.Error())
-			}
-		})
+	for _, listener := range listeners {
+		listener(value, nil)
 	}
 }
 
-func (p *Promise) Reject(errValue error, evaluator Evaluator) {
+// Reject rejects the promise with errValue. Settling an already settled promise is a no-op.
+func (p *Promise) Reject(errValue error) {
 	p.mu.Lock()
-	defer p.mu.Unlock()
 
 	if p.state != PromiseStatePending {
+		p.mu.Unlock()
 		return
 	}
 
 	p.state = PromiseStateRejected
 	p.err = errValue
 
-	for _, handler := range p.catch {
-		evaluator.EnqueueTask(func() {
-			_, err := handler.Call(evaluator.Context(), []runtime.Object{NewError(errValue.Error())})
-			if err != nil {
-				panic("promise reject() failed: " + err.Error())
-			}
-		})
+	listeners := p.settleLocked()
+	unhandled := !p.handled && p.tracker != nil
+	p.mu.Unlock()
+
+	for _, listener := range listeners {
+		listener(nil, errValue)
 	}
 
-	for _, handler := range p.finally {
-		evaluator.EnqueueTask(func() {
-			_, err := handler.Call(evaluator.Context(), []runtime.Object{})
-			if err != nil {
-				panic("promise finally() failed: " + err.Error())
-			}
-		})
+	if unhandled {
+		p.tracker.TrackRejection(p)
 	}
 }
+
+// settleLocked marks the promise as settled and returns the go listeners
+// waiting for it. Must be called with the lock held.
+func (p *Promise) settleLocked() []func(runtime.Object, error) {
+	listeners := p.listeners
+	p.listeners = nil
+	close(p.done)
+
+	return listeners
+}
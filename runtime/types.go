@@ -42,6 +42,16 @@ type Iterable interface {
 	Iterator() iter.Seq2[Object, Object]
 }
 
+// ContextIterable is an Iterable whose iteration may block and should stop once ctx is cancelled
+type ContextIterable interface {
+	IteratorContext(ctx context.Context) iter.Seq2[Object, Object]
+}
+
 type Callable interface {
 	Call(ctx context.Context, args []Object) (Object, error)
 }
+
+// KeywordCallable is a Callable which also takes arguments by parameter name, such as `f(b: 2)`
+type KeywordCallable interface {
+	CallKeywords(ctx context.Context, args []Object, keywords map[string]Object) (Object, error)
+}
@@ -0,0 +1,155 @@
+package script
+
+import (
+	"bytes"
+	"encoding/gob"
+	"os"
+	"path/filepath"
+	"refl/ast"
+	"sync"
+)
+
+// cacheVersion changes whenever the tree or the encoding of cache files change, invalidating older files
+const cacheVersion = 3
+
+func init() {
+	for _, node := range []ast.Node{
+		&ast.VarDeclaration{}, &ast.ExpressionStatement{}, &ast.IfStatement{}, &ast.ElifStatement{},
+		&ast.WhileStatement{}, &ast.ForStatement{}, &ast.BlockStatement{}, &ast.BreakStatement{},
+		&ast.ContinueStatement{}, &ast.ReturnStatement{}, &ast.Identifier{}, &ast.NumberLiteral{},
+		&ast.StringLiteral{}, &ast.RawStringLiteral{}, &ast.NilLiteral{}, &ast.ObjectLiteral{},
+		&ast.ArrayLiteral{}, &ast.FunctionLiteral{}, &ast.MemberDot{}, &ast.MemberBracket{},
+		&ast.FunctionCall{}, &ast.MethodCall{}, &ast.UnaryExpression{}, &ast.AwaitExpression{},
+		&ast.BinaryExpression{}, &ast.Assignment{}, &ast.Pattern{}, &ast.Tuple{},
+		&ast.Spread{}, &ast.KeywordArgument{},
+	} {
+		gob.Register(node)
+	}
+}
+
+// cacheFile is the content of a cache file
+type cacheFile struct {
+	Version    int
+	Hash       string
+	Pos        ast.Position
+	Statements []ast.Statement
+}
+
+// Cache compiles each source once. Programs are kept in memory and, if the cache has a directory,
+// in files named after the hash of their source, so that other processes can load them instead of compiling.
+// A Cache can be used by several goroutines at once.
+type Cache struct {
+	dir     string
+	opts    []Option
+	options Options
+
+	mu       sync.Mutex
+	programs map[string]*Program
+}
+
+// NewCache creates a cache keeping its files in dir, which is created when needed.
+// An empty dir keeps programs in memory only. The options are used for every compilation.
+func NewCache(dir string, opts ...Option) *Cache {
+	c := &Cache{dir: dir, opts: opts, programs: make(map[string]*Program)}
+	for _, opt := range opts {
+		opt.Apply(&c.options)
+	}
+	return c
+}
+
+// Compile returns the program of the source, from memory, from the cache file or by compiling it.
+// Unreadable or outdated cache files are replaced, failing to write one doesn't fail Compile.
+func (c *Cache) Compile(source string) (*Program, error) {
+	hash := Hash(source)
+
+	c.mu.Lock()
+	program, ok := c.programs[hash]
+	c.mu.Unlock()
+	if ok {
+		return program, nil
+	}
+
+	program = c.load(hash)
+	if program == nil {
+		var err error
+		program, err = Compile(source, c.opts...)
+		if err != nil {
+			return nil, err
+		}
+		_ = c.store(program)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// another goroutine may have compiled the same source meanwhile, its program wins
+	if existing, ok := c.programs[hash]; ok {
+		return existing, nil
+	}
+	c.programs[hash] = program
+
+	return program, nil
+}
+
+// path returns the path of the cache file of a source, compiled with or without optimizations
+func (c *Cache) path(hash string) string {
+	name := hash
+	if c.options.noOptimize {
+		name += "-noopt"
+	}
+	return filepath.Join(c.dir, name+".reflc")
+}
+
+func (c *Cache) load(hash string) *Program {
+	if c.dir == "" {
+		return nil
+	}
+
+	data, err := os.ReadFile(c.path(hash))
+	if err != nil {
+		return nil
+	}
+
+	var file cacheFile
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&file); err != nil {
+		return nil
+	}
+	if file.Version != cacheVersion || file.Hash != hash {
+		return nil
+	}
+
+	return &Program{hash: hash, program: &ast.Program{Pos: file.Pos, Statements: file.Statements}}
+}
+
+// store writes the cache file of the program, through a temporary file so that readers never see a partial one
+func (c *Cache) store(program *Program) error {
+	if c.dir == "" {
+		return nil
+	}
+
+	var buf bytes.Buffer
+	file := cacheFile{Version: cacheVersion, Hash: program.hash, Pos: program.program.Pos, Statements: program.program.Statements}
+	if err := gob.NewEncoder(&buf).Encode(file); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(c.dir, 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(c.dir, "*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), c.path(program.hash))
+}
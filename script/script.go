@@ -0,0 +1,74 @@
+// Package script compiles refl sources into programs that can be run any number of times, by any number of
+// evaluators at once, and caches them on disk
+package script
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"refl/ast"
+	"refl/optimize"
+	"refl/parser"
+	"refl/runtime"
+	"refl/runtime/eval"
+)
+
+type Options struct {
+	noOptimize bool
+}
+
+type Option interface {
+	Apply(*Options)
+}
+
+// OptionNoOptimize compiles the source as written, see the optimize package
+type OptionNoOptimize struct{}
+
+func (OptionNoOptimize) Apply(opts *Options) {
+	opts.noOptimize = true
+}
+
+// Program is a compiled source. It's immutable: evaluators only read its tree,
+// so a Program can be shared between goroutines.
+type Program struct {
+	hash    string
+	program *ast.Program
+}
+
+// Compile parses and optimizes the source. Syntax errors are returned as a parser.ErrorList.
+func Compile(source string, opts ...Option) (*Program, error) {
+	var options Options
+	for _, opt := range opts {
+		opt.Apply(&options)
+	}
+
+	program, err := parser.New().Parse(source)
+	if err != nil {
+		return nil, err
+	}
+
+	program = optimize.Program(program, optimize.OptionDisabled{Disabled: options.noOptimize})
+
+	return &Program{hash: Hash(source), program: program}, nil
+}
+
+// Hash returns the hex encoded SHA-256 hash of the source, which identifies its programs
+func Hash(source string) string {
+	sum := sha256.Sum256([]byte(source))
+	return hex.EncodeToString(sum[:])
+}
+
+// Hash returns the hash of the source the program was compiled from
+func (p *Program) Hash() string {
+	return p.hash
+}
+
+// AST returns the tree of the program, which is shared by the evaluators running it and must not be modified
+func (p *Program) AST() *ast.Program {
+	return p.program
+}
+
+// New creates an evaluator running the program in the environment
+func (p *Program) New(ctx context.Context, env *runtime.Environment, opts ...eval.Option) *eval.Evaluator {
+	return eval.New(ctx, p.program, env, opts...)
+}
@@ -0,0 +1,127 @@
+package script
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"refl/ast"
+	"refl/parser"
+	"refl/runtime"
+	"refl/runtime/eval"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const source = `var greet = fun(name) {
+  if 0 { return "never" }
+  return "hello " + name + "!"
+}
+var point = {x: 1 + 2, y: nil}
+for k, v in {greet("a"), point.x, point.y} {
+  io.println(k, v)
+}
+`
+
+func run(t *testing.T, program *Program, opts ...eval.Option) string {
+	var out bytes.Buffer
+	opts = append(opts, eval.OptionStdout{Writer: &out})
+	_, err := program.New(context.Background(), runtime.NewEnvironment(nil), opts...).Run()
+	require.NoError(t, err)
+	return out.String()
+}
+
+func TestCompile(t *testing.T) {
+	program, err := Compile(source)
+	require.NoError(t, err)
+	require.Equal(t, Hash(source), program.Hash())
+	require.Contains(t, program.AST().String(), "x: 3")
+	require.Equal(t, "0 hello a!\n1 3\n2 nil\n", run(t, program))
+
+	raw, err := Compile(source, OptionNoOptimize{})
+	require.NoError(t, err)
+	require.Contains(t, raw.AST().String(), "x: (1 + 2)")
+
+	_, err = Compile("var = 1")
+	var syntaxErrs parser.ErrorList
+	require.ErrorAs(t, err, &syntaxErrs)
+}
+
+func TestProgramConcurrently(t *testing.T) {
+	program, err := Compile(source)
+	require.NoError(t, err)
+	builtins := eval.NewSharedBuiltins()
+
+	var wg sync.WaitGroup
+	outputs := make([]string, 16)
+	for i := range outputs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			outputs[i] = run(t, program, eval.OptionSharedBuiltins{Builtins: builtins})
+		}()
+	}
+	wg.Wait()
+
+	for _, out := range outputs {
+		require.Equal(t, "0 hello a!\n1 3\n2 nil\n", out)
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, Hash(source)+".reflc")
+
+	cache := NewCache(dir)
+	program, err := cache.Compile(source)
+	require.NoError(t, err)
+	require.FileExists(t, path)
+
+	again, err := cache.Compile(source)
+	require.NoError(t, err)
+	require.Same(t, program, again)
+
+	t.Run("loads files", func(t *testing.T) {
+		loaded, err := NewCache(dir).Compile(source)
+		require.NoError(t, err)
+		require.NotSame(t, program, loaded)
+		require.True(t, ast.Equal(program.AST(), loaded.AST()))
+		require.Equal(t, program.AST().String(), loaded.AST().String())
+		require.Equal(t, "0 hello a!\n1 3\n2 nil\n", run(t, loaded))
+	})
+
+	t.Run("replaces broken files", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path, []byte("garbage"), 0o644))
+
+		recompiled, err := NewCache(dir).Compile(source)
+		require.NoError(t, err)
+		require.True(t, ast.Equal(program.AST(), recompiled.AST()))
+
+		loaded := NewCache(dir).load(Hash(source))
+		require.NotNil(t, loaded)
+	})
+
+	t.Run("options", func(t *testing.T) {
+		raw, err := NewCache(dir, OptionNoOptimize{}).Compile(source)
+		require.NoError(t, err)
+		require.FileExists(t, filepath.Join(dir, Hash(source)+"-noopt.reflc"))
+		require.False(t, ast.Equal(program.AST(), raw.AST()))
+	})
+
+	t.Run("syntax errors", func(t *testing.T) {
+		_, err := NewCache(dir).Compile("var = 1")
+		require.Error(t, err)
+		require.NoFileExists(t, filepath.Join(dir, Hash("var = 1")+".reflc"))
+	})
+
+	t.Run("memory only", func(t *testing.T) {
+		memory := NewCache("")
+		first, err := memory.Compile(source)
+		require.NoError(t, err)
+		second, err := memory.Compile(source)
+		require.NoError(t, err)
+		require.Same(t, first, second)
+	})
+}
@@ -0,0 +1,200 @@
+package testrunner
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Formats are the report formats accepted by Write
+var Formats = []string{"text", "tap", "junit"}
+
+// Write reports the results in the format, one of Formats
+func Write(w io.Writer, format string, results []Result) error {
+	switch format {
+	case "text":
+		return WriteText(w, results)
+	case "tap":
+		return WriteTAP(w, results)
+	case "junit":
+		return WriteJUnit(w, results)
+	}
+
+	return fmt.Errorf("unknown report format %q, expected one of %s", format, strings.Join(Formats, ", "))
+}
+
+// title names the test along with its file, or only the file if it couldn't be loaded
+func (r *Result) title() string {
+	if r.Name == "" {
+		return r.File
+	}
+	return r.File + ": " + r.Name
+}
+
+// WriteText reports the results like `go test -v`, the output of passed tests is omitted
+func WriteText(w io.Writer, results []Result) error {
+	var b strings.Builder
+
+	for _, result := range results {
+		status := "PASS"
+		if !result.Passed {
+			status = "FAIL"
+		}
+		fmt.Fprintf(&b, "--- %s: %s (%.3fs)\n", status, result.title(), result.Duration.Seconds())
+
+		if !result.Passed {
+			for _, line := range strings.Split(strings.TrimSuffix(result.Output, "\n"), "\n") {
+				if line != "" {
+					fmt.Fprintf(&b, "    %s\n", line)
+				}
+			}
+			for _, line := range strings.Split(result.Failure, "\n") {
+				fmt.Fprintf(&b, "    %s\n", line)
+			}
+		}
+	}
+
+	failed := Failed(results)
+	if failed > 0 {
+		b.WriteString("FAIL\n")
+	} else {
+		b.WriteString("PASS\n")
+	}
+	fmt.Fprintf(&b, "%d passed, %d failed\n", len(results)-failed, failed)
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// WriteTAP reports the results in the Test Anything Protocol version 13,
+// failures come as YAML diagnostics and the output of the tests as comments
+func WriteTAP(w io.Writer, results []Result) error {
+	var b strings.Builder
+
+	b.WriteString("TAP version 13\n")
+	fmt.Fprintf(&b, "1..%d\n", len(results))
+
+	for i, result := range results {
+		status := "ok"
+		if !result.Passed {
+			status = "not ok"
+		}
+		fmt.Fprintf(&b, "%s %d - %s\n", status, i+1, result.title())
+
+		for _, line := range strings.Split(strings.TrimSuffix(result.Output, "\n"), "\n") {
+			if line != "" {
+				fmt.Fprintf(&b, "# %s\n", line)
+			}
+		}
+
+		if !result.Passed {
+			b.WriteString("  ---\n")
+			fmt.Fprintf(&b, "  message: %s\n", strconv.Quote(result.Failure))
+			fmt.Fprintf(&b, "  file: %s\n", strconv.Quote(result.File))
+			if result.Line > 0 {
+				fmt.Fprintf(&b, "  line: %d\n", result.Line)
+			}
+			fmt.Fprintf(&b, "  duration_ms: %.3f\n", float64(result.Duration.Microseconds())/1000)
+			b.WriteString("  ...\n")
+		}
+	}
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+	Time     string           `xml:"time,attr"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+	SystemOut string        `xml:"system-out,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+// WriteJUnit reports the results as JUnit XML, with a test suite per file
+func WriteJUnit(w io.Writer, results []Result) error {
+	seconds := func(s float64) string {
+		return strconv.FormatFloat(s, 'f', 3, 64)
+	}
+
+	var suites []junitTestSuite
+	index := make(map[string]int)
+	var total float64
+
+	for _, result := range results {
+		i, ok := index[result.File]
+		if !ok {
+			i = len(suites)
+			index[result.File] = i
+			suites = append(suites, junitTestSuite{Name: result.File})
+		}
+
+		name := result.Name
+		if name == "" {
+			name = "(load)"
+		}
+
+		testCase := junitTestCase{
+			Name:      name,
+			Classname: result.File,
+			Time:      seconds(result.Duration.Seconds()),
+			SystemOut: result.Output,
+		}
+		if !result.Passed {
+			testCase.Failure = &junitFailure{Message: result.Failure, Text: result.Failure}
+			suites[i].Failures++
+		}
+
+		suites[i].Tests++
+		suites[i].Cases = append(suites[i].Cases, testCase)
+		total += result.Duration.Seconds()
+	}
+
+	report := junitTestSuites{Tests: len(results), Failures: Failed(results), Time: seconds(total)}
+	for _, suite := range suites {
+		var suiteTime float64
+		for _, result := range results {
+			if result.File == suite.Name {
+				suiteTime += result.Duration.Seconds()
+			}
+		}
+		suite.Time = seconds(suiteTime)
+		report.Suites = append(report.Suites, suite)
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(report); err != nil {
+		return err
+	}
+
+	_, err := io.WriteString(w, "\n")
+	return err
+}
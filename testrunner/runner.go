@@ -0,0 +1,236 @@
+// Package testrunner runs the tests written in refl: the top-level test_* functions of *_test.refl files
+package testrunner
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"refl/ast"
+	"refl/parser"
+	"refl/runtime"
+	"refl/runtime/eval"
+	"refl/runtime/objects"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DefaultTimeout is the time a test may run when Runner.Timeout is not set
+const DefaultTimeout = 5 * time.Second
+
+// Result is the outcome of a test, or of a file that couldn't be loaded, in which case Name is empty
+type Result struct {
+	File string
+	Name string
+	// Line is the line the test function is declared on
+	Line     int
+	Passed   bool
+	Failure  string
+	Output   string
+	Duration time.Duration
+}
+
+// Runner runs the tests of refl files, each test in a fresh evaluator
+type Runner struct {
+	// Timeout limits the time of every test, DefaultTimeout if zero
+	Timeout time.Duration
+	// Filter selects the tests to run by name, all of them if nil
+	Filter *regexp.Regexp
+}
+
+// testFunc is a top-level test function of a file
+type testFunc struct {
+	name string
+	line int
+}
+
+// Discover returns the *_test.refl files in the directories, recursively, files given explicitly are kept as is
+func Discover(paths []string) ([]string, error) {
+	var files []string
+	seen := make(map[string]bool)
+
+	add := func(path string) {
+		if !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+		}
+	}
+
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		if !info.IsDir() {
+			add(path)
+			continue
+		}
+
+		var found []string
+		err = filepath.WalkDir(path, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.IsDir() && p != path && strings.HasPrefix(d.Name(), ".") {
+				return filepath.SkipDir
+			}
+			if !d.IsDir() && strings.HasSuffix(d.Name(), "_test.refl") {
+				found = append(found, p)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(found)
+		for _, p := range found {
+			add(p)
+		}
+	}
+
+	return files, nil
+}
+
+// Run discovers the test files in the paths and runs their tests
+func (r *Runner) Run(ctx context.Context, paths []string) ([]Result, error) {
+	files, err := Discover(paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, file := range files {
+		results = append(results, r.RunFile(ctx, file)...)
+	}
+
+	return results, nil
+}
+
+// RunFile runs the tests of a file in the order they're declared
+func (r *Runner) RunFile(ctx context.Context, filename string) []Result {
+	source, err := os.ReadFile(filename)
+	if err != nil {
+		return []Result{{File: filename, Failure: err.Error()}}
+	}
+
+	p := parser.New()
+	program, err := p.Parse(string(source))
+	if err != nil {
+		var lines []string
+		for _, syntaxErr := range p.Errors() {
+			lines = append(lines, fmt.Sprintf("parse error: %v", syntaxErr))
+		}
+		if len(lines) == 0 {
+			lines = append(lines, fmt.Sprintf("parse error: %v", err))
+		}
+		return []Result{{File: filename, Failure: strings.Join(lines, "\n")}}
+	}
+
+	var results []Result
+	for _, test := range testFuncs(program) {
+		if r.Filter != nil && !r.Filter.MatchString(test.name) {
+			continue
+		}
+
+		results = append(results, r.runTest(ctx, filename, program, test))
+	}
+
+	return results
+}
+
+// testFuncs returns the functions declared or assigned at the top level whose names start with test_
+func testFuncs(program *ast.Program) []testFunc {
+	var result []testFunc
+	seen := make(map[string]bool)
+
+	add := func(name string, value ast.Expression, pos ast.Position) {
+		if _, ok := value.(*ast.FunctionLiteral); !ok || !strings.HasPrefix(name, "test_") || seen[name] {
+			return
+		}
+		seen[name] = true
+		result = append(result, testFunc{name: name, line: pos.Line})
+	}
+
+	for _, stmt := range program.Statements {
+		switch s := stmt.(type) {
+		case *ast.VarDeclaration:
+			add(s.Name, s.Value, s.Pos)
+		case *ast.ExpressionStatement:
+			if assign, ok := s.Expression.(*ast.Assignment); ok {
+				if ident, ok := assign.Left.(*ast.Identifier); ok {
+					add(ident.Name, assign.Right, s.Pos)
+				}
+			}
+		}
+	}
+
+	return result
+}
+
+// runTest evaluates the program in a fresh evaluator, then calls the test function.
+// A test fails if it stops with an error or returns an error value.
+func (r *Runner) runTest(ctx context.Context, filename string, program *ast.Program, test testFunc) Result {
+	timeout := r.Timeout
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var out bytes.Buffer
+	start := time.Now()
+	result := Result{File: filename, Name: test.name, Line: test.line}
+
+	err := func() error {
+		env := runtime.NewEnvironment(nil)
+		evaluator := eval.New(ctx, program, env, eval.OptionStdout{Writer: &out})
+
+		if _, err := evaluator.Run(); err != nil {
+			return err
+		}
+
+		fn, _ := env.Get(test.name)
+		value, err := evaluator.Call(fn, nil)
+		if err != nil {
+			return err
+		}
+
+		if userErr, ok := value.(*objects.UserError); ok {
+			return fmt.Errorf("returned error: %s", userErr.String())
+		}
+
+		return nil
+	}()
+
+	result.Duration = time.Since(start)
+	result.Output = out.String()
+	result.Passed = err == nil
+
+	if err != nil {
+		result.Failure = err.Error()
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			result.Failure = fmt.Sprintf("timed out after %v", timeout)
+		}
+	}
+
+	return result
+}
+
+// Failed returns the number of failed results
+func Failed(results []Result) int {
+	failed := 0
+	for _, result := range results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	return failed
+}
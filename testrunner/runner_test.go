@@ -0,0 +1,163 @@
+package testrunner
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const mathTests = `var add = fun(a, b) {
+  return a + b
+}
+
+var test_add = fun() {
+  assert.equal(add(1, 2), 3)
+}
+
+var test_fails = fun() {
+  io.println("computing")
+  assert.equal(add(1, 1), 3, "sum")
+}
+
+test_returns_error = fun() {
+  return errors.new("bad result")
+}
+
+var test_hangs = fun() {
+  while 1 {}
+}
+
+var helper = fun() {}
+var test_not_a_function = 5
+`
+
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0o755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+	return dir
+}
+
+// TestRunner verifies test discovery, the outcome of each test and the timeouts
+func TestRunner(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"math_test.refl":         mathTests,
+		"nested/ok_test.refl":    "var test_ok = fun() { assert.approx(0.1 + 0.2, 0.3) }",
+		"broken_test.refl":       "var test_x = fun( {\nvar = 1",
+		"lib.refl":               "var test_skipped = fun() { errors.panic(\"not a test file\") }",
+		".hidden/skip_test.refl": "var test_skipped = fun() { errors.panic(\"hidden\") }",
+	})
+
+	runner := &Runner{Timeout: 200 * time.Millisecond}
+	results, err := runner.Run(context.Background(), []string{dir})
+	require.NoError(t, err)
+
+	type outcome struct {
+		File, Name string
+		Line       int
+		Passed     bool
+	}
+	var outcomes []outcome
+	for _, result := range results {
+		rel, _ := filepath.Rel(dir, result.File)
+		outcomes = append(outcomes, outcome{rel, result.Name, result.Line, result.Passed})
+	}
+
+	require.Equal(t, []outcome{
+		{"broken_test.refl", "", 0, false},
+		{"math_test.refl", "test_add", 5, true},
+		{"math_test.refl", "test_fails", 9, false},
+		{"math_test.refl", "test_returns_error", 14, false},
+		{"math_test.refl", "test_hangs", 18, false},
+		{"nested/ok_test.refl", "test_ok", 1, true},
+	}, outcomes)
+
+	require.Len(t, strings.Split(results[0].Failure, "\n"), 2, "every syntax error is reported")
+	require.Contains(t, results[0].Failure, "parse error")
+	require.Equal(t, "computing\n", results[2].Output)
+	require.Contains(t, results[2].Failure, "assert.equal failed: sum: expected 3, got 2")
+	require.Equal(t, "returned error: bad result", results[3].Failure)
+	require.Equal(t, "timed out after 200ms", results[4].Failure)
+	require.Equal(t, 4, Failed(results))
+
+	runner.Filter = regexp.MustCompile("add|ok")
+	results, err = runner.Run(context.Background(), []string{filepath.Join(dir, "math_test.refl"), filepath.Join(dir, "nested")})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, 0, Failed(results))
+
+	_, err = runner.Run(context.Background(), []string{filepath.Join(dir, "missing")})
+	require.Error(t, err)
+}
+
+// TestReports verifies the text, TAP and JUnit reports
+func TestReports(t *testing.T) {
+	results := []Result{
+		{File: "a_test.refl", Name: "test_ok", Line: 1, Passed: true, Output: "hidden\n", Duration: time.Millisecond},
+		{File: "a_test.refl", Name: "test_bad", Line: 4, Failure: "assert.equal failed: expected 1, got 2", Output: "log\n", Duration: 2 * time.Millisecond},
+		{File: "b_test.refl", Failure: "parse error: oops"},
+	}
+
+	var text bytes.Buffer
+	require.NoError(t, Write(&text, "text", results))
+	require.Equal(t, `--- PASS: a_test.refl: test_ok (0.001s)
+--- FAIL: a_test.refl: test_bad (0.002s)
+    log
+    assert.equal failed: expected 1, got 2
+--- FAIL: b_test.refl (0.000s)
+    parse error: oops
+FAIL
+1 passed, 2 failed
+`, text.String())
+
+	var tap bytes.Buffer
+	require.NoError(t, Write(&tap, "tap", results))
+	require.Equal(t, `TAP version 13
+1..3
+ok 1 - a_test.refl: test_ok
+# hidden
+not ok 2 - a_test.refl: test_bad
+# log
+  ---
+  message: "assert.equal failed: expected 1, got 2"
+  file: "a_test.refl"
+  line: 4
+  duration_ms: 2.000
+  ...
+not ok 3 - b_test.refl
+  ---
+  message: "parse error: oops"
+  file: "b_test.refl"
+  duration_ms: 0.000
+  ...
+`, tap.String())
+
+	var junit bytes.Buffer
+	require.NoError(t, Write(&junit, "junit", results))
+
+	var report junitTestSuites
+	require.NoError(t, xml.Unmarshal(junit.Bytes(), &report))
+	require.Equal(t, 3, report.Tests)
+	require.Equal(t, 2, report.Failures)
+	require.Len(t, report.Suites, 2)
+	require.Equal(t, "a_test.refl", report.Suites[0].Name)
+	require.Equal(t, "0.003", report.Suites[0].Time)
+	require.Equal(t, "test_bad", report.Suites[0].Cases[1].Name)
+	require.Equal(t, "assert.equal failed: expected 1, got 2", report.Suites[0].Cases[1].Failure.Message)
+	require.Equal(t, "log\n", report.Suites[0].Cases[1].SystemOut)
+	require.Nil(t, report.Suites[0].Cases[0].Failure)
+	require.Equal(t, "(load)", report.Suites[1].Cases[0].Name)
+
+	require.Error(t, Write(&junit, "xml", results))
+}